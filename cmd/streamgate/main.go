@@ -13,7 +13,6 @@ import (
 	"streamgate/pkg/control"
 	"streamgate/pkg/engine"
 	"streamgate/pkg/ingest"
-	"streamgate/pkg/output"
 )
 
 func main() {
@@ -28,36 +27,85 @@ func main() {
 		log.Fatalf("Failed to create buffer: %v", err)
 	}
 
-	// 3. Processors (Dynamic)
-	// Start with an empty chain. The Watcher will update it.
-	chain := engine.NewProcessorChain()
-
-	// 4. Output
-	out := output.NewConsoleOutput()
-
-	// 5. Ingestors
+	// 3. Ingestors
 	tcpAddr := fmt.Sprintf(":%d", cfg.Server.TCPPort)
 	tcpIngestor := ingest.NewTCPIngestor(tcpAddr, buffer)
+	if ml := cfg.Server.TCPMultiline; ml.Enabled() {
+		err := tcpIngestor.EnableMultiline(ingest.MultilineConfig{
+			StartPattern:    ml.StartPattern,
+			ContinuePattern: ml.ContinuePattern,
+			MaxLines:        ml.MaxLines,
+			MaxBytes:        ml.MaxBytes,
+			FlushTimeout:    ml.FlushTimeout,
+		})
+		if err != nil {
+			log.Fatalf("Invalid TCP multiline config: %v", err)
+		}
+	}
+	if tlsCfg := cfg.Server.TCPTLS; tlsCfg.Enabled() {
+		err := tcpIngestor.EnableTLS(ingest.TLSConfig{
+			CertFile:     tlsCfg.CertFile,
+			KeyFile:      tlsCfg.KeyFile,
+			ClientCAFile: tlsCfg.ClientCAFile,
+		})
+		if err != nil {
+			log.Fatalf("Invalid TCP TLS config: %v", err)
+		}
+	}
 
 	udpAddr := fmt.Sprintf(":%d", cfg.Server.UDPPort)
 	udpIngestor := ingest.NewUDPIngestor(udpAddr, buffer)
 
-	// 6. Pipeline
-	pipeline := engine.NewPipeline(buffer, chain, out)
+	httpAddr := fmt.Sprintf(":%d", cfg.Server.HTTPPort)
+	httpIngestor := ingest.NewHTTPIngestor(httpAddr, buffer, ingest.HTTPConfig{
+		MaxBodyBytes: cfg.Server.HTTPMaxBodyBytes,
+		BearerToken:  cfg.Server.HTTPToken,
+	})
+
+	otlpAddr := fmt.Sprintf(":%d", cfg.Server.OTLPGRPCPort)
+	otlpIngestor := ingest.NewOTLPGRPCIngestor(otlpAddr, buffer, ingest.OTLPGRPCConfig{
+		BearerToken: cfg.Server.HTTPToken,
+	})
+
+	syslogAddr := fmt.Sprintf(":%d", cfg.Server.SyslogPort)
+	syslogIngestor := ingest.NewSyslogIngestor(syslogAddr, buffer)
+
+	forwardAddr := fmt.Sprintf(":%d", cfg.Server.ForwardPort)
+	forwardIngestor := ingest.NewForwardIngestor(forwardAddr, buffer)
+
+	var fileIngestor *ingest.FileIngestor
+	if fc := cfg.Server.File; fc.Enabled() {
+		fileIngestor, err = ingest.NewFileIngestor(buffer, ingest.FileConfig{
+			Include:        fc.Include,
+			Exclude:        fc.Exclude,
+			StartAt:        fc.StartAt,
+			CheckpointFile: fc.CheckpointFile,
+		})
+		if err != nil {
+			log.Fatalf("Invalid file input config: %v", err)
+		}
+	}
+
+	// 4. Router
+	// Pipelines are created from the manifest by the Watcher; the router
+	// hands each ingested entry to the first pipeline whose route matches.
+	router := engine.NewRouter(buffer)
 
-	// 7. Control Plane Watcher
+	// 5. Control Plane Watcher
 	// Use Redis address from config
-	watcher := control.NewWatcher(cfg.Redis.Address, pipeline)
+	watcher := control.NewWatcher(cfg.Redis.Address, router)
 
 	// --- Start ---
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start Pipeline (Consumer)
-	pipeline.Start(ctx)
+	// Start Watcher (builds and starts the pipelines). It returns once the
+	// initial manifest, or the default catch-all, has its routes installed,
+	// so the router never pops entries while the route table is empty.
+	watcher.Start(ctx)
 
-	// Start Watcher
-	go watcher.Start(ctx)
+	// Start Router (Consumer)
+	router.Start(ctx)
 
 	// Start Ingestors (Producers)
 	go func() {
@@ -72,6 +120,38 @@ func main() {
 		}
 	}()
 
+	go func() {
+		if err := httpIngestor.Start(); err != nil {
+			log.Fatalf("HTTP Ingestor died: %v", err)
+		}
+	}()
+
+	go func() {
+		if err := otlpIngestor.Start(); err != nil {
+			log.Fatalf("OTLP/gRPC Ingestor died: %v", err)
+		}
+	}()
+
+	go func() {
+		if err := syslogIngestor.Start(); err != nil {
+			log.Fatalf("Syslog Ingestor died: %v", err)
+		}
+	}()
+
+	go func() {
+		if err := forwardIngestor.Start(); err != nil {
+			log.Fatalf("Forward Ingestor died: %v", err)
+		}
+	}()
+
+	if fileIngestor != nil {
+		go func() {
+			if err := fileIngestor.Start(); err != nil {
+				log.Fatalf("File Ingestor died: %v", err)
+			}
+		}()
+	}
+
 	// Wait for shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -79,7 +159,25 @@ func main() {
 
 	<-sigChan
 	log.Println("Shutting down...")
+	if fileIngestor != nil {
+		// The checkpoint covers lines already in the buffer, so let the
+		// router hand them to the pipelines before they are stopped.
+		if err := fileIngestor.Stop(); err != nil {
+			log.Printf("File Ingestor checkpoint failed: %v", err)
+		}
+		waitDrained(buffer, 5*time.Second)
+	}
+	// Drain every pipeline through its chain and outputs; cancelling first
+	// would make the workers exit with entries still buffered.
+	watcher.Stop()
 	cancel()
-	time.Sleep(1 * time.Second) // Give workers time to flush
 	log.Println("Bye.")
 }
+
+// waitDrained waits up to timeout for the router to empty the ingest buffer.
+func waitDrained(buffer *engine.RingBuffer, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for buffer.Usage() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
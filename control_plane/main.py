@@ -19,6 +19,8 @@ r = redis.Redis(host=REDIS_HOST, port=REDIS_PORT, decode_responses=True)
 current_rules: List[ProcessorRule] = []
 current_outputs: List[OutputTarget] = []
 current_batch_size: int = 100
+current_workers: int = 1
+current_shard_key: str = "hash"
 
 
 @app.get("/")
@@ -95,6 +97,23 @@ def set_batch_size(size: int):
     return {"status": "updated", "batch_size": size}
 
 
+@app.get("/config/workers")
+def get_workers():
+    return {"workers": current_workers, "shard_key": current_shard_key}
+
+
+@app.post("/config/workers")
+def set_workers(workers: int, shard_key: str = "hash"):
+    global current_workers, current_shard_key
+    if workers < 1 or workers > 256:
+        raise HTTPException(
+            status_code=400, detail="Workers must be between 1 and 256"
+        )
+    current_workers = workers
+    current_shard_key = shard_key
+    return {"status": "updated", "workers": workers, "shard_key": shard_key}
+
+
 # --- Publish ---
 @app.post("/publish")
 def publish_config():
@@ -107,6 +126,8 @@ def publish_config():
         processors=current_rules,
         outputs=current_outputs,
         batch_size=current_batch_size,
+        workers=current_workers,
+        shard_key=current_shard_key,
     )
     manifest = Manifest(pipelines=[pipeline])
 
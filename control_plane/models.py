@@ -5,31 +5,112 @@ import time
 
 class ProcessorRule(BaseModel):
     id: str
-    type: Literal["filter", "redact", "attribute_filter"]
+    type: Literal[
+        "filter",
+        "redact",
+        "redact_regex",
+        "pii_redact",
+        "pseudonymize",
+        "sample",
+        "throttle",
+        "dedup",
+        "parse",
+        "transform",
+        "attribute_filter",
+    ]
     params: Dict[str, str] = Field(
         ..., description="Configuration parameters for the processor"
     )
 
     # Example params:
     # Filter: {"value": "DEBUG"}
-    # Redact: {"pattern": "\\d{3}-\\d{2}-\\d{4}", "replacement": "XXX-XX-XXXX"}
+    # Filter (allow list: keep only matching logs): {"value": "AUDIT", "action": "keep"}
+    # Filter (many words, one pass; values_file has one word per line, # comments):
+    #   {"values": "healthcheck,heartbeat", "values_file": "/etc/sg/noise.txt",
+    #    "case_insensitive": "true"}
+    # Redact (literal match): {"pattern": "4111-1111", "replacement": "XXXX"}
+    # RedactRegex (compiled once; replacement is a template):
+    #   {"pattern": "\\d{3}-\\d{2}-(?P<last4>\\d{4})", "replacement": "XXX-XX-${last4}"}
+    # RedactRegex (mask only named groups, length-preserving):
+    #   {"pattern": "(?P<user>\\w+)@corp\\.com", "groups": "user", "mask_char": "*"}
+    # PIIRedact (built-in detectors; empty detectors = all):
+    #   {"detectors": "credit_card,ssn,email", "strategy.email": "label"}
+    #   detectors: private_key, jwt, aws, gcp, github, slack, iban, credit_card,
+    #              ssn, email, ipv4, ipv6, phone
+    #   strategies: label ([REDACTED:<name>]), mask (****), partial (keep last 4, ...)
+    # Pseudonymize (same value -> same "<key_id>:<hmac>" token; key never in Redis):
+    #   {"paths": "user/email,user/id", "key_id": "2024-06", "key_env": "SG_PSEUDO_KEY"}
+    #   {"pattern": "user=(?P<u>\\w+)", "groups": "u", "key_id": "k1", "key_file": "/k"}
+    # Sample (random keep-rate; overrides: attribute value > severity > rate):
+    #   {"rate": "0.1", "severity_rates": "debug=0.01,error=1"}
+    # Sample (hash-consistent: a whole trace is kept or dropped together):
+    #   {"mode": "hash", "key": "trace_id", "rate": "0.2",
+    #    "attribute": "service.name", "attribute_rates": "checkout=1"}
+    # Throttle (token bucket per key; over-limit action: drop | sample | tag):
+    #   {"attribute": "service.name", "rate": "500", "burst": "1000",
+    #    "action": "sample", "sample_rate": "0.01", "window": "1m"}
+    #   A summary line with per-key suppressed counts is emitted every window.
+    # Dedup (first copy passes, repeats in the window are collapsed into one
+    # summary with repeat_count / first_seen / last_seen):
+    #   {"window": "30s", "ignore": "timestamp,request_id"}
+    #   {"window": "1m", "paths": "service,error/type"}
+    # Parse (text -> JSON fields, for later filters; JSON logs pass through):
+    #   {"format": "logfmt", "keep_original": "message", "failure_tag": "_unparsed"}
+    #   {"format": "kv", "field_split": "&", "value_split": ":"}
+    #   {"format": "regex", "pattern": "^(?P<level>\\w+): (?P<msg>.*)$"}
+    #   {"format": "grok", "pattern": "%{COMBINEDAPACHELOG}",
+    #    "patterns_file": "/etc/sg/grok"}  (bundled: IP, LOGLEVEL, SYSLOGBASE, ...)
+    #   "field": "log" parses that field of JSON logs instead (e.g. container logs)
+    # Transform (JSON edits on "/" paths, in order; one per line or ";"):
+    #   set <path> <value>  (JSON literal, or string with ${path} templates)
+    #   rename <path> <new_key>, remove <path>..., copy|move <path> <to>,
+    #   flatten [path], unflatten [path]  ("separator" param, default ".")
+    #   {"ops": "remove stack_trace", "when": "NOT level in (error, fatal)"}
+    #   {"ops": "rename msg message; set env prod; move k8s/pod pod"}
     # AttributeFilter (well-known OTel attribute, auto-search):
     #   {"attribute": "service.name", "operator": "equals", "value": "test-service"}
     # AttributeFilter (explicit path):
     #   {"path": "resource/attributes/custom.field", "operator": "contains", "value": "debug"}
+    # AttributeFilter (expression: and/or/not, (), = != > >= < <=, in/not_in,
+    # exists, contains/starts_with/ends_with (+ _i variants), matches, cidr):
+    #   {"expr": "level = debug AND service in (a, b) AND NOT http.status_code >= 500"}
+    # Filters take "action": "drop" (default) | "keep" (allow list), and
+    # AttributeFilter takes "on_missing": "keep" (fail-open, default) | "drop"
+    # for logs without the attribute or that aren't JSON:
+    #   {"expr": "event.type in (login)", "action": "keep", "on_missing": "drop"}
 
 
 class OutputTarget(BaseModel):
-    type: Literal["console", "http"]
-    url: Optional[str] = None
-    headers: Optional[Dict[str, str]] = None
+    type: Literal["console", "http", "otlp"]
+    url: Optional[str] = None  # otlp: the Collector's host:port
+    headers: Optional[Dict[str, str]] = None  # otlp: sent as gRPC metadata
+    # otlp params: insecure, ca_file, cert_file, key_file, server_name,
+    # insecure_skip_verify, compression ("gzip"/"none"), timeout, max_elapsed,
+    # max_batch
+    params: Optional[Dict[str, str]] = None
+
+
+class RouteRule(BaseModel):
+    # All set fields must match. Pipelines are tried in order; first match wins.
+    listener: Optional[str] = None  # e.g. "tcp", "udp", "syslog", "forward", "file"
+    source: Optional[str] = None  # sender IP or CIDR, e.g. "10.0.0.0/8"
+    identity: Optional[str] = None  # TLS client CN/SAN glob, e.g. "*.corp"
+    attribute: Optional[str] = None
+    path: Optional[str] = None
+    operator: Optional[Literal["equals", "contains", "regex"]] = None
+    value: Optional[str] = None
 
 
 class PipelineConfig(BaseModel):
     name: str
+    route: Optional[RouteRule] = None  # None = catch-all
     processors: List[ProcessorRule]
     outputs: List[OutputTarget] = Field(default_factory=list)
     batch_size: int = Field(default=100, ge=1, le=10000)
+    workers: int = Field(default=1, ge=1, le=256)
+    # "hash" spreads entries evenly; an attribute name (e.g. "service.name")
+    # keeps entries with the same value in order on one worker.
+    shard_key: str = "hash"
 
 
 class Manifest(BaseModel):
@@ -2,7 +2,11 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds the specific configuration for the StreamGate instance.
@@ -15,6 +19,65 @@ type ServerConfig struct {
 	TCPPort  int `yaml:"tcp_port"`
 	UDPPort  int `yaml:"udp_port"`
 	HTTPPort int `yaml:"http_port"`
+	// OTLPGRPCPort serves the OTLP/gRPC logs receiver.
+	OTLPGRPCPort int `yaml:"otlp_grpc_port"`
+	// SyslogPort receives syslog on both UDP and TCP.
+	SyslogPort int `yaml:"syslog_port"`
+	// ForwardPort receives the Fluent Forward protocol (Fluent Bit, Fluentd).
+	ForwardPort int `yaml:"forward_port"`
+
+	// TCPMultiline joins multi-line events (stack traces) on TCP connections.
+	TCPMultiline MultilineConfig `yaml:"tcp_multiline"`
+	// TCPTLS terminates TLS (optionally mutual) on the TCP listener.
+	TCPTLS TLSConfig `yaml:"tcp_tls"`
+	// File tails log files on disk.
+	File FileConfig `yaml:"file"`
+
+	// HTTPToken, if set, is the bearer token HTTP and OTLP/gRPC ingest require.
+	HTTPToken string `yaml:"http_token"`
+	// HTTPMaxBodyBytes limits HTTP ingest request bodies (0 = 10 MiB).
+	HTTPMaxBodyBytes int64 `yaml:"http_max_body_bytes"`
+}
+
+// MultilineConfig is off unless a start or continue pattern is set.
+// Zero limits use the ingestor's defaults.
+type MultilineConfig struct {
+	StartPattern    string        `yaml:"start_pattern"`
+	ContinuePattern string        `yaml:"continue_pattern"`
+	MaxLines        int           `yaml:"max_lines"`
+	MaxBytes        int           `yaml:"max_bytes"`
+	FlushTimeout    time.Duration `yaml:"flush_timeout"`
+}
+
+// Enabled reports whether any aggregation rule is set.
+func (m MultilineConfig) Enabled() bool {
+	return m.StartPattern != "" || m.ContinuePattern != ""
+}
+
+// TLSConfig is off unless a certificate is set. Certificate files are
+// reloaded when they change.
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"` // set to require client certificates
+}
+
+// Enabled reports whether TLS is configured.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// FileConfig is off unless an include pattern is set.
+type FileConfig struct {
+	Include        []string `yaml:"include"` // glob patterns
+	Exclude        []string `yaml:"exclude"`
+	StartAt        string   `yaml:"start_at"`        // "beginning" or "end" (default) for files without a checkpoint
+	CheckpointFile string   `yaml:"checkpoint_file"` // empty disables checkpointing
+}
+
+// Enabled reports whether any files are to be tailed.
+func (f FileConfig) Enabled() bool {
+	return len(f.Include) > 0
 }
 
 type RedisConfig struct {
@@ -32,11 +95,34 @@ func DefaultConfig() *Config {
 	}
 	redisAddr := fmt.Sprintf("%s:6379", redisHost)
 
+	var httpMaxBody int64
+	if v := os.Getenv("SG_HTTP_MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Printf("Ignoring SG_HTTP_MAX_BODY_BYTES=%q: %v", v, err)
+		}
+		httpMaxBody = n
+	}
+
+	tcpTLS := TLSConfig{
+		CertFile:     os.Getenv("SG_TCP_TLS_CERT"),
+		KeyFile:      os.Getenv("SG_TCP_TLS_KEY"),
+		ClientCAFile: os.Getenv("SG_TCP_TLS_CLIENT_CA"),
+	}
+
 	return &Config{
 		Server: ServerConfig{
-			TCPPort:  8081,
-			UDPPort:  8082,
-			HTTPPort: 8080,
+			TCPPort:          8081,
+			UDPPort:          8082,
+			HTTPPort:         8080,
+			OTLPGRPCPort:     4317,
+			SyslogPort:       5514,
+			ForwardPort:      24224,
+			TCPMultiline:     multilineFromEnv(),
+			TCPTLS:           tcpTLS,
+			File:             fileFromEnv(),
+			HTTPToken:        os.Getenv("SG_HTTP_TOKEN"),
+			HTTPMaxBodyBytes: httpMaxBody,
 		},
 		Redis: RedisConfig{
 			Address: redisAddr,
@@ -44,3 +130,60 @@ func DefaultConfig() *Config {
 		},
 	}
 }
+
+// multilineFromEnv reads TCP multi-line settings:
+// SG_TCP_MULTILINE_START, SG_TCP_MULTILINE_CONTINUE (regexes),
+// SG_TCP_MULTILINE_MAX_LINES, SG_TCP_MULTILINE_MAX_BYTES and
+// SG_TCP_MULTILINE_TIMEOUT (a duration, e.g. "2s").
+// Malformed numbers are logged and left at their defaults.
+func multilineFromEnv() MultilineConfig {
+	m := MultilineConfig{
+		StartPattern:    os.Getenv("SG_TCP_MULTILINE_START"),
+		ContinuePattern: os.Getenv("SG_TCP_MULTILINE_CONTINUE"),
+	}
+	if v := os.Getenv("SG_TCP_MULTILINE_MAX_LINES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Printf("Ignoring SG_TCP_MULTILINE_MAX_LINES=%q: %v", v, err)
+		}
+		m.MaxLines = n
+	}
+	if v := os.Getenv("SG_TCP_MULTILINE_MAX_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Printf("Ignoring SG_TCP_MULTILINE_MAX_BYTES=%q: %v", v, err)
+		}
+		m.MaxBytes = n
+	}
+	if v := os.Getenv("SG_TCP_MULTILINE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("Ignoring SG_TCP_MULTILINE_TIMEOUT=%q: %v", v, err)
+		}
+		m.FlushTimeout = d
+	}
+	return m
+}
+
+// fileFromEnv reads file tailing settings: SG_FILE_INCLUDE and
+// SG_FILE_EXCLUDE (comma-separated globs), SG_FILE_START_AT and
+// SG_FILE_CHECKPOINT (the checkpoint file's path).
+func fileFromEnv() FileConfig {
+	return FileConfig{
+		Include:        splitList(os.Getenv("SG_FILE_INCLUDE")),
+		Exclude:        splitList(os.Getenv("SG_FILE_EXCLUDE")),
+		StartAt:        os.Getenv("SG_FILE_START_AT"),
+		CheckpointFile: os.Getenv("SG_FILE_CHECKPOINT"),
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
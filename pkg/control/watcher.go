@@ -1,11 +1,19 @@
 package control
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"strconv"
 	"streamgate/pkg/engine"
 	"streamgate/pkg/output"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -17,9 +25,25 @@ type Manifest struct {
 
 type PipelineConfig struct {
 	Name       string          `json:"name"`
+	Route      *RouteRule      `json:"route,omitempty"` // nil = catch-all
 	Processors []ProcessorRule `json:"processors"`
 	Outputs    []OutputTarget  `json:"outputs"`
 	BatchSize  int             `json:"batch_size"`
+	Workers    int             `json:"workers"`   // 0 or 1 = single worker
+	ShardKey   string          `json:"shard_key"` // "hash" (default) or an attribute such as "service.name"
+}
+
+// RouteRule selects which ingested entries a pipeline receives.
+// All set fields must match. Pipelines are tried in manifest order and the
+// first match wins, so a catch-all pipeline should come last.
+type RouteRule struct {
+	Listener  string `json:"listener"`  // e.g. "tcp", "udp", "syslog", "forward", "file"
+	Source    string `json:"source"`    // sender IP or CIDR
+	Identity  string `json:"identity"`  // TLS client identity (glob)
+	Attribute string `json:"attribute"` // well-known OTel attribute (auto-search)
+	Path      string `json:"path"`      // or explicit path (using /)
+	Operator  string `json:"operator"`
+	Value     string `json:"value"`
 }
 
 type ProcessorRule struct {
@@ -32,28 +56,51 @@ type OutputTarget struct {
 	Type    string            `json:"type"`
 	URL     string            `json:"url"`
 	Headers map[string]string `json:"headers"`
+	Params  map[string]string `json:"params"`
 }
 
+// pipelineBufferSize is the per-pipeline buffer the router feeds (power of 2).
+const pipelineBufferSize = 16384
+
+// defaultPipelineName is used for the pass-through pipeline installed when no
+// config exists yet.
+const defaultPipelineName = "default"
+
 type Watcher struct {
 	redisClient *redis.Client
-	pipeline    *engine.Pipeline
+	router      *engine.Router
+
+	// Running pipelines by name. mu serializes apply and Stop.
+	mu        sync.Mutex
+	ctx       context.Context
+	pipelines map[string]*engine.Pipeline
+	stopped   bool
 }
 
-func NewWatcher(addr string, pipeline *engine.Pipeline) *Watcher {
+func NewWatcher(addr string, router *engine.Router) *Watcher {
 	rdb := redis.NewClient(&redis.Options{
 		Addr: addr,
 	})
 	return &Watcher{
 		redisClient: rdb,
-		pipeline:    pipeline,
+		router:      router,
+		pipelines:   make(map[string]*engine.Pipeline),
 	}
 }
 
+// Start loads the initial manifest, falling back to a pass-through pipeline,
+// and installs its routes before returning. Updates are then applied from a
+// background subscriber.
 func (w *Watcher) Start(ctx context.Context) {
 	log.Println("Control: Starting Config Watcher...")
+	w.ctx = ctx
 
 	// 1. Initial Load
 	w.reload()
+	if len(w.pipelines) == 0 {
+		// Nothing in Redis yet: pass everything through to the console.
+		w.apply(Manifest{Pipelines: []PipelineConfig{{Name: defaultPipelineName}}})
+	}
 
 	// 2. Subscribe to updates
 	pubsub := w.redisClient.Subscribe(ctx, "streamgate_updates")
@@ -90,79 +137,619 @@ func (w *Watcher) reload() {
 		return
 	}
 
-	// For Prototype: We only support one pipeline named "default_pipeline" or the first one
+	w.apply(manifest)
+}
+
+// apply reconciles running pipelines with the manifest: pipelines are matched
+// by name, new ones are started, existing ones are hot-swapped in place and
+// ones no longer listed are stopped once the router stops feeding them.
+func (w *Watcher) apply(manifest Manifest) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
 	if len(manifest.Pipelines) == 0 {
+		log.Println("Control: Manifest has no pipelines. Keeping current state.")
 		return
 	}
-	cfg := manifest.Pipelines[0]
 
-	// Build Chain
+	// Pass 1: resolve pipelines, compile chains and routes. Nothing running is
+	// touched yet, so a bad processor, output or route rejects the whole manifest.
+	next := make(map[string]*engine.Pipeline, len(manifest.Pipelines))
+	chains := make(map[string]*engine.ProcessorChain, len(manifest.Pipelines))
+	outs := make(map[string]output.Output, len(manifest.Pipelines))
+	routes := make([]*engine.Route, 0, len(manifest.Pipelines))
+	applied := false
+	defer func() {
+		if applied {
+			return
+		}
+		// Rejected: close the outputs built for it.
+		for _, out := range outs {
+			if c, ok := out.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}()
+	for i := range manifest.Pipelines {
+		cfg := &manifest.Pipelines[i]
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("pipeline_%d", i)
+		}
+		if _, dup := next[cfg.Name]; dup {
+			log.Printf("Control: Duplicate pipeline name %q. Keeping current state.", cfg.Name)
+			return
+		}
+
+		p, ok := w.pipelines[cfg.Name]
+		if !ok {
+			buf, err := engine.NewRingBuffer(pipelineBufferSize)
+			if err != nil {
+				log.Printf("Control: Failed to create buffer for pipeline %s: %v", cfg.Name, err)
+				return
+			}
+			p = engine.NewPipeline(buf, engine.NewProcessorChain(), output.NewConsoleOutput())
+		}
+		next[cfg.Name] = p
+
+		chain, err := buildChain(cfg.Processors)
+		if err != nil {
+			log.Printf("Control: Invalid processors for pipeline %s: %v. Keeping current state.", cfg.Name, err)
+			return
+		}
+		chains[cfg.Name] = chain
+
+		out, err := buildOutputs(cfg.Outputs)
+		if err != nil {
+			log.Printf("Control: Invalid outputs for pipeline %s: %v. Keeping current state.", cfg.Name, err)
+			return
+		}
+		outs[cfg.Name] = out
+
+		route, err := engine.NewRoute(cfg.Name, p, routeConfig(cfg.Route))
+		if err != nil {
+			log.Printf("Control: Invalid route for pipeline %s: %v. Keeping current state.", cfg.Name, err)
+			return
+		}
+		routes = append(routes, route)
+	}
+
+	// Pass 2: configure and start.
+	applied = true
+	for _, cfg := range manifest.Pipelines {
+		p := next[cfg.Name]
+		w.configurePipeline(p, cfg, chains[cfg.Name], outs[cfg.Name])
+		if _, running := w.pipelines[cfg.Name]; !running {
+			p.Start(w.ctx)
+			log.Printf("Control: Pipeline %s started.", cfg.Name)
+		}
+	}
+
+	// Swap routes, then stop pipelines that are no longer routed to.
+	w.router.Update(routes)
+	for name, p := range w.pipelines {
+		if _, keep := next[name]; !keep {
+			p.Stop()
+			log.Printf("Control: Pipeline %s stopped.", name)
+		}
+	}
+	w.pipelines = next
+}
+
+// Stop clears the route table and drains every pipeline through its chain
+// and outputs. It must be called before the context passed to Start is
+// cancelled: a cancelled worker exits without draining its buffer.
+// Later updates are ignored.
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+
+	// Waits for entries the router is still handing over.
+	w.router.Update(nil)
+	for name, p := range w.pipelines {
+		p.Stop()
+		log.Printf("Control: Pipeline %s stopped.", name)
+	}
+	w.pipelines = nil
+}
+
+func routeConfig(rule *RouteRule) engine.RouteConfig {
+	if rule == nil {
+		return engine.RouteConfig{}
+	}
+	return engine.RouteConfig{
+		Listener:  rule.Listener,
+		Source:    rule.Source,
+		Identity:  rule.Identity,
+		Attribute: rule.Attribute,
+		Path:      rule.Path,
+		Operator:  engine.Operator(rule.Operator),
+		Value:     rule.Value,
+	}
+}
+
+// configurePipeline hot-swaps chain, outputs, batch size and workers.
+func (w *Watcher) configurePipeline(p *engine.Pipeline, cfg PipelineConfig, chain *engine.ProcessorChain, out output.Output) {
+	p.UpdateChain(chain)
+
+	// Use FanOut manager to handle multiple outputs
+	p.UpdateOutput(out)
+
+	// Update Batch Size
+	// If 0 (omitted), default to 100 inside UpdateBatchSize or handle here.
+	// We'll pass it directly, Pipeline handles < 1.
+	// But let's respect default 100 if missing.
+	bz := int64(cfg.BatchSize)
+	if bz == 0 {
+		bz = 100
+	}
+	p.UpdateBatchSize(bz)
+
+	// Update Workers
+	// Entries with the same shard key always go to the same worker, so their order is kept.
+	p.UpdateWorkers(cfg.Workers, cfg.ShardKey)
+}
+
+// buildChain compiles processor rules into a chain. Any rule that fails to
+// build (unknown type, bad regex, missing params, ...) fails the whole chain.
+func buildChain(rules []ProcessorRule) (*engine.ProcessorChain, error) {
 	var processors []engine.Processor
-	for _, rule := range cfg.Processors {
+	for _, rule := range rules {
 		switch rule.Type {
 		case "filter":
-			// Params: key, value
-			// In V1 filter implementation, we might only support 'contains' on the whole body or simple checks.
-			// The current engine.FilterProcessor logic checks if the body contains any of the keywords.
-			if val, ok := rule.Params["value"]; ok {
-				processors = append(processors, engine.NewFilterProcessor(rule.ID, []string{val}))
+			// Params: value (one word), values (comma-separated), values_file
+			// (one word per line), case_insensitive ("true"), action (drop|keep)
+			proc, err := buildFilter(rule)
+			if err != nil {
+				return nil, fmt.Errorf("filter %s: %w", rule.ID, err)
+			}
+			if proc != nil {
+				processors = append(processors, proc)
 			}
 		case "redact":
-			// Params: pattern, replacement
+			// Params: pattern, replacement (may be empty to delete the match)
 			pat := rule.Params["pattern"]
-			rep := rule.Params["replacement"]
-			if pat != "" && rep != "" {
-				processors = append(processors, engine.NewRedactionProcessor(rule.ID, pat, rep))
+			rep, ok := rule.Params["replacement"]
+			if pat == "" {
+				return nil, fmt.Errorf("redact %s: missing pattern", rule.ID)
 			}
+			if !ok {
+				return nil, fmt.Errorf("redact %s: missing replacement", rule.ID)
+			}
+			processors = append(processors, engine.NewRedactionProcessor(rule.ID, pat, rep))
+		case "parse":
+			// Params: format (grok|logfmt|kv|regex), pattern (grok/regex),
+			// patterns_file (extra grok patterns, "NAME regex" per line),
+			// field_split/value_split (kv), field (parse this field of JSON logs),
+			// keep_original (field for the raw text), failure_tag (field set on failure)
+			cfg := engine.ParseConfig{
+				Name:         rule.ID,
+				Format:       engine.ParseFormat(rule.Params["format"]),
+				Pattern:      rule.Params["pattern"],
+				FieldSplit:   rule.Params["field_split"],
+				ValueSplit:   rule.Params["value_split"],
+				Field:        rule.Params["field"],
+				KeepOriginal: rule.Params["keep_original"],
+				FailureTag:   rule.Params["failure_tag"],
+			}
+			if file := rule.Params["patterns_file"]; file != "" {
+				patterns, err := loadGrokPatterns(file)
+				if err != nil {
+					return nil, fmt.Errorf("parse %s: %w", rule.ID, err)
+				}
+				cfg.Patterns = patterns
+			}
+			proc, err := engine.NewParseProcessor(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", rule.ID, err)
+			}
+			processors = append(processors, proc)
+		case "transform":
+			// Params: ops (one per line or ";"-separated, e.g. "remove stack_trace;
+			// rename msg message"; see engine.ParseTransformOps), when (condition,
+			// as attribute_filter expr), separator (flatten/unflatten, default ".")
+			ops, err := engine.ParseTransformOps(rule.Params["ops"])
+			if err != nil {
+				return nil, fmt.Errorf("transform %s: %w", rule.ID, err)
+			}
+			proc, err := engine.NewTransformProcessor(engine.TransformConfig{
+				Name:      rule.ID,
+				Ops:       ops,
+				When:      rule.Params["when"],
+				Separator: rule.Params["separator"],
+			})
+			if err != nil {
+				return nil, fmt.Errorf("transform %s: %w", rule.ID, err)
+			}
+			processors = append(processors, proc)
 		case "attribute_filter":
 			// Params: attribute OR path, operator, value
+			// OR expr, e.g. "level = debug AND NOT http.status_code >= 500";
+			// action (drop|keep), on_missing (keep|drop)
 			cfg := engine.AttributeFilterConfig{
-				Name:      rule.ID,
-				Attribute: rule.Params["attribute"],
-				Path:      rule.Params["path"],
-				Operator:  engine.Operator(rule.Params["operator"]),
-				Value:     rule.Params["value"],
+				Name:       rule.ID,
+				Attribute:  rule.Params["attribute"],
+				Path:       rule.Params["path"],
+				Operator:   engine.Operator(rule.Params["operator"]),
+				Value:      rule.Params["value"],
+				Expression: rule.Params["expr"],
+				Action:     engine.FilterAction(rule.Params["action"]),
+				OnMissing:  engine.MissingPolicy(rule.Params["on_missing"]),
 			}
 			proc, err := engine.NewAttributeFilterProcessor(cfg)
 			if err != nil {
-				log.Printf("Control: Failed to create attribute_filter %s: %v", rule.ID, err)
-				continue
+				return nil, fmt.Errorf("attribute_filter %s: %w", rule.ID, err)
+			}
+			processors = append(processors, proc)
+		case "redact_regex":
+			// Params: pattern, replacement (template, e.g. "XXX-XX-${last4}"),
+			// groups (comma-separated named groups), mask_char
+			proc, err := engine.NewRegexRedactionProcessor(engine.RegexRedactionConfig{
+				Name:        rule.ID,
+				Pattern:     rule.Params["pattern"],
+				Replacement: rule.Params["replacement"],
+				Groups:      splitList(rule.Params["groups"]),
+				MaskChar:    rule.Params["mask_char"],
+			})
+			if err != nil {
+				return nil, fmt.Errorf("redact_regex %s: %w", rule.ID, err)
+			}
+			processors = append(processors, proc)
+		case "pii_redact":
+			// Params: detectors (comma-separated, empty = all), strategy (label|mask|partial),
+			// strategy.<detector> to override one detector
+			cfg := engine.PIIRedactionConfig{
+				Name:       rule.ID,
+				Detectors:  splitList(rule.Params["detectors"]),
+				Strategy:   engine.MaskStrategy(rule.Params["strategy"]),
+				Strategies: make(map[string]engine.MaskStrategy),
+			}
+			for k, v := range rule.Params {
+				if name, ok := strings.CutPrefix(k, "strategy."); ok {
+					cfg.Strategies[name] = engine.MaskStrategy(v)
+				}
+			}
+			proc, err := engine.NewPIIRedactionProcessor(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("pii_redact %s: %w", rule.ID, err)
+			}
+			processors = append(processors, proc)
+		case "pseudonymize":
+			// Params: paths (comma-separated, "/" separated keys), pattern, groups,
+			// key_id, and the key source: key_env (env var name) or key_file (path)
+			key, err := loadKey(rule.Params["key_env"], rule.Params["key_file"])
+			if err != nil {
+				return nil, fmt.Errorf("pseudonymize %s: %w", rule.ID, err)
+			}
+			proc, err := engine.NewPseudonymizeProcessor(engine.PseudonymizeConfig{
+				Name:    rule.ID,
+				Paths:   splitList(rule.Params["paths"]),
+				Pattern: rule.Params["pattern"],
+				Groups:  splitList(rule.Params["groups"]),
+				KeyID:   rule.Params["key_id"],
+				Key:     key,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("pseudonymize %s: %w", rule.ID, err)
+			}
+			processors = append(processors, proc)
+		case "sample":
+			// Params: mode (random|hash), rate (default 1), key (hash mode),
+			// severity_rates ("debug=0.01,info=0.1"), attribute + attribute_rates,
+			// field (annotation, default "sample_rate")
+			proc, err := buildSample(rule)
+			if err != nil {
+				return nil, fmt.Errorf("sample %s: %w", rule.ID, err)
+			}
+			processors = append(processors, proc)
+		case "throttle":
+			// Params: attribute OR path (the key), rate (per second), burst, max_keys,
+			// action (drop|sample|tag), sample_rate, tag_field, window ("1m")
+			proc, err := buildThrottle(rule)
+			if err != nil {
+				return nil, fmt.Errorf("throttle %s: %w", rule.ID, err)
+			}
+			processors = append(processors, proc)
+		case "dedup":
+			// Params: paths (fingerprint only these) OR ignore (volatile fields),
+			// both comma-separated; window ("10s"), max_keys
+			cfg := engine.DedupConfig{
+				Name:   rule.ID,
+				Paths:  splitList(rule.Params["paths"]),
+				Ignore: splitList(rule.Params["ignore"]),
+			}
+			var err error
+			if v := rule.Params["window"]; v != "" {
+				if cfg.Window, err = time.ParseDuration(v); err != nil {
+					return nil, fmt.Errorf("dedup %s: invalid window %q", rule.ID, v)
+				}
+			}
+			if v := rule.Params["max_keys"]; v != "" {
+				if cfg.MaxKeys, err = strconv.Atoi(v); err != nil {
+					return nil, fmt.Errorf("dedup %s: invalid max_keys %q", rule.ID, v)
+				}
+			}
+			proc, err := engine.NewDedupProcessor(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("dedup %s: %w", rule.ID, err)
 			}
 			processors = append(processors, proc)
+		default:
+			// A misspelled type would otherwise run the pipeline without that
+			// stage, which for a redaction stage leaks data.
+			return nil, fmt.Errorf("processor %s: unknown processor type %q", rule.ID, rule.Type)
+		}
+	}
+	return engine.NewProcessorChain(processors...), nil
+}
+
+// buildFilter returns nil if the rule names no words at all.
+func buildFilter(rule ProcessorRule) (*engine.FilterProcessor, error) {
+	value, hasValue := rule.Params["value"]
+	values, hasValues := rule.Params["values"]
+	file, hasFile := rule.Params["values_file"]
+	if !hasValue && !hasValues && !hasFile {
+		return nil, nil
+	}
+
+	var words []string
+	if value != "" {
+		words = append(words, value)
+	}
+	words = append(words, splitList(values)...)
+	if file != "" {
+		fromFile, err := loadValues(file)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, fromFile...)
+	}
+
+	caseInsensitive := false
+	if v := rule.Params["case_insensitive"]; v != "" {
+		var err error
+		if caseInsensitive, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid case_insensitive %q", v)
+		}
+	}
+
+	return engine.NewKeywordFilterProcessor(engine.FilterConfig{
+		Name:            rule.ID,
+		Words:           words,
+		Action:          engine.FilterAction(rule.Params["action"]),
+		CaseInsensitive: caseInsensitive,
+	})
+}
+
+// loadValues reads a list file: one value per line, surrounding whitespace
+// trimmed, blank lines and lines starting with "#" skipped.
+func loadValues(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading values file: %w", err)
+	}
+	var values []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		values = append(values, line)
+	}
+	return values, nil
+}
+
+// loadGrokPatterns reads a grok patterns file in the Logstash layout:
+// "NAME regex" per line, with the same comment rules as loadValues.
+func loadGrokPatterns(file string) (map[string]string, error) {
+	lines, err := loadValues(file)
+	if err != nil {
+		return nil, err
+	}
+	patterns := make(map[string]string, len(lines))
+	for _, line := range lines {
+		name, pattern, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid grok pattern line %q (want NAME regex)", line)
+		}
+		patterns[name] = strings.TrimSpace(pattern)
+	}
+	return patterns, nil
+}
+
+func buildSample(rule ProcessorRule) (*engine.SampleProcessor, error) {
+	cfg := engine.SampleConfig{
+		Name:      rule.ID,
+		Mode:      engine.SampleMode(rule.Params["mode"]),
+		Rate:      1,
+		Key:       rule.Params["key"],
+		Attribute: rule.Params["attribute"],
+		Field:     rule.Params["field"],
+	}
+	var err error
+	if v := rule.Params["rate"]; v != "" {
+		if cfg.Rate, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("invalid rate %q", v)
+		}
+	}
+	if cfg.SeverityRates, err = parseRates(rule.Params["severity_rates"]); err != nil {
+		return nil, fmt.Errorf("severity_rates: %w", err)
+	}
+	if cfg.AttributeRates, err = parseRates(rule.Params["attribute_rates"]); err != nil {
+		return nil, fmt.Errorf("attribute_rates: %w", err)
+	}
+	return engine.NewSampleProcessor(cfg)
+}
+
+func buildThrottle(rule ProcessorRule) (*engine.ThrottleProcessor, error) {
+	cfg := engine.ThrottleConfig{
+		Name:      rule.ID,
+		Attribute: rule.Params["attribute"],
+		Path:      rule.Params["path"],
+		Action:    engine.ThrottleAction(rule.Params["action"]),
+		TagField:  rule.Params["tag_field"],
+	}
+	var err error
+	if cfg.Rate, err = strconv.ParseFloat(rule.Params["rate"], 64); err != nil {
+		return nil, fmt.Errorf("invalid rate %q", rule.Params["rate"])
+	}
+	if v := rule.Params["burst"]; v != "" {
+		if cfg.Burst, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid burst %q", v)
+		}
+	}
+	if v := rule.Params["max_keys"]; v != "" {
+		if cfg.MaxKeys, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid max_keys %q", v)
+		}
+	}
+	if v := rule.Params["sample_rate"]; v != "" {
+		if cfg.SampleRate, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("invalid sample_rate %q", v)
 		}
 	}
+	if v := rule.Params["window"]; v != "" {
+		if cfg.Window, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid window %q", v)
+		}
+	}
+	return engine.NewThrottleProcessor(cfg)
+}
 
-	newChain := engine.NewProcessorChain(processors...)
-	w.pipeline.UpdateChain(newChain)
+// parseRates parses "name=rate" pairs, e.g. "debug=0.01,info=0.1".
+func parseRates(s string) (map[string]float64, error) {
+	items := splitList(s)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	rates := make(map[string]float64, len(items))
+	for _, item := range items {
+		name, val, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected name=rate, got %q", item)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate %q for %s", val, name)
+		}
+		rates[strings.TrimSpace(name)] = rate
+	}
+	return rates, nil
+}
+
+// loadKey reads secret key material referenced by a manifest, so the key
+// itself never has to be published to Redis. Exactly one source must be set.
+// Trailing whitespace (e.g. the newline of a key file) is not part of the key.
+func loadKey(envName, file string) ([]byte, error) {
+	switch {
+	case envName != "" && file != "":
+		return nil, fmt.Errorf("cannot specify both key_env and key_file")
+	case envName != "":
+		val, ok := os.LookupEnv(envName)
+		if !ok {
+			return nil, fmt.Errorf("key env var %s is not set", envName)
+		}
+		return []byte(strings.TrimRight(val, " \t\r\n")), nil
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading key file: %w", err)
+		}
+		return bytes.TrimRight(data, " \t\r\n"), nil
+	default:
+		return nil, fmt.Errorf("either key_env or key_file must be specified")
+	}
+}
+
+// splitList parses a comma-separated param into trimmed, non-empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
+// buildOutputs builds a pipeline's fan-out. An invalid or unknown output is
+// an error, so a typo can't quietly send the pipeline's data nowhere.
+func buildOutputs(targets []OutputTarget) (output.Output, error) {
 	// Build Outputs
 	// Default to Console if none specified
 	var outputs []output.Output
-	if len(cfg.Outputs) == 0 {
+	if len(targets) == 0 {
 		outputs = append(outputs, output.NewConsoleOutput())
 	} else {
-		for _, outCfg := range cfg.Outputs {
+		fail := func(err error) (output.Output, error) {
+			output.NewFanOutOutput(outputs...).Close()
+			return nil, err
+		}
+		for _, outCfg := range targets {
 			switch outCfg.Type {
 			case "console":
 				outputs = append(outputs, output.NewConsoleOutput())
 			case "http":
-				if outCfg.URL != "" {
-					outputs = append(outputs, output.NewHTTPOutput(outCfg.URL, outCfg.Headers))
+				if outCfg.URL == "" {
+					return fail(fmt.Errorf("http output: missing url"))
+				}
+				outputs = append(outputs, output.NewHTTPOutput(outCfg.URL, outCfg.Headers))
+			case "otlp":
+				out, err := buildOTLPOutput(outCfg)
+				if err != nil {
+					return fail(fmt.Errorf("otlp output %s: %w", outCfg.URL, err))
 				}
+				outputs = append(outputs, out)
+			default:
+				return fail(fmt.Errorf("unknown output type %q", outCfg.Type))
 			}
 		}
 	}
+	return output.NewFanOutOutput(outputs...), nil
+}
 
-	// Use FanOut manager to handle multiple outputs
-	w.pipeline.UpdateOutput(output.NewFanOutOutput(outputs...))
-
-	// Update Batch Size
-	// If 0 (omitted), default to 100 inside UpdateBatchSize or handle here.
-	// We'll pass it directly, Pipeline handles < 1.
-	// But let's respect default 100 if missing.
-	bz := int64(cfg.BatchSize)
-	if bz == 0 {
-		bz = 100
+// buildOTLPOutput reads an "otlp" target. URL is the Collector's host:port
+// and Headers become gRPC metadata. Params: insecure, ca_file, cert_file,
+// key_file, server_name, insecure_skip_verify, compression ("gzip" or
+// "none"), timeout, max_elapsed, max_batch.
+func buildOTLPOutput(target OutputTarget) (*output.OTLPOutput, error) {
+	params := target.Params
+	cfg := output.OTLPConfig{
+		Endpoint:    target.URL,
+		CAFile:      params["ca_file"],
+		CertFile:    params["cert_file"],
+		KeyFile:     params["key_file"],
+		ServerName:  params["server_name"],
+		Headers:     target.Headers,
+		Compression: params["compression"],
+	}
+	var err error
+	if v := params["insecure"]; v != "" {
+		if cfg.Insecure, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid insecure %q", v)
+		}
+	}
+	if v := params["insecure_skip_verify"]; v != "" {
+		if cfg.InsecureSkipVerify, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid insecure_skip_verify %q", v)
+		}
+	}
+	if v := params["timeout"]; v != "" {
+		if cfg.Timeout, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid timeout %q", v)
+		}
+	}
+	if v := params["max_elapsed"]; v != "" {
+		if cfg.MaxElapsed, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid max_elapsed %q", v)
+		}
+	}
+	if v := params["max_batch"]; v != "" {
+		if cfg.MaxBatch, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid max_batch %q", v)
+		}
 	}
-	w.pipeline.UpdateBatchSize(bz)
+	return output.NewOTLPOutput(cfg)
 }
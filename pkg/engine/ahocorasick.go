@@ -0,0 +1,135 @@
+package engine
+
+// ahoCorasick is a multi-pattern substring matcher compiled to a DFA.
+// Matching is a single pass over the input with one table lookup per byte,
+// so the cost is independent of the number of patterns.
+//
+// To keep the table small, bytes are first mapped to equivalence classes:
+// every byte that appears in some pattern gets its own class, and all other
+// bytes share class 0. A blocklist of 10k ASCII words typically needs fewer
+// than 64 classes instead of 256.
+type ahoCorasick struct {
+	classes [256]uint8 // byte -> class
+	stride  int        // number of classes (row width of delta)
+
+	// delta[row+class] is the next state's row offset (state*stride), with
+	// acMatchBit set if that state is a match. Storing offsets and the flag
+	// in one word keeps the scan loop to a single load per byte.
+	delta []uint32
+}
+
+const acMatchBit = 1 << 31
+
+// newAhoCorasick compiles the patterns. Empty patterns are ignored.
+// With fold, ASCII letters match regardless of case.
+func newAhoCorasick(patterns [][]byte, fold bool) *ahoCorasick {
+	a := &ahoCorasick{}
+
+	norm := func(c byte) byte {
+		if fold && c >= 'A' && c <= 'Z' {
+			return c + ('a' - 'A')
+		}
+		return c
+	}
+
+	// Byte classes. Class 0 is every byte no pattern uses.
+	nclass := 1
+	for _, p := range patterns {
+		for _, c := range p {
+			c = norm(c)
+			if a.classes[c] == 0 {
+				if nclass == 256 {
+					break // every byte value already has a class
+				}
+				a.classes[c] = uint8(nclass)
+				nclass++
+			}
+		}
+	}
+	if fold {
+		for c := 'A'; c <= 'Z'; c++ {
+			a.classes[c] = a.classes[c+('a'-'A')]
+		}
+	}
+	a.stride = nclass
+
+	// Trie. Unset transitions are noState until the BFS below fills them in.
+	const noState = ^uint32(0)
+	var match []bool // state ends (or has a suffix that is) a pattern
+	addState := func() uint32 {
+		for i := 0; i < a.stride; i++ {
+			a.delta = append(a.delta, noState)
+		}
+		match = append(match, false)
+		return uint32(len(match) - 1)
+	}
+	addState() // root
+
+	for _, p := range patterns {
+		if len(p) == 0 {
+			continue
+		}
+		s := uint32(0)
+		for _, c := range p {
+			i := int(s)*a.stride + int(a.classes[norm(c)])
+			if a.delta[i] == noState {
+				next := addState()
+				a.delta[i] = next
+			}
+			s = a.delta[i]
+		}
+		match[s] = true
+	}
+
+	// Failure links, folded straight into the transition table (BFS order, so
+	// a state's fail target is always complete before the state itself).
+	fail := make([]uint32, len(match))
+	queue := make([]uint32, 0, len(match))
+	for c := 0; c < a.stride; c++ {
+		if next := a.delta[c]; next == noState {
+			a.delta[c] = 0
+		} else {
+			fail[next] = 0
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		row := int(s) * a.stride
+		frow := int(fail[s]) * a.stride
+		for c := 0; c < a.stride; c++ {
+			next := a.delta[row+c]
+			if next == noState {
+				a.delta[row+c] = a.delta[frow+c]
+				continue
+			}
+			fail[next] = a.delta[frow+c]
+			match[next] = match[next] || match[fail[next]]
+			queue = append(queue, next)
+		}
+	}
+
+	// Switch from state numbers to row offsets + match flag.
+	for i, next := range a.delta {
+		off := next * uint32(a.stride)
+		if match[next] {
+			off |= acMatchBit
+		}
+		a.delta[i] = off
+	}
+	return a
+}
+
+// contains reports whether any pattern occurs in b.
+func (a *ahoCorasick) contains(b []byte) bool {
+	row := uint32(0)
+	for _, c := range b {
+		next := a.delta[row+uint32(a.classes[c])]
+		if next&acMatchBit != 0 {
+			return true
+		}
+		row = next
+	}
+	return false
+}
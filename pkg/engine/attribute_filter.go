@@ -3,6 +3,7 @@ package engine
 import (
 	"fmt"
 	"regexp"
+	"streamgate/pkg/model"
 	"strings"
 
 	"github.com/tidwall/gjson"
@@ -89,11 +90,14 @@ var genericSearchPaths = []string{
 // Supports both well-known OTel attributes (auto-search) and explicit paths.
 type AttributeFilterProcessor struct {
 	name     string
-	attr     string // well-known attribute name (auto-search mode)
-	path     string // explicit gjson path (explicit mode)
+	lookup   attrLookup // attribute (auto-search) or explicit path, resolved at build time
 	operator Operator
 	value    string
 	regex    *regexp.Regexp // compiled regex if operator is OpRegex
+	expr     exprNode       // compiled condition (expression mode)
+
+	keep      bool // allow list: drop entries that don't match
+	onMissing MissingPolicy
 }
 
 // AttributeFilterConfig holds configuration for creating an AttributeFilterProcessor
@@ -103,11 +107,50 @@ type AttributeFilterConfig struct {
 	Path      string // use this for explicit gjson path
 	Operator  Operator
 	Value     string
+
+	// Expression is a boolean condition over any number of attributes, e.g.
+	// `level = debug AND service in (a, b) AND NOT http.status_code >= 500`.
+	// See expr.go for the syntax. It replaces Attribute/Path/Operator/Value.
+	Expression string
+
+	// Action is what happens to matching entries; defaults to ActionDrop.
+	Action FilterAction
+
+	// OnMissing applies to entries without the attribute, and to non-JSON
+	// entries; defaults to MissingKeep (fail-open). Expressions handle missing
+	// attributes themselves (a comparison on one is false, and "exists" tests
+	// for it), so for them OnMissing only applies to non-JSON entries.
+	OnMissing MissingPolicy
 }
 
 // NewAttributeFilterProcessor creates a new attribute filter processor.
-// Either Attribute or Path must be specified, not both.
+// Exactly one of Attribute, Path or Expression must be specified.
 func NewAttributeFilterProcessor(cfg AttributeFilterConfig) (*AttributeFilterProcessor, error) {
+	action, err := parseFilterAction(cfg.Action)
+	if err != nil {
+		return nil, err
+	}
+	onMissing, err := parseMissingPolicy(cfg.OnMissing)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Expression != "" {
+		if cfg.Attribute != "" || cfg.Path != "" || cfg.Operator != "" || cfg.Value != "" {
+			return nil, fmt.Errorf("cannot combine expression with attribute, path, operator or value")
+		}
+		expr, err := compileExpr(cfg.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return &AttributeFilterProcessor{
+			name:      cfg.Name,
+			expr:      expr,
+			keep:      action == ActionKeep,
+			onMissing: onMissing,
+		}, nil
+	}
+
 	if cfg.Attribute == "" && cfg.Path == "" {
 		return nil, fmt.Errorf("either attribute or path must be specified")
 	}
@@ -116,11 +159,16 @@ func NewAttributeFilterProcessor(cfg AttributeFilterConfig) (*AttributeFilterPro
 	}
 
 	p := &AttributeFilterProcessor{
-		name:     cfg.Name,
-		attr:     cfg.Attribute,
-		path:     cfg.Path,
-		operator: cfg.Operator,
-		value:    cfg.Value,
+		name:      cfg.Name,
+		lookup:    newAttrLookup(cfg.Attribute),
+		operator:  cfg.Operator,
+		value:     cfg.Value,
+		keep:      action == ActionKeep,
+		onMissing: onMissing,
+	}
+
+	if cfg.Path != "" {
+		p.lookup = newPathLookup(cfg.Path)
 	}
 
 	// Pre-compile regex if needed
@@ -145,62 +193,130 @@ func (p *AttributeFilterProcessor) Name() string {
 }
 
 // Process checks if the log entry matches the filter criteria.
-// Returns (entry, drop=true, nil) if the attribute matches and log should be dropped.
+// With ActionDrop it returns drop=true for matching entries, with ActionKeep
+// for entries that don't match. Entries that can't be evaluated follow OnMissing.
 func (p *AttributeFilterProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
-	// Fail-open: if entry is not valid JSON, pass through
-	if !gjson.ValidBytes(entry) {
-		return entry, false, nil
+	return processRaw(p, ctx, entry)
+}
+
+// ProcessEntry is Process on the shared envelope.
+func (p *AttributeFilterProcessor) ProcessEntry(ctx *ProcessingContext, e *model.LogEntry) (bool, error) {
+	matched, ok := p.evaluate(e)
+	if !ok {
+		return p.onMissing == MissingDrop, nil
 	}
+	return matched != p.keep, nil
+}
 
-	var value gjson.Result
+// matches reports whether the entry's attribute satisfies the operator.
+// Non-JSON entries and entries without the attribute never match.
+func (p *AttributeFilterProcessor) matches(e *model.LogEntry) bool {
+	matched, ok := p.evaluate(e)
+	return ok && matched
+}
 
-	if p.path != "" {
-		// Explicit path mode - convert user path (using /) to gjson path
-		gjsonPath := convertToGjsonPath(p.path)
-		value = gjson.GetBytes(entry, gjsonPath)
-	} else {
-		// Auto-search mode - try well-known paths first, then generic
-		value = p.searchAttribute(entry)
+// evaluate tests the entry against the condition. ok is false if the entry
+// isn't JSON or doesn't carry the attribute. A source attribute condition
+// applies to plain-text entries too.
+func (p *AttributeFilterProcessor) evaluate(e *model.LogEntry) (matched, ok bool) {
+	if !e.IsJSON() && (p.expr != nil || p.lookup.source == nil) {
+		return false, false
 	}
 
-	// Attribute not found - pass through (fail-open)
+	if p.expr != nil {
+		return p.expr.eval(e), true
+	}
+
+	value := p.lookup.get(e)
+
+	// Attribute not found - caller applies OnMissing
 	if !value.Exists() {
-		return entry, false, nil
+		return false, false
 	}
 
 	// Check if value matches based on operator
-	matched := p.matchValue(value)
+	return p.matchValue(value), true
+}
 
-	return entry, matched, nil
+// sourceAttributes are read from where an entry came from (its envelope)
+// rather than from its body, e.g. `@source.identity = billing-agent` matches
+// entries sent with that verified TLS client certificate. The "@" keeps them
+// apart from body fields: "source.identity" still means the log's own field,
+// and gjson paths can't start with "@" anyway.
+var sourceAttributes = map[string]func(model.Source) string{
+	"@source.listener": func(s model.Source) string { return s.Listener },
+	"@source.addr":     func(s model.Source) string { return s.Addr },
+	"@source.identity": func(s model.Source) string { return s.Identity },
 }
 
-// searchAttribute looks for the attribute in well-known OTel paths,
-// falling back to generic search paths.
-func (p *AttributeFilterProcessor) searchAttribute(entry []byte) gjson.Result {
-	// First, try well-known paths for this attribute
-	if paths, ok := otelSearchPaths[p.attr]; ok {
-		for _, path := range paths {
-			result := gjson.GetBytes(entry, path)
-			if result.Exists() {
-				return result
-			}
-		}
+// attrLookup is the ordered list of gjson paths an attribute may live at.
+// Building it once per processor keeps path formatting off the hot path,
+// and resolving through LogEntry.Get shares each lookup across the chain.
+type attrLookup struct {
+	paths  []string
+	source func(model.Source) string // set for sourceAttributes instead of paths
+}
+
+// newAttrLookup searches well-known OTel paths for attr first, then the
+// generic locations. It is shared by every component that addresses logs by
+// attribute (filters, shard keys, ...), so they all agree on where one lives.
+func newAttrLookup(attr string) attrLookup {
+	if source, ok := sourceAttributes[attr]; ok {
+		return attrLookup{source: source}
 	}
 
-	// Fall back to generic search paths
+	var paths []string
+	paths = append(paths, otelSearchPaths[attr]...)
+
 	// Escape dots in attribute name for gjson
-	escapedAttr := strings.ReplaceAll(p.attr, ".", "\\.")
+	escapedAttr := strings.ReplaceAll(attr, ".", "\\.")
 	for _, pathTemplate := range genericSearchPaths {
-		path := fmt.Sprintf(pathTemplate, escapedAttr)
-		result := gjson.GetBytes(entry, path)
-		if result.Exists() {
+		paths = append(paths, fmt.Sprintf(pathTemplate, escapedAttr))
+	}
+	return attrLookup{paths: paths}
+}
+
+// newPathLookup resolves an explicit user path (using /).
+func newPathLookup(userPath string) attrLookup {
+	return attrLookup{paths: []string{convertToGjsonPath(userPath)}}
+}
+
+// get returns the first path that exists in the entry.
+func (l attrLookup) get(e *model.LogEntry) gjson.Result {
+	if l.source != nil {
+		return l.sourceValue(e.Source)
+	}
+	for _, path := range l.paths {
+		if result := e.Get(path); result.Exists() {
 			return result
 		}
 	}
-
 	return gjson.Result{} // not found
 }
 
+// sourceValue resolves a source attribute; an empty one is not found.
+func (l attrLookup) sourceValue(src model.Source) gjson.Result {
+	v := l.source(src)
+	if v == "" {
+		return gjson.Result{}
+	}
+	return gjson.Result{Type: gjson.String, Str: v, Raw: string(appendJSONString(nil, v))}
+}
+
+// getBytes is get for callers that have the raw bytes rather than an
+// envelope.
+func (l attrLookup) getBytes(entry []byte, src model.Source) gjson.Result {
+	if l.source != nil {
+		return l.sourceValue(src)
+	}
+	for _, path := range l.paths {
+		if result := gjson.GetBytes(entry, path); result.Exists() {
+			return result
+		}
+	}
+	return gjson.Result{}
+}
+
 // matchValue checks if the gjson result matches based on the operator
 func (p *AttributeFilterProcessor) matchValue(value gjson.Result) bool {
 	strValue := value.String()
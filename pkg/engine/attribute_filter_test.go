@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"streamgate/pkg/model"
 	"testing"
 )
 
@@ -431,3 +432,128 @@ func TestConvertToGjsonPath(t *testing.T) {
 		})
 	}
 }
+
+func TestAttributeFilter_KeepActionAndOnMissing(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    FilterAction
+		onMissing MissingPolicy
+		input     string
+		wantDrop  bool
+	}{
+		{"keep - approved event", ActionKeep, "", `{"event.type": "login"}`, false},
+		{"keep - other event dropped", ActionKeep, "", `{"event.type": "pageview"}`, true},
+		{"keep - missing fails open by default", ActionKeep, "", `{"message": "hi"}`, false},
+		{"keep - missing fails closed", ActionKeep, MissingDrop, `{"message": "hi"}`, true},
+		{"keep - non-JSON fails closed", ActionKeep, MissingDrop, `plain text`, true},
+		{"drop - missing fails closed", ActionDrop, MissingDrop, `{"message": "hi"}`, true},
+		{"drop - missing kept explicitly", ActionDrop, MissingKeep, `{"message": "hi"}`, false},
+		{"drop - match", ActionDrop, MissingDrop, `{"event.type": "login"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc, err := NewAttributeFilterProcessor(AttributeFilterConfig{
+				Name:      "test",
+				Attribute: "event.type",
+				Value:     "login",
+				Action:    tt.action,
+				OnMissing: tt.onMissing,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			_, drop, _ := proc.Process(nil, []byte(tt.input))
+			if drop != tt.wantDrop {
+				t.Errorf("Process() drop = %v, want %v", drop, tt.wantDrop)
+			}
+		})
+	}
+}
+
+func TestAttributeFilter_KeepActionExpression(t *testing.T) {
+	proc, err := NewAttributeFilterProcessor(AttributeFilterConfig{
+		Name:       "test",
+		Expression: `event.type in (login, logout, password_change)`,
+		Action:     ActionKeep,
+		OnMissing:  MissingDrop,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	for input, wantDrop := range map[string]bool{
+		`{"event.type": "logout"}`:   false,
+		`{"event.type": "pageview"}`: true,
+		`{"message": "hi"}`:          true, // comparison on a missing attribute is false
+		`not json`:                   true, // on_missing
+	} {
+		if _, drop, _ := proc.Process(nil, []byte(input)); drop != wantDrop {
+			t.Errorf("Process(%s) drop = %v, want %v", input, drop, wantDrop)
+		}
+	}
+}
+
+func TestAttributeFilter_SourceAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      AttributeFilterConfig
+		input    string
+		src      model.Source
+		wantDrop bool
+	}{
+		{
+			"identity match",
+			AttributeFilterConfig{Attribute: "@source.identity", Value: "billing-agent"},
+			`{"msg": "hi"}`, model.Source{Identity: "billing-agent"}, true,
+		},
+		{
+			"identity on plain text",
+			AttributeFilterConfig{Attribute: "@source.identity", Operator: OpRegex, Value: "^billing-"},
+			`plain text`, model.Source{Identity: "billing-agent"}, true,
+		},
+		{
+			"no identity is missing",
+			AttributeFilterConfig{Attribute: "@source.identity", Value: "billing-agent", OnMissing: MissingKeep},
+			`{"msg": "hi"}`, model.Source{Listener: "tcp"}, false,
+		},
+		{
+			"body field of the same name is ignored",
+			AttributeFilterConfig{Attribute: "@source.listener", Value: "tcp"},
+			`{"source.listener": "tcp"}`, model.Source{Listener: "udp"}, false,
+		},
+		{
+			"without @ the body field is read",
+			AttributeFilterConfig{Attribute: "source.listener", Value: "tcp"},
+			`{"source.listener": "tcp"}`, model.Source{Listener: "udp"}, true,
+		},
+		{
+			"expression",
+			AttributeFilterConfig{Expression: `@source.listener = tcp and @source.identity != billing-agent`},
+			`{"msg": "hi"}`, model.Source{Listener: "tcp", Identity: "web"}, true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Name = "test"
+			proc, err := NewAttributeFilterProcessor(tt.cfg)
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			drop, _ := proc.ProcessEntry(nil, model.NewLogEntry([]byte(tt.input), tt.src))
+			if drop != tt.wantDrop {
+				t.Errorf("ProcessEntry() drop = %v, want %v", drop, tt.wantDrop)
+			}
+		})
+	}
+}
+
+func TestAttributeFilter_InvalidActionConfig(t *testing.T) {
+	for _, cfg := range []AttributeFilterConfig{
+		{Attribute: "a", Value: "b", Action: "allow"},
+		{Attribute: "a", Value: "b", OnMissing: "ignore"},
+	} {
+		if _, err := NewAttributeFilterProcessor(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
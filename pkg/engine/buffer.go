@@ -2,25 +2,60 @@ package engine
 
 import (
 	"errors"
+	"streamgate/pkg/model"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var (
 	ErrBufferFull = errors.New("buffer is full")
 )
 
+// cacheLinePad keeps the producer and consumer cursors on separate cache lines
+// so that Push and Pop running on different cores don't false-share.
+type cacheLinePad [64]byte
+
+// slot is a single cell of the ring.
+// seq tells producers and consumers whose turn it is to touch the cell:
+//   - seq == pos      -> empty, the producer claiming pos may write it
+//   - seq == pos + 1  -> full, the consumer claiming pos may read it
+type slot struct {
+	seq  atomic.Uint64
+	data []byte
+	src  model.Source
+}
+
 // RingBuffer is a fixed-size circular buffer for byte slices.
-// It is safe for a single writer (Ingestor) and single reader (Processor).
-// For multiple writers, we would need a mutex or a channel-based approach.
+// It is safe for multiple writers (one goroutine per TCP connection, UDP, ...)
+// and multiple readers. The implementation is a bounded lock-free MPMC queue
+// (Vyukov style): producers and consumers claim positions with a CAS on their
+// own cursor and hand slots over through the per-slot sequence number.
 type RingBuffer struct {
-	data [][]byte
-	head uint64
-	tail uint64
-	mask uint64
-	size uint64
+	slots []slot
+	mask  uint64
+	size  uint64
+
+	_    cacheLinePad
+	head atomic.Uint64 // next position to write (producers)
+	_    cacheLinePad
+	tail atomic.Uint64 // next position to read (consumers)
+	_    cacheLinePad
 
 	// Metrics
-	dropped uint64
+	dropped atomic.Uint64
+
+	// Consumer wakeups (see PopWait).
+	// Producers only touch wakeMu when a consumer is actually parked, so a busy
+	// buffer pays a single atomic load per Push and no syscalls.
+	waiters atomic.Int32
+	wakeMu  sync.Mutex
+	wakeCh  chan struct{} // closed and replaced to broadcast "items available"
+
+	// Producer wakeups (see PushWaitFrom), the mirror image: consumers only
+	// touch wakeMu when a producer is parked on a full buffer.
+	pushWaiters atomic.Int32
+	spaceCh     chan struct{} // closed and replaced to broadcast "slots free"
 }
 
 // NewRingBuffer creates a ring buffer with the specified size (must be power of 2).
@@ -28,55 +63,259 @@ func NewRingBuffer(size uint64) (*RingBuffer, error) {
 	if size == 0 || (size&(size-1)) != 0 {
 		return nil, errors.New("size must be a power of 2")
 	}
-	return &RingBuffer{
-		data: make([][]byte, size),
-		mask: size - 1,
-		size: size,
-	}, nil
+	rb := &RingBuffer{
+		slots:   make([]slot, size),
+		mask:    size - 1,
+		size:    size,
+		wakeCh:  make(chan struct{}),
+		spaceCh: make(chan struct{}),
+	}
+	for i := range rb.slots {
+		rb.slots[i].seq.Store(uint64(i))
+	}
+	return rb, nil
 }
 
 // Push adds an item to the buffer.
 // If the buffer is full, it drops the item and returns ErrBufferFull.
+// Safe to call from any number of goroutines.
 func (rb *RingBuffer) Push(item []byte) error {
-	head := atomic.LoadUint64(&rb.head)
-	tail := atomic.LoadUint64(&rb.tail)
+	return rb.PushFrom(item, model.Source{})
+}
 
-	if head-tail >= rb.size {
-		atomic.AddUint64(&rb.dropped, 1)
+// PushFrom is Push with the item's origin attached, for routing and sharding.
+func (rb *RingBuffer) PushFrom(item []byte, src model.Source) error {
+	if !rb.push(item, src) {
+		rb.dropped.Add(1)
 		return ErrBufferFull
 	}
+	return nil
+}
+
+// PushWaitFrom is like PushFrom, but blocks while the buffer is full instead
+// of dropping. It returns ErrBufferFull once done is closed (nil waits
+// forever); the item is not counted as dropped, that is up to the caller.
+//
+// Registration mirrors PopWait: producers register before re-checking for
+// space, and consumers check for parked producers after freeing a slot.
+func (rb *RingBuffer) PushWaitFrom(item []byte, src model.Source, done <-chan struct{}) error {
+	for {
+		if rb.push(item, src) {
+			return nil
+		}
+
+		rb.pushWaiters.Add(1)
+		rb.wakeMu.Lock()
+		ready := rb.spaceCh
+		rb.wakeMu.Unlock()
+
+		if rb.push(item, src) {
+			rb.pushWaiters.Add(-1)
+			return nil
+		}
+
+		select {
+		case <-ready:
+			rb.pushWaiters.Add(-1)
+		case <-done:
+			rb.pushWaiters.Add(-1)
+			return ErrBufferFull
+		}
+	}
+}
+
+// PushAllFrom adds items as one batch: either all of them go in, in order,
+// or none do and it returns ErrBufferFull. A rejected batch isn't counted as
+// dropped, since a caller that pushes back has the sender retry it.
+func (rb *RingBuffer) PushAllFrom(items [][]byte, src model.Source) error {
+	n := uint64(len(items))
+	if n == 0 {
+		return nil
+	}
+	if n > rb.size {
+		return ErrBufferFull
+	}
+	pos := rb.head.Load()
+retry:
+	for {
+		// Every slot of the batch must be free for this lap. Free slots only
+		// change hands through head, so they stay free if the CAS succeeds.
+		for i := uint64(0); i < n; i++ {
+			diff := int64(rb.slots[(pos+i)&rb.mask].seq.Load()) - int64(pos+i)
+			switch {
+			case diff < 0:
+				return ErrBufferFull
+			case diff > 0:
+				// Another producer claimed pos before us. Catch up.
+				pos = rb.head.Load()
+				continue retry
+			}
+		}
+		if rb.head.CompareAndSwap(pos, pos+n) {
+			break
+		}
+		pos = rb.head.Load()
+	}
 
-	rb.data[head&rb.mask] = item
-	atomic.StoreUint64(&rb.head, head+1)
+	for i, item := range items {
+		s := &rb.slots[(pos+uint64(i))&rb.mask]
+		s.data = item
+		s.src = src
+		s.seq.Store(pos + uint64(i) + 1) // publish to consumers
+	}
+	if rb.waiters.Load() > 0 {
+		rb.wake()
+	}
 	return nil
 }
 
+// push claims a slot for item. It reports false if the buffer is full.
+func (rb *RingBuffer) push(item []byte, src model.Source) bool {
+	pos := rb.head.Load()
+	for {
+		s := &rb.slots[pos&rb.mask]
+		seq := s.seq.Load()
+		diff := int64(seq) - int64(pos)
+
+		switch {
+		case diff == 0:
+			// Slot is free for this lap. Try to claim it.
+			if rb.head.CompareAndSwap(pos, pos+1) {
+				s.data = item
+				s.src = src
+				s.seq.Store(pos + 1) // publish to consumers
+				if rb.waiters.Load() > 0 {
+					rb.wake()
+				}
+				return true
+			}
+			pos = rb.head.Load()
+		case diff < 0:
+			// Slot still holds an item from the previous lap: buffer is full.
+			return false
+		default:
+			// Another producer claimed pos before us. Catch up.
+			pos = rb.head.Load()
+		}
+	}
+}
+
 // Pop removes an item from the buffer.
-// Returns nil if empty.
+// Returns nil if empty. Safe to call from any number of goroutines.
 func (rb *RingBuffer) Pop() []byte {
-	tail := rb.tail
-	head := atomic.LoadUint64(&rb.head)
+	item, _ := rb.PopFrom()
+	return item
+}
 
-	if tail == head {
-		return nil
-	}
+// PopFrom is Pop that also returns the item's origin.
+func (rb *RingBuffer) PopFrom() ([]byte, model.Source) {
+	pos := rb.tail.Load()
+	for {
+		s := &rb.slots[pos&rb.mask]
+		seq := s.seq.Load()
+		diff := int64(seq) - int64(pos+1)
 
-	item := rb.data[tail&rb.mask]
-	// Help GC? In our zero-alloc design, we might want to recycle this buffer back to a pool later.
-	// rb.data[tail&rb.mask] = nil
+		switch {
+		case diff == 0:
+			// Slot has been published for this lap. Try to claim it.
+			if rb.tail.CompareAndSwap(pos, pos+1) {
+				item, src := s.data, s.src
+				s.data = nil // let GC reclaim the entry once the pipeline is done with it
+				s.src = model.Source{}
+				s.seq.Store(pos + rb.size) // hand the slot back to producers for the next lap
+				if rb.pushWaiters.Load() > 0 {
+					rb.wakeProducers()
+				}
+				return item, src
+			}
+			pos = rb.tail.Load()
+		case diff < 0:
+			// Nothing published at pos yet: buffer is empty (or the producer is mid-write).
+			return nil, model.Source{}
+		default:
+			// Another consumer took pos before us. Catch up.
+			pos = rb.tail.Load()
+		}
+	}
+}
 
-	atomic.StoreUint64(&rb.tail, tail+1)
+// PopWait is like Pop, but blocks until an item is available instead of
+// returning nil straight away. It returns nil once done is closed or timeout
+// fires (either may be nil to wait forever).
+//
+// Consumers register as waiters before re-checking the buffer, and producers
+// check for waiters after publishing, so a Push racing with a consumer going
+// to sleep is never missed.
+func (rb *RingBuffer) PopWait(done <-chan struct{}, timeout <-chan time.Time) []byte {
+	item, _ := rb.PopWaitFrom(done, timeout)
 	return item
 }
 
+// PopWaitFrom is PopWait that also returns the item's origin.
+func (rb *RingBuffer) PopWaitFrom(done <-chan struct{}, timeout <-chan time.Time) ([]byte, model.Source) {
+	for {
+		if item, src := rb.PopFrom(); item != nil {
+			return item, src
+		}
+
+		rb.waiters.Add(1)
+		rb.wakeMu.Lock()
+		ready := rb.wakeCh
+		rb.wakeMu.Unlock()
+
+		// Re-check after registering: a producer that published before it could
+		// see us will not wake us, but its item is visible now.
+		if item, src := rb.PopFrom(); item != nil {
+			rb.waiters.Add(-1)
+			return item, src
+		}
+
+		select {
+		case <-ready:
+			rb.waiters.Add(-1)
+		case <-done:
+			rb.waiters.Add(-1)
+			return nil, model.Source{}
+		case <-timeout:
+			rb.waiters.Add(-1)
+			return nil, model.Source{}
+		}
+	}
+}
+
+// wake releases every consumer parked in PopWait.
+func (rb *RingBuffer) wake() {
+	rb.wakeMu.Lock()
+	close(rb.wakeCh)
+	rb.wakeCh = make(chan struct{})
+	rb.wakeMu.Unlock()
+}
+
+// wakeProducers releases every producer parked in PushWaitFrom.
+func (rb *RingBuffer) wakeProducers() {
+	rb.wakeMu.Lock()
+	close(rb.spaceCh)
+	rb.spaceCh = make(chan struct{})
+	rb.wakeMu.Unlock()
+}
+
 // DroppedCount returns the number of dropped events.
 func (rb *RingBuffer) DroppedCount() uint64 {
-	return atomic.LoadUint64(&rb.dropped)
+	return rb.dropped.Load()
 }
 
 // Usage returns the number of items currently in the buffer.
+// Under concurrent access this is a snapshot and may include items that are
+// still being written by a producer.
 func (rb *RingBuffer) Usage() uint64 {
-	return atomic.LoadUint64(&rb.head) - atomic.LoadUint64(&rb.tail)
+	// Load tail first: tail never passes head, so reading it before head
+	// guarantees head >= tail and the subtraction can't wrap.
+	tail := rb.tail.Load()
+	head := rb.head.Load()
+	if head-tail > rb.size {
+		return rb.size
+	}
+	return head - tail
 }
 
 // Capacity returns the total size of the buffer.
@@ -2,7 +2,14 @@ package engine
 
 import (
 	"bytes"
+	"encoding/binary"
+	"runtime"
+	"streamgate/pkg/model"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestRingBuffer_NormalOperation(t *testing.T) {
@@ -61,3 +68,438 @@ func TestRingBuffer_FullDrop(t *testing.T) {
 		t.Error("Order corrupted")
 	}
 }
+
+// encodeItem packs a producer ID and a per-producer sequence number into 8 bytes.
+func encodeItem(producer, seq uint32) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b[0:4], producer)
+	binary.BigEndian.PutUint32(b[4:8], seq)
+	return b
+}
+
+func decodeItem(b []byte) (uint32, uint32) {
+	return binary.BigEndian.Uint32(b[0:4]), binary.BigEndian.Uint32(b[4:8])
+}
+
+// TestRingBuffer_MultiProducerStress hammers the buffer from many producers and
+// consumers at once. Every accepted item must be popped exactly once, and
+// accepted + dropped must equal the number of pushes.
+// Run with -race to also check the memory ordering.
+func TestRingBuffer_MultiProducerStress(t *testing.T) {
+	const (
+		producers   = 8
+		consumers   = 4
+		perProducer = 20000
+	)
+
+	rb, _ := NewRingBuffer(1024)
+
+	var accepted atomic.Uint64
+	var producing sync.WaitGroup
+	producing.Add(producers)
+	for p := 0; p < producers; p++ {
+		go func(id uint32) {
+			defer producing.Done()
+			for i := uint32(0); i < perProducer; i++ {
+				if rb.Push(encodeItem(id, i)) == nil {
+					accepted.Add(1)
+				}
+			}
+		}(uint32(p))
+	}
+
+	done := make(chan struct{})
+	results := make([][][]byte, consumers)
+	var consuming sync.WaitGroup
+	consuming.Add(consumers)
+	for c := 0; c < consumers; c++ {
+		go func(idx int) {
+			defer consuming.Done()
+			for {
+				item := rb.Pop()
+				if item != nil {
+					results[idx] = append(results[idx], item)
+					continue
+				}
+				select {
+				case <-done:
+					// Producers are finished; drain whatever is left.
+					for item = rb.Pop(); item != nil; item = rb.Pop() {
+						results[idx] = append(results[idx], item)
+					}
+					return
+				default:
+					runtime.Gosched()
+				}
+			}
+		}(c)
+	}
+
+	producing.Wait()
+	close(done)
+	consuming.Wait()
+
+	total := uint64(producers * perProducer)
+	if got := accepted.Load() + rb.DroppedCount(); got != total {
+		t.Fatalf("accepted(%d) + dropped(%d) = %d, want %d", accepted.Load(), rb.DroppedCount(), got, total)
+	}
+
+	seen := make(map[uint64]bool, total)
+	for _, items := range results {
+		for _, item := range items {
+			p, s := decodeItem(item)
+			key := uint64(p)<<32 | uint64(s)
+			if seen[key] {
+				t.Fatalf("item producer=%d seq=%d popped twice", p, s)
+			}
+			seen[key] = true
+		}
+	}
+	if uint64(len(seen)) != accepted.Load() {
+		t.Fatalf("popped %d unique items, want %d (lost entries)", len(seen), accepted.Load())
+	}
+	if usage := rb.Usage(); usage != 0 {
+		t.Errorf("Expected empty buffer after drain, usage=%d", usage)
+	}
+}
+
+// TestRingBuffer_MultiProducerOrdering checks that with a single consumer,
+// items from each producer come out in the order that producer pushed them.
+func TestRingBuffer_MultiProducerOrdering(t *testing.T) {
+	const (
+		producers   = 6
+		perProducer = 10000
+	)
+
+	// Large enough to hold everything, so nothing is dropped.
+	rb, _ := NewRingBuffer(1 << 16)
+
+	var wg sync.WaitGroup
+	wg.Add(producers)
+	for p := 0; p < producers; p++ {
+		go func(id uint32) {
+			defer wg.Done()
+			for i := uint32(0); i < perProducer; i++ {
+				if err := rb.Push(encodeItem(id, i)); err != nil {
+					t.Errorf("unexpected push error: %v", err)
+					return
+				}
+			}
+		}(uint32(p))
+	}
+	wg.Wait()
+
+	next := make([]uint32, producers)
+	count := 0
+	for item := rb.Pop(); item != nil; item = rb.Pop() {
+		p, s := decodeItem(item)
+		if s != next[p] {
+			t.Fatalf("producer %d: got seq %d, want %d", p, s, next[p])
+		}
+		next[p]++
+		count++
+	}
+	if count != producers*perProducer {
+		t.Fatalf("popped %d items, want %d", count, producers*perProducer)
+	}
+}
+
+// TestRingBuffer_WrapAround exercises many laps over a tiny ring with
+// concurrent producers and a consumer to catch sequence handoff bugs.
+func TestRingBuffer_WrapAround(t *testing.T) {
+	rb, _ := NewRingBuffer(2)
+
+	const pushes = 50000
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for p := 0; p < 2; p++ {
+		go func(id uint32) {
+			defer wg.Done()
+			for i := uint32(0); i < pushes; {
+				if rb.Push(encodeItem(id, i)) == nil {
+					i++
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}(uint32(p))
+	}
+
+	next := make([]uint32, 2)
+	for got := 0; got < 2*pushes; {
+		item := rb.Pop()
+		if item == nil {
+			runtime.Gosched()
+			continue
+		}
+		p, s := decodeItem(item)
+		if s != next[p] {
+			t.Fatalf("producer %d: got seq %d, want %d", p, s, next[p])
+		}
+		next[p]++
+		got++
+	}
+	wg.Wait()
+}
+
+func TestRingBuffer_PopWaitWakesOnPush(t *testing.T) {
+	rb, _ := NewRingBuffer(4)
+
+	got := make(chan []byte)
+	go func() {
+		got <- rb.PopWait(nil, nil) // blocks until the push below
+	}()
+
+	// Give the consumer time to park.
+	time.Sleep(20 * time.Millisecond)
+	_ = rb.Push([]byte("wake"))
+
+	select {
+	case item := <-got:
+		if string(item) != "wake" {
+			t.Errorf("Expected 'wake', got %q", item)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("PopWait was not woken by Push")
+	}
+}
+
+func TestRingBuffer_PopWaitDoneAndTimeout(t *testing.T) {
+	rb, _ := NewRingBuffer(4)
+
+	// Timeout fires on an empty buffer.
+	if item := rb.PopWait(nil, time.After(10*time.Millisecond)); item != nil {
+		t.Errorf("Expected nil on timeout, got %q", item)
+	}
+
+	// Closed done returns immediately.
+	done := make(chan struct{})
+	close(done)
+	if item := rb.PopWait(done, nil); item != nil {
+		t.Errorf("Expected nil on done, got %q", item)
+	}
+
+	// Items already present are returned even if done is closed.
+	_ = rb.Push([]byte("ready"))
+	if item := rb.PopWait(done, nil); string(item) != "ready" {
+		t.Errorf("Expected 'ready', got %q", item)
+	}
+
+	if n := rb.waiters.Load(); n != 0 {
+		t.Errorf("Expected no registered waiters, got %d", n)
+	}
+}
+
+// TestRingBuffer_PopWaitNoLostWakeups has producers push in small bursts with
+// gaps while consumers park in PopWait. A lost wakeup shows up as a timeout.
+func TestRingBuffer_PopWaitNoLostWakeups(t *testing.T) {
+	const (
+		producers   = 4
+		consumers   = 3
+		perProducer = 5000
+	)
+	rb, _ := NewRingBuffer(1 << 16)
+
+	var received atomic.Int64
+	done := make(chan struct{})
+	var consuming sync.WaitGroup
+	consuming.Add(consumers)
+	for c := 0; c < consumers; c++ {
+		go func() {
+			defer consuming.Done()
+			for rb.PopWait(done, nil) != nil {
+				received.Add(1)
+			}
+		}()
+	}
+
+	var producing sync.WaitGroup
+	producing.Add(producers)
+	for p := 0; p < producers; p++ {
+		go func(id uint32) {
+			defer producing.Done()
+			for i := uint32(0); i < perProducer; i++ {
+				_ = rb.Push(encodeItem(id, i))
+				if i%64 == 0 {
+					time.Sleep(50 * time.Microsecond) // let consumers go idle
+				}
+			}
+		}(uint32(p))
+	}
+	producing.Wait()
+
+	deadline := time.After(5 * time.Second)
+	for received.Load() < producers*perProducer {
+		select {
+		case <-deadline:
+			t.Fatalf("received %d of %d items: consumer missed a wakeup", received.Load(), producers*perProducer)
+		default:
+			time.Sleep(time.Millisecond)
+		}
+	}
+	close(done)
+	consuming.Wait()
+}
+
+func BenchmarkRingBuffer_PushPopParallel(b *testing.B) {
+	rb, _ := NewRingBuffer(1 << 16)
+	item := []byte("benchmark log line")
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = rb.Push(item)
+			_ = rb.Pop()
+		}
+	})
+}
+
+func TestRingBuffer_PushWaitWakesOnPop(t *testing.T) {
+	rb, _ := NewRingBuffer(2)
+	_ = rb.Push([]byte("first"))
+	_ = rb.Push([]byte("filler"))
+
+	pushed := make(chan error)
+	go func() {
+		pushed <- rb.PushWaitFrom([]byte("second"), model.Source{}, nil) // blocks until the pop below
+	}()
+
+	// Give the producer time to park.
+	time.Sleep(20 * time.Millisecond)
+	if item := rb.Pop(); string(item) != "first" {
+		t.Fatalf("Expected 'first', got %q", item)
+	}
+
+	select {
+	case err := <-pushed:
+		if err != nil {
+			t.Fatalf("PushWaitFrom: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("PushWaitFrom was not woken by Pop")
+	}
+	if got := [][]byte{rb.Pop(), rb.Pop()}; string(got[0]) != "filler" || string(got[1]) != "second" {
+		t.Errorf("Expected 'filler', 'second', got %q", got)
+	}
+
+	// A closed done gives up on a full buffer without counting a drop.
+	_ = rb.Push([]byte("third"))
+	_ = rb.Push([]byte("filler"))
+	done := make(chan struct{})
+	close(done)
+	if err := rb.PushWaitFrom([]byte("fourth"), model.Source{}, done); err != ErrBufferFull {
+		t.Errorf("Expected ErrBufferFull on done, got %v", err)
+	}
+	if n := rb.DroppedCount(); n != 0 {
+		t.Errorf("Expected no drops, got %d", n)
+	}
+	if n := rb.pushWaiters.Load(); n != 0 {
+		t.Errorf("Expected no registered producers, got %d", n)
+	}
+}
+
+func TestRingBuffer_PushAllFrom(t *testing.T) {
+	rb, _ := NewRingBuffer(4)
+	src := model.Source{Listener: "http"}
+	batch := func(items ...string) [][]byte {
+		b := make([][]byte, len(items))
+		for i, s := range items {
+			b[i] = []byte(s)
+		}
+		return b
+	}
+
+	if err := rb.PushAllFrom(batch("a", "b", "c"), src); err != nil {
+		t.Fatalf("PushAllFrom: %v", err)
+	}
+	// Only one slot left: none of the batch goes in.
+	if err := rb.PushAllFrom(batch("d", "e"), src); err != ErrBufferFull {
+		t.Fatalf("err = %v, want ErrBufferFull", err)
+	}
+	if rb.Usage() != 3 || rb.DroppedCount() != 0 {
+		t.Fatalf("usage = %d, dropped = %d, want 3 and 0", rb.Usage(), rb.DroppedCount())
+	}
+	if err := rb.PushAllFrom(batch("a", "b", "c", "d", "e"), src); err != ErrBufferFull {
+		t.Fatalf("larger than capacity: err = %v, want ErrBufferFull", err)
+	}
+
+	// Wraps around the end of the ring.
+	rb.Pop()
+	rb.Pop()
+	if err := rb.PushAllFrom(batch("d", "e", "f"), src); err != nil {
+		t.Fatalf("PushAllFrom: %v", err)
+	}
+	var got []string
+	for item, from := rb.PopFrom(); item != nil; item, from = rb.PopFrom() {
+		got = append(got, string(item))
+		if from != src {
+			t.Errorf("source = %+v, want %+v", from, src)
+		}
+	}
+	if want := "c d e f"; strings.Join(got, " ") != want {
+		t.Errorf("popped %q, want %s", got, want)
+	}
+}
+
+// TestRingBuffer_PushAllFromConcurrent mixes batch pushes from several
+// producers with a consumer. Each accepted batch must come out whole and
+// contiguous, and rejected ones not at all.
+func TestRingBuffer_PushAllFromConcurrent(t *testing.T) {
+	const (
+		producers = 4
+		batches   = 2000
+		batchLen  = 3
+	)
+	rb, _ := NewRingBuffer(64)
+
+	var accepted atomic.Uint64
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p uint32) {
+			defer wg.Done()
+			for b := uint32(0); b < batches; b++ {
+				items := make([][]byte, batchLen)
+				for i := range items {
+					items[i] = encodeItem(p, b*batchLen+uint32(i))
+				}
+				if rb.PushAllFrom(items, model.Source{}) == nil {
+					accepted.Add(1)
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}(uint32(p))
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var popped uint64
+	var prevProducer, prevSeq uint32
+	for {
+		item := rb.Pop()
+		if item == nil {
+			select {
+			case <-done:
+				if item = rb.Pop(); item == nil {
+					if want := accepted.Load() * batchLen; popped != want {
+						t.Fatalf("popped %d items, want %d", popped, want)
+					}
+					return
+				}
+			default:
+				runtime.Gosched()
+				continue
+			}
+		}
+		p, seq := decodeItem(item)
+		if seq%batchLen != 0 && (p != prevProducer || seq != prevSeq+1) {
+			t.Fatalf("item %d/%d follows %d/%d: batch split", p, seq, prevProducer, prevSeq)
+		}
+		prevProducer, prevSeq = p, seq
+		popped++
+	}
+}
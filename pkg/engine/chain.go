@@ -1,6 +1,17 @@
 package engine
 
+import (
+	"fmt"
+	"log"
+	"sort"
+	"streamgate/pkg/model"
+	"strings"
+	"time"
+)
+
 // ProcessorChain manages a sequential list of processors.
+// Each processor is either an EntryProcessor, or a plain Processor that the
+// chain adapts.
 type ProcessorChain struct {
 	processors []Processor
 }
@@ -15,18 +26,65 @@ func NewProcessorChain(processors ...Processor) *ProcessorChain {
 // Process runs the entry through all processors in the chain.
 // It stops if a processor returns drop=true or an error.
 func (c *ProcessorChain) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
-	var drop bool
-	var err error
+	e := model.LogEntry{Raw: entry}
+	drop, err := c.ProcessEntry(ctx, &e)
+	return e.Raw, drop, err
+}
 
+// ProcessEntry runs the envelope through all processors in the chain.
+// It stops if a processor returns drop=true or an error.
+func (c *ProcessorChain) ProcessEntry(ctx *ProcessingContext, e *model.LogEntry) (bool, error) {
 	for _, p := range c.processors {
-		entry, drop, err = p.Process(ctx, entry)
+		var drop bool
+		var err error
+		if ep, ok := p.(EntryProcessor); ok {
+			drop, err = ep.ProcessEntry(ctx, e)
+		} else {
+			// Legacy processor: it may have edited the bytes in place, so the
+			// cached parse can't be trusted afterwards either way.
+			var out []byte
+			out, drop, err = p.Process(ctx, e.Raw)
+			e.SetRaw(out)
+		}
 		if err != nil {
-			return entry, false, err
+			return false, err
 		}
 		if drop {
-			return entry, true, nil
+			return true, nil
 		}
 	}
+	return false, nil
+}
 
-	return entry, false, nil
+// LogHits logs the non-zero counts of every processor that implements
+// HitCounter, e.g. "Processor pii: hits email=3 ssn=1".
+func (c *ProcessorChain) LogHits() {
+	for _, p := range c.processors {
+		hc, ok := p.(HitCounter)
+		if !ok {
+			continue
+		}
+		var counts []string
+		for name, n := range hc.Hits() {
+			if n > 0 {
+				counts = append(counts, fmt.Sprintf("%s=%d", name, n))
+			}
+		}
+		if len(counts) == 0 {
+			continue
+		}
+		sort.Strings(counts)
+		log.Printf("Processor %s: hits %s", p.Name(), strings.Join(counts, " "))
+	}
+}
+
+// Flush collects pending entries from every processor that implements Flusher.
+func (c *ProcessorChain) Flush(now time.Time, final bool) [][]byte {
+	var out [][]byte
+	for _, p := range c.processors {
+		if f, ok := p.(Flusher); ok {
+			out = append(out, f.Flush(now, final)...)
+		}
+	}
+	return out
 }
@@ -0,0 +1,244 @@
+package engine
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"streamgate/pkg/model"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	defaultDedupWindow  = 10 * time.Second
+	defaultDedupMaxKeys = 10000
+)
+
+// defaultDedupIgnore lists volatile fields left out of whole-payload
+// fingerprints when no Ignore list is configured: without this, two copies of
+// the same line would almost never compare equal.
+var defaultDedupIgnore = []string{
+	"timestamp", "@timestamp", "time", "ts",
+	"timeUnixNano", "observedTimeUnixNano", "observedTimestamp",
+}
+
+// DedupConfig holds configuration for creating a DedupProcessor.
+type DedupConfig struct {
+	Name string
+
+	// Paths, if set, are the only fields fingerprinted ("/" separated, as in
+	// AttributeFilterConfig). Otherwise the whole payload is, minus Ignore.
+	Paths []string
+
+	// Ignore lists fields left out of whole-payload fingerprints. A bare key
+	// ("ts") is ignored at any depth, a "/" path only at that path.
+	// Defaults to common timestamp fields.
+	Ignore []string
+
+	Window  time.Duration // how long repeats are collapsed, from the first occurrence
+	MaxKeys int           // fingerprints tracked at once; the oldest is flushed early
+}
+
+// DedupProcessor collapses repeated entries.
+// The first occurrence of an entry passes through untouched. Repeats within
+// Window are dropped and counted, and when the window closes a summary is
+// emitted: the first occurrence annotated with repeat_count, first_seen and
+// last_seen (JSON), or suffixed with "(repeated N times, ...)" (plain text).
+type DedupProcessor struct {
+	name    string
+	paths   []string        // gjson paths
+	ignore  map[string]bool // bare keys and "/" paths
+	window  time.Duration
+	maxKeys int
+
+	now func() time.Time // overridable for tests
+
+	mu      sync.Mutex
+	seen    map[uint64]*list.Element // of *dedupGroup
+	order   *list.List               // by first occurrence, oldest first
+	pending [][]byte                 // summaries of groups evicted early
+}
+
+type dedupGroup struct {
+	fingerprint uint64
+	entry       []byte
+	firstSeen   time.Time
+	lastSeen    time.Time
+	repeats     uint64
+}
+
+// NewDedupProcessor validates the config.
+func NewDedupProcessor(cfg DedupConfig) (*DedupProcessor, error) {
+	if cfg.Window < 0 || cfg.MaxKeys < 0 {
+		return nil, fmt.Errorf("window and max keys must not be negative")
+	}
+	if len(cfg.Paths) > 0 && len(cfg.Ignore) > 0 {
+		return nil, fmt.Errorf("cannot specify both paths and ignore")
+	}
+
+	p := &DedupProcessor{
+		name:    cfg.Name,
+		window:  cfg.Window,
+		maxKeys: cfg.MaxKeys,
+		now:     time.Now,
+		seen:    make(map[uint64]*list.Element),
+		order:   list.New(),
+	}
+	for _, path := range cfg.Paths {
+		p.paths = append(p.paths, convertToGjsonPath(path))
+	}
+	ignore := cfg.Ignore
+	if len(ignore) == 0 {
+		ignore = defaultDedupIgnore
+	}
+	p.ignore = make(map[string]bool, len(ignore))
+	for _, path := range ignore {
+		p.ignore[path] = true
+	}
+	if p.window == 0 {
+		p.window = defaultDedupWindow
+	}
+	if p.maxKeys == 0 {
+		p.maxKeys = defaultDedupMaxKeys
+	}
+
+	return p, nil
+}
+
+func (p *DedupProcessor) Name() string {
+	return p.name
+}
+
+func (p *DedupProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
+	return processRaw(p, ctx, entry)
+}
+
+// ProcessEntry is Process on the shared envelope.
+func (p *DedupProcessor) ProcessEntry(ctx *ProcessingContext, e *model.LogEntry) (bool, error) {
+	fp := p.fingerprint(e)
+	now := p.now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if elem, ok := p.seen[fp]; ok {
+		g := elem.Value.(*dedupGroup)
+		if now.Sub(g.firstSeen) < p.window {
+			g.repeats++
+			g.lastSeen = now
+			return true, nil
+		}
+		// Window over but not flushed yet: close it and start a new one.
+		p.closeGroup(elem)
+	}
+
+	if p.order.Len() >= p.maxKeys {
+		p.closeGroup(p.order.Front())
+	}
+	g := &dedupGroup{
+		fingerprint: fp,
+		entry:       append([]byte(nil), e.Raw...), // later processors may reuse entry
+		firstSeen:   now,
+		lastSeen:    now,
+	}
+	p.seen[fp] = p.order.PushBack(g)
+
+	return false, nil
+}
+
+// closeGroup forgets a group, queueing its summary if it saw repeats.
+// Caller holds p.mu.
+func (p *DedupProcessor) closeGroup(elem *list.Element) {
+	g := p.order.Remove(elem).(*dedupGroup)
+	delete(p.seen, g.fingerprint)
+	if g.repeats > 0 {
+		p.pending = append(p.pending, g.summary())
+	}
+}
+
+// Flush emits summaries for every group whose window has closed.
+func (p *DedupProcessor) Flush(now time.Time, final bool) [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Groups are ordered by first occurrence, so expired ones are at the front.
+	for elem := p.order.Front(); elem != nil; elem = p.order.Front() {
+		if !final && now.Sub(elem.Value.(*dedupGroup).firstSeen) < p.window {
+			break
+		}
+		p.closeGroup(elem)
+	}
+
+	out := p.pending
+	p.pending = nil
+	return out
+}
+
+// summary renders the collapsed form of a group.
+func (g *dedupGroup) summary() []byte {
+	count := strconv.FormatUint(g.repeats, 10)
+	first := g.firstSeen.UTC().Format(time.RFC3339Nano)
+	last := g.lastSeen.UTC().Format(time.RFC3339Nano)
+
+	if out, ok := setTopLevelField(g.entry, "repeat_count", []byte(count)); ok {
+		out, _ = setTopLevelField(out, "first_seen", []byte(strconv.Quote(first)))
+		out, _ = setTopLevelField(out, "last_seen", []byte(strconv.Quote(last)))
+		return out
+	}
+
+	out := make([]byte, 0, len(g.entry)+96)
+	out = append(out, g.entry...)
+	out = append(out, " (repeated "...)
+	out = append(out, count...)
+	if g.repeats == 1 {
+		out = append(out, " time, first_seen="...)
+	} else {
+		out = append(out, " times, first_seen="...)
+	}
+	out = append(out, first...)
+	out = append(out, ", last_seen="...)
+	out = append(out, last...)
+	return append(out, ')')
+}
+
+// fingerprint hashes the fields that make two entries "the same".
+func (p *DedupProcessor) fingerprint(e *model.LogEntry) uint64 {
+	if !e.IsJSON() {
+		return hashBytes(e.Raw)
+	}
+
+	h := uint64(fnvOffset64)
+	if len(p.paths) > 0 {
+		for _, path := range p.paths {
+			h = fnvAddString(h, e.Get(path).Raw)
+			h = fnvAddByte(h, 0) // separator, so ("ab","c") != ("a","bc")
+		}
+		return h
+	}
+	return p.hashValue(h, gjson.ParseBytes(e.Raw), "")
+}
+
+// hashValue folds a JSON value into h, skipping ignored object members.
+// prefix is the "/" path of value.
+func (p *DedupProcessor) hashValue(h uint64, value gjson.Result, prefix string) uint64 {
+	if !value.IsObject() {
+		return fnvAddString(h, value.Raw)
+	}
+	value.ForEach(func(key, member gjson.Result) bool {
+		name := key.String()
+		path := name
+		if prefix != "" {
+			path = prefix + "/" + name
+		}
+		if p.ignore[name] || p.ignore[path] {
+			return true
+		}
+		h = fnvAddString(h, key.Raw)
+		h = p.hashValue(h, member, path)
+		h = fnvAddByte(h, 0)
+		return true
+	})
+	return h
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"streamgate/pkg/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+func newDedup(t *testing.T, cfg DedupConfig) (*DedupProcessor, *fakeClock) {
+	t.Helper()
+	proc, err := NewDedupProcessor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	proc.now = clock.now
+	return proc, clock
+}
+
+func TestDedup_CollapsesRepeats(t *testing.T) {
+	proc, clock := newDedup(t, DedupConfig{Name: "dedup", Window: 10 * time.Second})
+
+	kept := 0
+	for i := 0; i < 100; i++ {
+		entry := []byte(`{"timestamp":"` + clock.now().Format(time.RFC3339Nano) + `","level":"ERROR","msg":"connection refused"}`)
+		if _, drop, _ := proc.Process(nil, entry); !drop {
+			kept++
+		}
+		clock.advance(50 * time.Millisecond)
+	}
+	if kept != 1 {
+		t.Fatalf("Kept %d entries, want only the first", kept)
+	}
+
+	if lines := proc.Flush(clock.now(), false); lines != nil {
+		t.Fatalf("Summary emitted before the window closed: %q", lines)
+	}
+
+	clock.advance(10 * time.Second)
+	lines := proc.Flush(clock.now(), false)
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 summary, got %d", len(lines))
+	}
+	summary := gjson.ParseBytes(lines[0])
+	if got := summary.Get("repeat_count").Int(); got != 99 {
+		t.Errorf("repeat_count = %d, want 99", got)
+	}
+	if got := summary.Get("msg").String(); got != "connection refused" {
+		t.Errorf("msg = %q, want the original message", got)
+	}
+	first, _ := time.Parse(time.RFC3339Nano, summary.Get("first_seen").String())
+	last, _ := time.Parse(time.RFC3339Nano, summary.Get("last_seen").String())
+	if d := last.Sub(first); d != 99*50*time.Millisecond {
+		t.Errorf("last_seen - first_seen = %v, want %v", d, 99*50*time.Millisecond)
+	}
+
+	// A new window lets the entry through again.
+	if _, drop, _ := proc.Process(nil, []byte(`{"level":"ERROR","msg":"connection refused"}`)); drop {
+		t.Errorf("First entry of a new window was dropped")
+	}
+}
+
+func TestDedup_NoRepeatsNoSummary(t *testing.T) {
+	proc, clock := newDedup(t, DedupConfig{Name: "dedup", Window: time.Second})
+	proc.Process(nil, []byte("unique line"))
+	clock.advance(time.Second)
+	if lines := proc.Flush(clock.now(), false); lines != nil {
+		t.Errorf("Expected no summary for a single entry, got %q", lines)
+	}
+}
+
+func TestDedup_Fingerprint(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  DedupConfig
+		a, b string
+		same bool
+	}{
+		{"default ignores timestamp", DedupConfig{}, `{"ts":1,"msg":"x"}`, `{"ts":2,"msg":"x"}`, true},
+		{"bare key ignored at depth", DedupConfig{}, `{"log":{"time":1,"msg":"x"}}`, `{"log":{"time":2,"msg":"x"}}`, true},
+		{"different message", DedupConfig{}, `{"ts":1,"msg":"x"}`, `{"ts":1,"msg":"y"}`, false},
+		{"custom ignore", DedupConfig{Ignore: []string{"req/id"}}, `{"req":{"id":1},"msg":"x"}`, `{"req":{"id":2},"msg":"x"}`, true},
+		{"custom ignore replaces defaults", DedupConfig{Ignore: []string{"req/id"}}, `{"ts":1}`, `{"ts":2}`, false},
+		{"paths only", DedupConfig{Paths: []string{"error/type", "service"}}, `{"service":"a","error":{"type":"E"},"msg":"1"}`, `{"service":"a","error":{"type":"E"},"msg":"2"}`, true},
+		{"paths differ", DedupConfig{Paths: []string{"service"}}, `{"service":"a"}`, `{"service":"b"}`, false},
+		{"plain text", DedupConfig{}, "disk full", "disk full", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc, _ := newDedup(t, tt.cfg)
+			same := proc.fingerprint(model.NewLogEntry([]byte(tt.a), model.Source{})) ==
+				proc.fingerprint(model.NewLogEntry([]byte(tt.b), model.Source{}))
+			if same != tt.same {
+				t.Errorf("fingerprint(%s) == fingerprint(%s) is %v, want %v", tt.a, tt.b, same, tt.same)
+			}
+		})
+	}
+}
+
+func TestDedup_PlainTextSummary(t *testing.T) {
+	proc, clock := newDedup(t, DedupConfig{Name: "dedup", Window: time.Second})
+	for i := 0; i < 3; i++ {
+		proc.Process(nil, []byte("disk full"))
+	}
+	lines := proc.Flush(clock.now(), true)
+	if len(lines) != 1 || !strings.HasPrefix(string(lines[0]), "disk full (repeated 2 times, first_seen=") {
+		t.Errorf("Flush() = %q, want a 'repeated 2 times' summary", lines)
+	}
+}
+
+func TestDedup_MaxKeysEvictsOldest(t *testing.T) {
+	proc, _ := newDedup(t, DedupConfig{Name: "dedup", MaxKeys: 2})
+	for _, line := range []string{"a", "a", "b", "c"} {
+		proc.Process(nil, []byte(line))
+	}
+	if proc.order.Len() != 2 {
+		t.Fatalf("Tracking %d fingerprints, want 2", proc.order.Len())
+	}
+	// "a" was evicted early; its summary is handed out on the next flush.
+	lines := proc.Flush(time.Time{}, false)
+	if len(lines) != 1 || !strings.HasPrefix(string(lines[0]), "a (repeated 1 time,") {
+		t.Errorf("Flush() = %q, want the evicted summary for a", lines)
+	}
+}
+
+func TestDedup_InvalidConfig(t *testing.T) {
+	bad := []DedupConfig{
+		{Window: -time.Second},
+		{MaxKeys: -1},
+		{Paths: []string{"msg"}, Ignore: []string{"ts"}},
+	}
+	for _, cfg := range bad {
+		if _, err := NewDedupProcessor(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
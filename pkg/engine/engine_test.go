@@ -36,3 +36,56 @@ func BenchmarkPipeline_WithRedaction(b *testing.B) {
 		_, _, _ = chain.Process(ctx, data)
 	}
 }
+
+func TestChain_LegacyProcessorInvalidatesCache(t *testing.T) {
+	newLevelFilter := func(name string) Processor {
+		p, err := NewAttributeFilterProcessor(AttributeFilterConfig{Name: name, Attribute: "level", Value: "error"})
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		return p
+	}
+	// The first filter caches level=debug; the redaction (a plain Processor)
+	// rewrites it, and the second filter must see the new value.
+	chain := NewProcessorChain(
+		newLevelFilter("before"),
+		NewRedactionProcessor("rewrite", "debug", "error"),
+		newLevelFilter("after"),
+	)
+
+	ctx := &ProcessingContext{Context: context.Background()}
+	out, drop, err := chain.Process(ctx, []byte(`{"level":"debug"}`))
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if !drop {
+		t.Errorf("Process() drop = false, want true (entry %s)", out)
+	}
+}
+
+func BenchmarkChain_AttributeFilters(b *testing.B) {
+	// Ten filters over the same entry: the envelope validates it once and
+	// shares attribute lookups, instead of re-parsing per processor.
+	var processors []Processor
+	for _, attr := range []string{
+		"service.name", "log.level", "http.status_code", "http.method", "deployment.environment",
+		"service.name", "log.level", "http.target", "region", "tenant",
+	} {
+		p, err := NewAttributeFilterProcessor(AttributeFilterConfig{Attribute: attr, Value: "nomatch"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		processors = append(processors, p)
+	}
+	chain := NewProcessorChain(processors...)
+
+	ctx := &ProcessingContext{Context: context.Background()}
+	data := []byte(`{"timestamp":"2024-01-01T00:00:00Z","level":"INFO","message":"request served",` +
+		`"resource":{"attributes":{"service.name":"checkout","deployment.environment":"prod"}},` +
+		`"attributes":{"http.method":"GET","http.status_code":200,"http.target":"/cart"},"region":"eu","tenant":"acme"}`)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _, _ = chain.Process(ctx, data)
+	}
+}
@@ -0,0 +1,544 @@
+package engine
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"streamgate/pkg/model"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Condition expressions, as used by AttributeFilterConfig.Expression:
+//
+//	level = debug AND service in (a, b) AND NOT http.status_code >= 500
+//
+// Grammar (keywords are case-insensitive):
+//
+//	expr       = and { ("or" | "||") and }
+//	and        = unary { ("and" | "&&") unary }
+//	unary      = ("not" | "!") unary | "(" expr ")" | comparison
+//	comparison = field "exists"
+//	           | field ("=" | "==" | "!=" | ">" | ">=" | "<" | "<=") value
+//	           | field ("eq_i" | "ne_i" | "contains" | "contains_i" | "starts_with" | "starts_with_i"
+//	                   | "ends_with" | "ends_with_i" | "matches") value
+//	           | field ("in" | "not_in" | "in_i" | "not_in_i") list
+//	           | field "cidr" (value | list)
+//	list       = "(" value { "," value } ")"
+//
+// A field containing "/" is an explicit path; anything else is an attribute
+// resolved like AttributeFilterProcessor does (well-known OTel paths first).
+// Values are bare words or quoted strings ('...' or "..."). A comparison on a
+// missing attribute is false.
+
+// ExprError is a syntax error in a condition expression.
+type ExprError struct {
+	Pos int // byte offset into the expression
+	Msg string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("invalid expression at column %d: %s", e.Pos+1, e.Msg)
+}
+
+// exprNode is one node of a compiled expression.
+type exprNode interface {
+	eval(e *model.LogEntry) bool
+}
+
+// compileExpr parses an expression into an evaluable tree.
+func compileExpr(src string) (exprNode, error) {
+	p := &exprParser{lex: exprLexer{src: src}}
+	p.next()
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return node, nil
+}
+
+// --- Lexer ---
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokIllegal
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// is reports whether t is the given keyword (case-insensitive) or symbol.
+func (t token) is(words ...string) bool {
+	if t.kind != tokWord && t.kind != tokOp {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.text, w) {
+			return true
+		}
+	}
+	return false
+}
+
+type exprLexer struct {
+	src string
+	pos int
+}
+
+// isWordByte covers attribute names, paths, numbers, IPs and CIDRs.
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '/' || c == '@' || c == ':' || c == '-' || c == '*' || c == '+'
+}
+
+func (l *exprLexer) next() token {
+	for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t' || l.src[l.pos] == '\n' || l.src[l.pos] == '\r') {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '(':
+		l.pos++
+		return token{kind: tokLParen, text: "(", pos: start}
+	case c == ')':
+		l.pos++
+		return token{kind: tokRParen, text: ")", pos: start}
+	case c == ',':
+		l.pos++
+		return token{kind: tokComma, text: ",", pos: start}
+	case c == '"' || c == '\'':
+		return l.quoted(c)
+	case strings.HasPrefix(l.src[l.pos:], "&&"), strings.HasPrefix(l.src[l.pos:], "||"),
+		strings.HasPrefix(l.src[l.pos:], "=="), strings.HasPrefix(l.src[l.pos:], "!="),
+		strings.HasPrefix(l.src[l.pos:], ">="), strings.HasPrefix(l.src[l.pos:], "<="):
+		l.pos += 2
+		return token{kind: tokOp, text: l.src[start:l.pos], pos: start}
+	case c == '=' || c == '>' || c == '<' || c == '!':
+		l.pos++
+		return token{kind: tokOp, text: l.src[start:l.pos], pos: start}
+	case isWordByte(c):
+		for l.pos < len(l.src) && isWordByte(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokWord, text: l.src[start:l.pos], pos: start}
+	default:
+		l.pos++
+		return token{kind: tokIllegal, text: l.src[start:l.pos], pos: start}
+	}
+}
+
+// quoted scans a string literal. Backslash escapes the next character.
+func (l *exprLexer) quoted(quote byte) token {
+	start := l.pos
+	l.pos++ // opening quote
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\\' && l.pos+1 < len(l.src):
+			b.WriteByte(l.src[l.pos+1])
+			l.pos += 2
+		case c == quote:
+			l.pos++
+			return token{kind: tokString, text: b.String(), pos: start}
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{kind: tokIllegal, text: "unterminated string", pos: start}
+}
+
+// --- Parser ---
+
+type exprParser struct {
+	lex exprLexer
+	tok token
+}
+
+func (p *exprParser) next() {
+	p.tok = p.lex.next()
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	if p.tok.kind == tokIllegal && p.tok.text == "unterminated string" {
+		return &ExprError{Pos: p.tok.pos, Msg: "unterminated string"}
+	}
+	return &ExprError{Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.is("or", "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.is("and", "&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	switch {
+	case p.tok.is("not", "!"):
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	case p.tok.kind == tokLParen:
+		open := p.tok
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected \")\" to close \"(\" at column %d, got %s", open.pos+1, p.tok)
+		}
+		p.next()
+		return x, nil
+	default:
+		return p.parseComparison()
+	}
+}
+
+// comparison operators that take a single value.
+var exprValueOps = map[string]bool{
+	"=": true, "==": true, "!=": true, ">": true, ">=": true, "<": true, "<=": true,
+	"eq_i": true, "ne_i": true, "contains": true, "contains_i": true,
+	"starts_with": true, "starts_with_i": true, "ends_with": true, "ends_with_i": true,
+	"matches": true,
+}
+
+// comparison operators that take a list.
+var exprListOps = map[string]bool{"in": true, "not_in": true, "in_i": true, "not_in_i": true}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	if p.tok.kind != tokWord && p.tok.kind != tokString {
+		return nil, p.errorf("expected attribute name, got %s", p.tok)
+	}
+	if p.tok.kind == tokWord && isExprKeyword(p.tok.text) {
+		return nil, p.errorf("expected attribute name, got keyword %s", p.tok)
+	}
+	field := newExprField(p.tok.text)
+	p.next()
+
+	opTok := p.tok
+	op := strings.ToLower(opTok.text)
+	if opTok.kind != tokWord && opTok.kind != tokOp {
+		return nil, p.errorf("expected operator after %q, got %s", field.name, opTok)
+	}
+	p.next()
+
+	switch {
+	case op == "exists":
+		return existsNode{field}, nil
+
+	case op == "cidr":
+		vals, err := p.parseValueOrList(op)
+		if err != nil {
+			return nil, err
+		}
+		n := &cidrNode{field: field}
+		for _, v := range vals {
+			prefix, err := parseSourcePrefix(v.text)
+			if err != nil {
+				return nil, &ExprError{Pos: v.pos, Msg: err.Error()}
+			}
+			n.prefixes = append(n.prefixes, prefix)
+		}
+		return n, nil
+
+	case exprListOps[op]:
+		if p.tok.kind != tokLParen {
+			return nil, p.errorf("expected \"(\" to start the %s list, got %s", op, p.tok)
+		}
+		vals, err := p.parseValueOrList(op)
+		if err != nil {
+			return nil, err
+		}
+		fold := strings.HasSuffix(op, "_i")
+		n := &inNode{field: field, negate: strings.HasPrefix(op, "not_"), fold: fold, set: make(map[string]bool, len(vals))}
+		for _, v := range vals {
+			if fold {
+				n.set[strings.ToLower(v.text)] = true
+			} else {
+				n.set[v.text] = true
+			}
+		}
+		return n, nil
+
+	case exprValueOps[op]:
+		if p.tok.kind != tokWord && p.tok.kind != tokString {
+			return nil, p.errorf("expected value after %q, got %s", opTok.text, p.tok)
+		}
+		val := p.tok
+		p.next()
+		return newCmpNode(field, op, val)
+
+	default:
+		return nil, &ExprError{Pos: opTok.pos, Msg: fmt.Sprintf("unknown operator %s", opTok)}
+	}
+}
+
+// parseValueOrList reads a single value or a parenthesised, comma-separated list.
+func (p *exprParser) parseValueOrList(op string) ([]token, error) {
+	if p.tok.kind == tokWord || p.tok.kind == tokString {
+		v := p.tok
+		p.next()
+		return []token{v}, nil
+	}
+	if p.tok.kind != tokLParen {
+		return nil, p.errorf("expected value or list after %q, got %s", op, p.tok)
+	}
+	p.next()
+
+	var vals []token
+	for {
+		if p.tok.kind != tokWord && p.tok.kind != tokString {
+			return nil, p.errorf("expected list value, got %s", p.tok)
+		}
+		vals = append(vals, p.tok)
+		p.next()
+		if p.tok.kind == tokRParen {
+			p.next()
+			return vals, nil
+		}
+		if p.tok.kind != tokComma {
+			return nil, p.errorf("expected \",\" or \")\" in list, got %s", p.tok)
+		}
+		p.next()
+	}
+}
+
+func isExprKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not":
+		return true
+	}
+	return false
+}
+
+// --- Nodes ---
+
+type andNode struct{ l, r exprNode }
+type orNode struct{ l, r exprNode }
+type notNode struct{ x exprNode }
+
+func (n andNode) eval(e *model.LogEntry) bool { return n.l.eval(e) && n.r.eval(e) }
+func (n orNode) eval(e *model.LogEntry) bool  { return n.l.eval(e) || n.r.eval(e) }
+func (n notNode) eval(e *model.LogEntry) bool { return !n.x.eval(e) }
+
+// exprField resolves an attribute name or explicit path against an entry.
+type exprField struct {
+	name   string
+	lookup attrLookup
+}
+
+func newExprField(name string) exprField {
+	if strings.Contains(name, "/") {
+		return exprField{name: name, lookup: newPathLookup(name)}
+	}
+	return exprField{name: name, lookup: newAttrLookup(name)}
+}
+
+type existsNode struct{ field exprField }
+
+func (n existsNode) eval(e *model.LogEntry) bool { return n.field.lookup.get(e).Exists() }
+
+type cmpNode struct {
+	field exprField
+	op    string
+	str   string // folded to lower case for *_i operators
+	num   float64
+	isNum bool
+	re    *regexp.Regexp
+}
+
+func newCmpNode(field exprField, op string, val token) (exprNode, error) {
+	n := &cmpNode{field: field, op: op, str: val.text}
+	if num, err := strconv.ParseFloat(val.text, 64); err == nil && val.kind == tokWord {
+		n.num, n.isNum = num, true
+	}
+
+	switch op {
+	case ">", ">=", "<", "<=":
+		if !n.isNum {
+			return nil, &ExprError{Pos: val.pos, Msg: fmt.Sprintf("%q needs a number, got %s", op, val)}
+		}
+	case "matches":
+		re, err := regexp.Compile(val.text)
+		if err != nil {
+			return nil, &ExprError{Pos: val.pos, Msg: fmt.Sprintf("invalid regex: %v", err)}
+		}
+		n.re = re
+	case "eq_i", "ne_i", "contains_i", "starts_with_i", "ends_with_i":
+		n.str = strings.ToLower(n.str)
+	}
+	return n, nil
+}
+
+func (n *cmpNode) eval(e *model.LogEntry) bool {
+	value := n.field.lookup.get(e)
+	if !value.Exists() {
+		return false
+	}
+
+	switch n.op {
+	case "=", "==":
+		return n.equal(value)
+	case "!=":
+		return !n.equal(value)
+	case ">", ">=", "<", "<=":
+		num, ok := numericValue(value)
+		if !ok {
+			return false
+		}
+		switch n.op {
+		case ">":
+			return num > n.num
+		case ">=":
+			return num >= n.num
+		case "<":
+			return num < n.num
+		default:
+			return num <= n.num
+		}
+	}
+
+	s := value.String()
+	switch n.op {
+	case "eq_i":
+		return strings.EqualFold(s, n.str)
+	case "ne_i":
+		return !strings.EqualFold(s, n.str)
+	case "contains":
+		return strings.Contains(s, n.str)
+	case "contains_i":
+		return strings.Contains(strings.ToLower(s), n.str)
+	case "starts_with":
+		return strings.HasPrefix(s, n.str)
+	case "starts_with_i":
+		return len(s) >= len(n.str) && strings.EqualFold(s[:len(n.str)], n.str)
+	case "ends_with":
+		return strings.HasSuffix(s, n.str)
+	case "ends_with_i":
+		return len(s) >= len(n.str) && strings.EqualFold(s[len(s)-len(n.str):], n.str)
+	case "matches":
+		return n.re.MatchString(s)
+	}
+	return false
+}
+
+// equal compares numerically when both sides are numbers (so 200 = 200.0),
+// and as strings otherwise.
+func (n *cmpNode) equal(value gjson.Result) bool {
+	if n.isNum && value.Type == gjson.Number {
+		return value.Float() == n.num
+	}
+	return value.String() == n.str
+}
+
+// numericValue reads numbers, and strings holding numbers ("500").
+func numericValue(value gjson.Result) (float64, bool) {
+	switch value.Type {
+	case gjson.Number:
+		return value.Float(), true
+	case gjson.String:
+		num, err := strconv.ParseFloat(value.Str, 64)
+		return num, err == nil
+	}
+	return 0, false
+}
+
+type inNode struct {
+	field  exprField
+	set    map[string]bool
+	fold   bool
+	negate bool
+}
+
+func (n *inNode) eval(e *model.LogEntry) bool {
+	value := n.field.lookup.get(e)
+	if !value.Exists() {
+		return false
+	}
+	s := value.String()
+	if n.fold {
+		s = strings.ToLower(s)
+	}
+	return n.set[s] != n.negate
+}
+
+type cidrNode struct {
+	field    exprField
+	prefixes []netip.Prefix
+}
+
+func (n *cidrNode) eval(e *model.LogEntry) bool {
+	addr, ok := sourceAddr(n.field.lookup.get(e).String())
+	if !ok {
+		return false
+	}
+	for _, prefix := range n.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"errors"
+	"streamgate/pkg/model"
+	"testing"
+)
+
+func TestAttributeFilter_Expression(t *testing.T) {
+	proc, err := NewAttributeFilterProcessor(AttributeFilterConfig{
+		Name:       "test",
+		Expression: `level=debug AND service in (a,b) AND NOT http.status_code>=500`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		wantDrop bool
+	}{
+		{"all conditions hold - drop", `{"level":"debug","service":"a","attributes":{"http.status_code":200}}`, true},
+		{"server error kept", `{"level":"debug","service":"a","attributes":{"http.status_code":503}}`, false},
+		{"other service kept", `{"level":"debug","service":"c","attributes":{"http.status_code":200}}`, false},
+		{"missing status - NOT of a missing comparison holds", `{"level":"debug","service":"b"}`, true},
+		{"not JSON - pass", `level=debug service=a`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, drop, err := proc.Process(nil, []byte(tt.input))
+			if err != nil {
+				t.Errorf("Process() error = %v", err)
+			}
+			if drop != tt.wantDrop {
+				t.Errorf("Process() drop = %v, want %v", drop, tt.wantDrop)
+			}
+		})
+	}
+}
+
+func TestExpr_Operators(t *testing.T) {
+	entry := []byte(`{
+		"level": "WARN",
+		"service.name": "checkout-api",
+		"attributes": {"http.status_code": 404, "http.method": "GET", "client.ip": "10.1.2.3:5555", "latency": "250.5"},
+		"user": {"name": "Alice Smith", "tags": "a,b"}
+	}`)
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// Comparisons
+		{`http.status_code = 404`, true},
+		{`http.status_code == 404.0`, true},
+		{`http.status_code != 404`, false},
+		{`http.status_code > 400 && http.status_code < 500`, true},
+		{`http.status_code >= 404 and http.status_code <= 404`, true},
+		{`latency > 200`, true}, // numeric string
+		{`level = warn`, false},
+		{`level eq_i warn`, true},
+		{`level ne_i WARN`, false},
+
+		// Strings
+		{`service.name starts_with checkout`, true},
+		{`service.name ends_with -API`, false},
+		{`service.name ends_with_i -API`, true},
+		{`user/name contains "Smith"`, true},
+		{`user/name contains_i 'alice'`, true},
+		{`user/name starts_with_i ALI`, true},
+		{`http.method matches "^(GET|HEAD)$"`, true},
+
+		// Lists
+		{`level in (INFO, WARN)`, true},
+		{`level in (info, warn)`, false},
+		{`level in_i (info, warn)`, true},
+		{`http.method not_in (POST, PUT)`, true},
+		{`http.method not_in_i (get)`, false},
+
+		// Existence, CIDR
+		{`user/tags exists`, true},
+		{`trace_id exists`, false},
+		{`client.ip cidr 10.0.0.0/8`, true},
+		{`client.ip cidr (192.168.0.0/16, 172.16.0.0/12)`, false},
+		{`level cidr 10.0.0.0/8`, false}, // not an IP
+
+		// Logic and grouping
+		{`not (level = INFO or level = DEBUG)`, true},
+		{`!(level = WARN) || http.status_code = 404`, true},
+		{`level = WARN AND (service.name = x OR http.method = GET)`, true},
+		{`level = WARN AND service.name = x OR http.method = GET`, true}, // AND binds tighter
+		{`level = INFO AND (service.name = x OR http.method = GET)`, false},
+
+		// Missing attributes never match a comparison
+		{`missing = 1`, false},
+		{`missing != 1`, false},
+		{`missing not_in (a)`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := compileExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("compileExpr() error = %v", err)
+			}
+			if got := node.eval(model.NewLogEntry(entry, model.Source{})); got != tt.want {
+				t.Errorf("eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpr_Errors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantPos int
+	}{
+		{`level =`, 7},
+		{`level = debug AND`, 17},
+		{`level ~ debug`, 6},
+		{`level >= high`, 9},
+		{`(level = debug`, 14},
+		{`level = debug)`, 13},
+		{`level in debug`, 9},
+		{`level in (a, b`, 14},
+		{`level = "debug`, 8},
+		{`ip cidr 10.0.0.0/33`, 8},
+		{`msg matches "(unclosed"`, 12},
+		{`AND level = debug`, 0},
+		{`level bogus x`, 6},
+		{``, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := compileExpr(tt.expr)
+			var exprErr *ExprError
+			if !errors.As(err, &exprErr) {
+				t.Fatalf("compileExpr() error = %v, want *ExprError", err)
+			}
+			if exprErr.Pos != tt.wantPos {
+				t.Errorf("error position = %d, want %d (%v)", exprErr.Pos, tt.wantPos, err)
+			}
+		})
+	}
+}
+
+func TestAttributeFilter_ExpressionExclusive(t *testing.T) {
+	_, err := NewAttributeFilterProcessor(AttributeFilterConfig{
+		Attribute:  "level",
+		Expression: "level = debug",
+	})
+	if err == nil {
+		t.Errorf("Expected error when combining expression with attribute")
+	}
+}
@@ -2,25 +2,107 @@ package engine
 
 import (
 	"bytes"
+	"fmt"
+	"streamgate/pkg/model"
 )
 
+// FilterAction says what a filter does with the entries it matches.
+type FilterAction string
+
+const (
+	// ActionDrop drops matching entries (block list). This is the default.
+	ActionDrop FilterAction = "drop"
+	// ActionKeep keeps only matching entries and drops the rest (allow list).
+	ActionKeep FilterAction = "keep"
+)
+
+// MissingPolicy says what a filter does with entries it cannot evaluate:
+// the attribute is missing, or the entry isn't JSON.
+type MissingPolicy string
+
+const (
+	// MissingKeep passes such entries through (fail-open). This is the default.
+	MissingKeep MissingPolicy = "keep"
+	// MissingDrop drops them (fail-closed), whatever the action.
+	MissingDrop MissingPolicy = "drop"
+)
+
+// parseFilterAction validates an action, defaulting to ActionDrop.
+func parseFilterAction(a FilterAction) (FilterAction, error) {
+	switch a {
+	case "":
+		return ActionDrop, nil
+	case ActionDrop, ActionKeep:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown action %q (want keep or drop)", a)
+}
+
+// parseMissingPolicy validates a missing policy, defaulting to MissingKeep.
+func parseMissingPolicy(m MissingPolicy) (MissingPolicy, error) {
+	switch m {
+	case "":
+		return MissingKeep, nil
+	case MissingKeep, MissingDrop:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown on_missing policy %q (want keep or drop)", m)
+}
+
+// FilterConfig holds configuration for creating a FilterProcessor.
+type FilterConfig struct {
+	Name   string
+	Words  []string     // an entry matches if it contains any of these
+	Action FilterAction // defaults to ActionDrop
+
+	// CaseInsensitive matches ASCII letters regardless of case.
+	CaseInsensitive bool
+}
+
 // FilterProcessor drops logs that DO NOT match the criteria (AllowList)
 // or drops logs that DO match (BlockList).
-// For V1, let's implement a BlockList (Drop if contains X).
+// Words are compiled into an Aho-Corasick automaton, so one pass over the
+// entry checks them all and the cost doesn't grow with the list.
 type FilterProcessor struct {
-	name       string
-	blockBytes [][]byte // Pre-converted to bytes for zero-alloc comparison
+	name    string
+	single  []byte       // the only word, when the automaton isn't needed
+	matcher *ahoCorasick // all words otherwise
+	keep    bool         // allow list: drop entries that match none of the words
 }
 
+// NewFilterProcessor creates a block-list filter that drops entries
+// containing any of blockWords.
 func NewFilterProcessor(name string, blockWords []string) *FilterProcessor {
-	bb := make([][]byte, len(blockWords))
-	for i, w := range blockWords {
-		bb[i] = []byte(w)
+	f, _ := NewKeywordFilterProcessor(FilterConfig{Name: name, Words: blockWords}) // default action never fails
+	return f
+}
+
+// NewKeywordFilterProcessor creates a keyword filter with a configurable action.
+// Empty words are ignored.
+func NewKeywordFilterProcessor(cfg FilterConfig) (*FilterProcessor, error) {
+	action, err := parseFilterAction(cfg.Action)
+	if err != nil {
+		return nil, err
 	}
-	return &FilterProcessor{
-		name:       name,
-		blockBytes: bb,
+
+	words := make([][]byte, 0, len(cfg.Words))
+	for _, w := range cfg.Words {
+		if w != "" {
+			words = append(words, []byte(w))
+		}
+	}
+
+	f := &FilterProcessor{
+		name: cfg.Name,
+		keep: action == ActionKeep,
 	}
+	if len(words) == 1 && !cfg.CaseInsensitive {
+		// bytes.Contains is vectorised and beats a table walk for one word.
+		f.single = words[0]
+	} else {
+		f.matcher = newAhoCorasick(words, cfg.CaseInsensitive)
+	}
+	return f, nil
 }
 
 func (f *FilterProcessor) Name() string {
@@ -28,12 +110,22 @@ func (f *FilterProcessor) Name() string {
 }
 
 func (f *FilterProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
-	// Naive O(N*M) check.
-	// Optimization: Aho-Corasick for many patterns.
-	for _, word := range f.blockBytes {
-		if bytes.Contains(entry, word) {
-			return entry, true, nil // DROP
-		}
+	return entry, f.drop(entry), nil
+}
+
+// ProcessEntry is Process on the shared envelope. Filters never change the
+// entry, so the envelope's cache survives them.
+func (f *FilterProcessor) ProcessEntry(ctx *ProcessingContext, e *model.LogEntry) (bool, error) {
+	return f.drop(e.Raw), nil
+}
+
+func (f *FilterProcessor) drop(entry []byte) bool {
+	var matched bool
+	if f.single != nil {
+		matched = bytes.Contains(entry, f.single)
+	} else {
+		matched = f.matcher.contains(entry)
 	}
-	return entry, false, nil
+	// DROP matches on a block list, non-matches on an allow list.
+	return matched != f.keep
 }
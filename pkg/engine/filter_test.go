@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestFilter_Actions(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   FilterAction
+		input    string
+		wantDrop bool
+	}{
+		{"drop - match", ActionDrop, "DEBUG: cache miss", true},
+		{"drop - no match", ActionDrop, "ERROR: disk full", false},
+		{"default is drop", "", "DEBUG: cache miss", true},
+		{"keep - match", ActionKeep, "AUDIT: login", false},
+		{"keep - no match", ActionKeep, "DEBUG: cache miss", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			words := []string{"DEBUG"}
+			if tt.action == ActionKeep {
+				words = []string{"AUDIT", "SECURITY"}
+			}
+			proc, err := NewKeywordFilterProcessor(FilterConfig{Name: "f", Words: words, Action: tt.action})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			_, drop, _ := proc.Process(nil, []byte(tt.input))
+			if drop != tt.wantDrop {
+				t.Errorf("Process() drop = %v, want %v", drop, tt.wantDrop)
+			}
+		})
+	}
+}
+
+func TestFilter_InvalidAction(t *testing.T) {
+	if _, err := NewKeywordFilterProcessor(FilterConfig{Words: []string{"x"}, Action: "allow"}); err == nil {
+		t.Errorf("Expected error for unknown action")
+	}
+}
+
+func TestFilter_ManyWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []string
+		fold  bool
+		input string
+		want  bool
+	}{
+		{"suffix of another word", []string{"hers", "his", "she", "he"}, false, "ushers", true},
+		{"found via failure link", []string{"abcd", "bc"}, false, "xabcx", true},
+		{"partial prefix only", []string{"abcd", "bcx"}, false, "abcbc", false},
+		{"no match", []string{"timeout", "refused"}, false, "request ok", false},
+		{"case-sensitive miss", []string{"debug", "trace"}, false, "DEBUG: x", false},
+		{"case-insensitive hit", []string{"debug", "trace"}, true, "DEBUG: x", true},
+		{"case-insensitive pattern", []string{"HealthCheck"}, true, "GET /healthcheck", true},
+		{"non-ASCII", []string{"ошибка", "错误"}, false, "level=错误 msg=x", true},
+		{"empty words ignored", []string{"", ""}, false, "anything", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc, err := NewKeywordFilterProcessor(FilterConfig{Name: "f", Words: tt.words, CaseInsensitive: tt.fold})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			if _, drop, _ := proc.Process(nil, []byte(tt.input)); drop != tt.want {
+				t.Errorf("Process(%q) drop = %v, want %v", tt.input, drop, tt.want)
+			}
+		})
+	}
+}
+
+// TestAhoCorasick_MatchesNaive cross-checks the automaton against bytes.Contains
+// on random inputs over a small alphabet (lots of partial overlaps).
+func TestAhoCorasick_MatchesNaive(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	randWord := func(maxLen int) []byte {
+		w := make([]byte, 1+rng.IntN(maxLen))
+		for i := range w {
+			w[i] = "abcAB"[rng.IntN(5)]
+		}
+		return w
+	}
+
+	for round := 0; round < 200; round++ {
+		patterns := make([][]byte, 1+rng.IntN(20))
+		for i := range patterns {
+			patterns[i] = randWord(5)
+		}
+		for _, fold := range []bool{false, true} {
+			ac := newAhoCorasick(patterns, fold)
+			for i := 0; i < 50; i++ {
+				input := randWord(40)
+				want := false
+				for _, p := range patterns {
+					if fold {
+						want = want || bytes.Contains(bytes.ToLower(input), bytes.ToLower(p))
+					} else {
+						want = want || bytes.Contains(input, p)
+					}
+				}
+				if got := ac.contains(input); got != want {
+					t.Fatalf("contains(%q) = %v, want %v (patterns %q, fold %v)", input, got, want, patterns, fold)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkFilter_Words shows the per-entry cost stays flat as the blocklist
+// grows. The input matches nothing, so every byte is scanned.
+func BenchmarkFilter_Words(b *testing.B) {
+	input := []byte(`{"timestamp":"2024-01-15T10:30:00Z","level":"INFO","service":"checkout","message":"order placed","order_id":"A-1029384","amount":42.50,"user":"u-88123"}`)
+
+	for _, n := range []int{1, 10, 100, 1000, 10000} {
+		words := make([]string, n)
+		for i := range words {
+			words[i] = fmt.Sprintf("noisy-pattern-%d", i)
+		}
+		proc, _ := NewKeywordFilterProcessor(FilterConfig{Name: "f", Words: words})
+
+		b.Run(fmt.Sprintf("words=%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _, _ = proc.Process(nil, input)
+			}
+		})
+	}
+}
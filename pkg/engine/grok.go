@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// grokPatterns is the bundled pattern library, after Logstash's
+// grok-patterns, rewritten for RE2 (no lookarounds or atomic groups).
+var grokPatterns = map[string]string{
+	// Basics
+	"USERNAME":     `[a-zA-Z0-9._-]+`,
+	"USER":         `%{USERNAME}`,
+	"INT":          `(?:[+-]?(?:[0-9]+))`,
+	"BASE10NUM":    `(?:[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+))`,
+	"NUMBER":       `(?:%{BASE10NUM})`,
+	"BASE16NUM":    `(?:0[xX])?[0-9A-Fa-f]+`,
+	"POSINT":       `\b(?:[1-9][0-9]*)\b`,
+	"NONNEGINT":    `\b(?:[0-9]+)\b`,
+	"WORD":         `\b\w+\b`,
+	"NOTSPACE":     `\S+`,
+	"SPACE":        `\s*`,
+	"DATA":         `.*?`,
+	"GREEDYDATA":   `.*`,
+	"QUOTEDSTRING": `(?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')`,
+	"QS":           `%{QUOTEDSTRING}`,
+	"UUID":         `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+
+	// Networking
+	"IPV4":     `(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`,
+	"IPV6":     `(?:(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}|(?:[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{1,4})*)?::(?:[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{1,4})*)?)`,
+	"IP":       `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME": `\b(?:[0-9A-Za-z][0-9A-Za-z-]{0,62})(?:\.(?:[0-9A-Za-z][0-9A-Za-z-]{0,62}))*\.?`,
+	"IPORHOST": `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT": `%{IPORHOST}:%{POSINT}`,
+
+	// Paths and URIs
+	"UNIXPATH":     `(?:/[\w%!$@:.,+~-]*)+`,
+	"PATH":         `%{UNIXPATH}`,
+	"URIPROTO":     `[A-Za-z][A-Za-z0-9+.-]+`,
+	"URIHOST":      `%{IPORHOST}(?::%{POSINT})?`,
+	"URIPATH":      `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":     `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPATHPARAM": `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":          `%{URIPROTO}://(?:%{USER}(?::[^@]*)?@)?(?:%{URIHOST})?(?:%{URIPATHPARAM})?`,
+
+	// Dates and times
+	"MONTH":             `\b(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\b`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:0[1-9]|[12][0-9]|3[01]|[1-9])`,
+	"DAY":               `(?:Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?)`,
+	"YEAR":              `(?:\d\d){1,2}`,
+	"HOUR":              `(?:2[0123]|[01]?[0-9])`,
+	"MINUTE":            `(?:[0-5][0-9])`,
+	"SECOND":            `(?:(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?)`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"DATE_US":           `%{MONTHNUM}[/-]%{MONTHDAY}[/-]%{YEAR}`,
+	"DATE_EU":           `%{MONTHDAY}[./-]%{MONTHNUM}[./-]%{YEAR}`,
+	"DATE":              `(?:%{DATE_US}|%{DATE_EU})`,
+	"DATESTAMP":         `%{DATE}[- ]%{TIME}`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+
+	// Logs
+	"LOGLEVEL":          `(?:[Aa]lert|ALERT|[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo|INFO|[Ww]arn(?:ing)?|WARN(?:ING)?|[Ee]rr(?:or)?|ERR(?:OR)?|[Cc]rit(?:ical)?|CRIT(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|[Ee]merg(?:ency)?|EMERG(?:ENCY)?)`,
+	"PROG":              `[\x21-\x5a\x5c\x5e-\x7e]+`,
+	"SYSLOGPROG":        `%{PROG:program}(?:\[%{POSINT:pid}\])?`,
+	"SYSLOGHOST":        `%{IPORHOST}`,
+	"SYSLOGBASE":        `%{SYSLOGTIMESTAMP:timestamp} (?:%{SYSLOGHOST:logsource} )?%{SYSLOGPROG}:`,
+	"COMMONAPACHELOG":   `%{IPORHOST:clientip} %{USER:ident} %{USER:auth} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:verb} %{NOTSPACE:request}(?: HTTP/%{NUMBER:httpversion})?|%{DATA:rawrequest})" %{NUMBER:response:int} (?:%{NUMBER:bytes:int}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QS:referrer} %{QS:agent}`,
+}
+
+// grokRef matches %{NAME}, %{NAME:field} and %{NAME:field:type}.
+var grokRef = regexp.MustCompile(`%\{(\w+)(?::([\w.@-]+))?(?::(int|float))?\}`)
+
+// grokMaxDepth bounds pattern expansion, catching self-referencing patterns.
+const grokMaxDepth = 32
+
+// grok is a pattern compiled to a single regexp. It also serves the regex
+// format, whose fields are simply its named groups.
+type grok struct {
+	re     *regexp.Regexp
+	fields []grokField
+}
+
+type grokField struct {
+	group int    // submatch index
+	name  string // field name
+	typ   string // "", "int" or "float"
+}
+
+// compileGrok expands pattern against the bundled library plus custom
+// patterns (which win on name clashes).
+func compileGrok(pattern string, custom map[string]string) (*grok, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern must be specified")
+	}
+
+	var fields []grokField
+	var expand func(p string, depth int) (string, error)
+	expand = func(p string, depth int) (string, error) {
+		if depth > grokMaxDepth {
+			return "", fmt.Errorf("grok patterns nest too deeply (recursive pattern?)")
+		}
+		var err error
+		out := grokRef.ReplaceAllStringFunc(p, func(ref string) string {
+			if err != nil {
+				return ""
+			}
+			m := grokRef.FindStringSubmatch(ref)
+			def, ok := custom[m[1]]
+			if !ok {
+				def, ok = grokPatterns[m[1]]
+			}
+			if !ok {
+				err = fmt.Errorf("unknown grok pattern %q", m[1])
+				return ""
+			}
+			if m[2] == "" {
+				var sub string
+				sub, err = expand(def, depth+1)
+				return "(?:" + sub + ")"
+			}
+			// Group names are generated: field names may contain dots.
+			group := fmt.Sprintf("f%d", len(fields))
+			fields = append(fields, grokField{name: m[2], typ: m[3]})
+			var sub string
+			sub, err = expand(def, depth+1)
+			return "(?P<" + group + ">" + sub + ")"
+		})
+		return out, err
+	}
+
+	expanded, err := expand(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grok pattern: %w", err)
+	}
+	for i := range fields {
+		fields[i].group = re.SubexpIndex(fmt.Sprintf("f%d", i))
+	}
+	return &grok{re: re, fields: fields}, nil
+}
+
+// parse matches line and returns its captures. Groups that didn't take part
+// in the match are left out; typed ones that don't convert stay strings.
+func (g *grok) parse(line string, fields []jsonMember) ([]jsonMember, bool) {
+	loc := g.re.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return fields, false
+	}
+	for _, f := range g.fields {
+		start, end := loc[2*f.group], loc[2*f.group+1]
+		if start < 0 {
+			continue
+		}
+		value := line[start:end]
+		member := stringField(f.name, value)
+		switch f.typ {
+		case "int":
+			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+				member.value.raw = strconv.FormatInt(v, 10)
+			}
+		case "float":
+			// NaN and Inf parse, but aren't valid JSON numbers.
+			if v, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+				member.value.raw = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+		}
+		fields = append(fields, member)
+	}
+	return fields, true
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestGrok_BundledPatternsCompile(t *testing.T) {
+	for name := range grokPatterns {
+		if _, err := compileGrok("%{"+name+"}", nil); err != nil {
+			t.Errorf("pattern %s: %v", name, err)
+		}
+	}
+}
+
+func TestGrok_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		custom  map[string]string
+		input   string
+		want    string // serialized fields, "" for no match
+	}{
+		{
+			"apache combined",
+			`%{COMBINEDAPACHELOG}`,
+			nil,
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://x.com/" "Mozilla/5.0"`,
+			`{"clientip":"127.0.0.1","ident":"-","auth":"frank","timestamp":"10/Oct/2000:13:55:36 -0700",` +
+				`"verb":"GET","request":"/a.gif","httpversion":"1.0","response":200,"bytes":2326,` +
+				`"referrer":"\"http://x.com/\"","agent":"\"Mozilla/5.0\""}`,
+		},
+		{
+			"syslog base",
+			`%{SYSLOGBASE} %{GREEDYDATA:message}`,
+			nil,
+			`Jun  1 12:00:01 web-1 sshd[123]: Accepted publickey`,
+			`{"timestamp":"Jun  1 12:00:01","logsource":"web-1","program":"sshd","pid":"123","message":"Accepted publickey"}`,
+		},
+		{
+			"typed fields",
+			`took=%{NUMBER:took:float}ms code=%{INT:code:int} ip=%{IP:client.ip}`,
+			nil,
+			`took=12.50ms code=007 ip=::1`,
+			`{"took":12.5,"code":7,"client.ip":"::1"}`,
+		},
+		{
+			"non-finite float stays a string",
+			`a=%{WORD:a:float} b=%{NOTSPACE:b:float} c=%{WORD:c:float}`,
+			nil,
+			`a=NaN b=+Inf c=Infinity`,
+			`{"a":"NaN","b":"+Inf","c":"Infinity"}`,
+		},
+		{
+			"custom pattern",
+			`%{ORDER:order}`,
+			map[string]string{"ORDER": `ORD-\d{6}`},
+			`placed ORD-123456 ok`,
+			`{"order":"ORD-123456"}`,
+		},
+		{
+			"optional group left out",
+			`%{WORD:a}(?: %{WORD:b})?$`,
+			nil,
+			`one`,
+			`{"a":"one"}`,
+		},
+		{
+			"no match",
+			`%{IPV4:ip}`,
+			nil,
+			`no address here`,
+			``,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := compileGrok(tt.pattern, tt.custom)
+			if err != nil {
+				t.Fatalf("compileGrok() error = %v", err)
+			}
+			fields, ok := g.parse(tt.input, nil)
+			got := ""
+			if ok {
+				got = string((&jsonNode{object: true, members: fields}).appendTo(nil))
+			}
+			if got != tt.want {
+				t.Errorf("parse() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"bytes"
+	"streamgate/pkg/model"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// isJSONObject reports whether entry is a valid JSON object.
+func isJSONObject(entry []byte) bool {
+	trimmed := bytes.TrimLeft(entry, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{' && gjson.ValidBytes(entry)
+}
+
+// setTopLevelField sets key to the raw JSON value in a JSON object entry,
+// replacing the existing value if the key is present and appending it
+// otherwise. The rest of the entry is copied byte-for-byte (no re-encoding).
+// Entries that are not JSON objects are returned unchanged with ok=false.
+func setTopLevelField(entry []byte, key string, raw []byte) ([]byte, bool) {
+	if !isJSONObject(entry) {
+		return entry, false
+	}
+	existing := gjson.GetBytes(entry, escapeGjsonKey(key))
+	return spliceTopLevelField(entry, existing, key, raw), true
+}
+
+// isObjectEntry is isJSONObject using the envelope's cached validation.
+func isObjectEntry(e *model.LogEntry) bool {
+	trimmed := bytes.TrimLeft(e.Raw, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{' && e.IsJSON()
+}
+
+// setEntryField is setTopLevelField on the envelope: it reuses the cached
+// parse to find an existing value, and replaces e.Raw on success.
+func setEntryField(e *model.LogEntry, key string, raw []byte) bool {
+	if !isObjectEntry(e) {
+		return false
+	}
+	existing := e.Get(escapeGjsonKey(key))
+	e.SetRaw(spliceTopLevelField(e.Raw, existing, key, raw))
+	return true
+}
+
+// spliceTopLevelField does the work of setTopLevelField on a valid object,
+// given the current value of key (if any).
+func spliceTopLevelField(entry []byte, existing gjson.Result, key string, raw []byte) []byte {
+	if existing.Exists() && existing.Index > 0 {
+		out := make([]byte, 0, len(entry)-len(existing.Raw)+len(raw))
+		out = append(out, entry[:existing.Index]...)
+		out = append(out, raw...)
+		return append(out, entry[existing.Index+len(existing.Raw):]...)
+	}
+
+	// Insert before the closing brace, with a comma unless the object is empty.
+	end := bytes.LastIndexByte(entry, '}')
+	body := bytes.TrimRight(entry[:end], " \t\r\n")
+	empty := len(body) > 0 && body[len(body)-1] == '{'
+
+	out := make([]byte, 0, len(entry)+len(key)+len(raw)+4)
+	out = append(out, body...)
+	if !empty {
+		out = append(out, ',')
+	}
+	out = appendJSONString(out, key)
+	out = append(out, ':')
+	out = append(out, raw...)
+	return append(out, entry[end:]...)
+}
+
+// escapeGjsonKey escapes characters gjson treats as path syntax, so key is
+// looked up as a single literal top-level key.
+func escapeGjsonKey(key string) string {
+	if !strings.ContainsAny(key, `.*?|#@\`) {
+		return key
+	}
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '.', '*', '?', '|', '#', '@', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(key[i])
+	}
+	return b.String()
+}
+
+// appendJSONString appends s as a JSON string literal. Unlike strconv.Quote
+// it only escapes what JSON requires, so UTF-8 text is kept as is.
+func appendJSONString(dst []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		case '\t':
+			dst = append(dst, '\\', 't')
+		default:
+			if c < 0x20 {
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			} else {
+				dst = append(dst, c)
+			}
+		}
+	}
+	return append(dst, '"')
+}
@@ -0,0 +1,317 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"streamgate/pkg/model"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ParseFormat selects how a ParseProcessor reads text.
+type ParseFormat string
+
+const (
+	ParseGrok   ParseFormat = "grok"   // grok pattern, e.g. %{IP:client} %{WORD:method}
+	ParseLogfmt ParseFormat = "logfmt" // key=value key2="quoted value" flag
+	ParseKV     ParseFormat = "kv"     // key=value with configurable delimiters
+	ParseRegex  ParseFormat = "regex"  // regular expression with named groups
+)
+
+// ParseConfig holds configuration for creating a ParseProcessor.
+type ParseConfig struct {
+	Name   string
+	Format ParseFormat
+
+	// Pattern is the grok pattern (grok) or regular expression (regex).
+	// Every named capture becomes a field.
+	Pattern string
+
+	// Patterns adds to or overrides the bundled grok patterns (grok only).
+	Patterns map[string]string
+
+	// FieldSplit separates pairs and ValueSplit separates a key from its
+	// value (kv only). They default to whitespace and "=".
+	FieldSplit string
+	ValueSplit string
+
+	// Field, if set, parses the string at this "/" path of JSON entries (e.g.
+	// "message" of a wrapped container log) and merges the result into them.
+	// Otherwise plain-text entries are parsed whole, and JSON passes through.
+	Field string
+
+	// KeepOriginal is the field the parsed text is kept under; empty drops it.
+	KeepOriginal string
+
+	// FailureTag is a field set to true on entries that fail to parse. Plain
+	// text that fails becomes {"message": <text>, <FailureTag>: true} (the
+	// text goes under KeepOriginal instead, if set). Empty leaves such
+	// entries untouched.
+	FailureTag string
+}
+
+// ParseProcessor turns unstructured text into JSON fields, so processors
+// later in the chain (attribute filters, transforms, ...) can address them.
+// It never drops entries.
+type ParseProcessor struct {
+	name         string
+	parse        func(line string, fields []jsonMember) ([]jsonMember, bool)
+	field        string // gjson path
+	fieldPath    []string
+	keepOriginal string
+	failureTag   string
+}
+
+// NewParseProcessor compiles the parser.
+func NewParseProcessor(cfg ParseConfig) (*ParseProcessor, error) {
+	p := &ParseProcessor{
+		name:         cfg.Name,
+		keepOriginal: cfg.KeepOriginal,
+		failureTag:   cfg.FailureTag,
+	}
+	if cfg.Field != "" {
+		p.field = convertToGjsonPath(cfg.Field)
+		p.fieldPath = splitTransformPath(cfg.Field)
+	}
+
+	switch cfg.Format {
+	case ParseGrok:
+		g, err := compileGrok(cfg.Pattern, cfg.Patterns)
+		if err != nil {
+			return nil, err
+		}
+		p.parse = g.parse
+	case ParseRegex:
+		if cfg.Pattern == "" {
+			return nil, fmt.Errorf("pattern must be specified")
+		}
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern: %w", err)
+		}
+		g := &grok{re: re}
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				g.fields = append(g.fields, grokField{group: i, name: name})
+			}
+		}
+		if len(g.fields) == 0 {
+			return nil, fmt.Errorf("pattern has no named groups")
+		}
+		p.parse = g.parse
+	case ParseLogfmt:
+		p.parse = parseLogfmt
+	case ParseKV:
+		kv := kvParser{fieldSplit: cfg.FieldSplit, valueSplit: cfg.ValueSplit}
+		if kv.valueSplit == "" {
+			kv.valueSplit = "="
+		}
+		p.parse = kv.parse
+	default:
+		return nil, fmt.Errorf("unknown format %q (want grok, logfmt, kv or regex)", cfg.Format)
+	}
+	return p, nil
+}
+
+func (p *ParseProcessor) Name() string {
+	return p.name
+}
+
+func (p *ParseProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
+	return processRaw(p, ctx, entry)
+}
+
+// ProcessEntry is Process on the shared envelope.
+func (p *ParseProcessor) ProcessEntry(ctx *ProcessingContext, e *model.LogEntry) (bool, error) {
+	if p.field != "" {
+		p.parseField(e)
+		return false, nil
+	}
+	if isObjectEntry(e) {
+		return false, nil // already structured
+	}
+
+	line := strings.TrimRight(string(e.Raw), "\r\n")
+	fields, ok := p.parse(line, nil)
+	if !ok && p.failureTag == "" {
+		return false, nil
+	}
+
+	out := &jsonNode{object: true}
+	if !ok {
+		key := p.keepOriginal
+		if key == "" {
+			key = "message"
+		}
+		out.put(key, &jsonNode{raw: string(appendJSONString(nil, line))})
+		out.put(p.failureTag, &jsonNode{raw: "true"})
+	} else {
+		for _, f := range fields {
+			out.put(f.key, f.value) // repeated keys: the last one wins
+		}
+		if p.keepOriginal != "" {
+			out.put(p.keepOriginal, &jsonNode{raw: string(appendJSONString(nil, line))})
+		}
+	}
+	e.SetRaw(out.appendTo(make([]byte, 0, len(e.Raw)*2)))
+	return false, nil
+}
+
+// parseField parses a string field of a JSON entry in place.
+func (p *ParseProcessor) parseField(e *model.LogEntry) {
+	if !isObjectEntry(e) {
+		return
+	}
+	v := e.Get(p.field)
+	if v.Type != gjson.String {
+		return
+	}
+
+	fields, ok := p.parse(v.Str, nil)
+	if !ok && p.failureTag == "" {
+		return
+	}
+	root := parseJSONNode(gjson.Parse(string(e.Raw)))
+	if !ok {
+		root.put(p.failureTag, &jsonNode{raw: "true"})
+	} else {
+		if p.keepOriginal == "" {
+			root.remove(p.fieldPath)
+		} else if p.keepOriginal != strings.Join(p.fieldPath, "/") {
+			original := root.remove(p.fieldPath)
+			root.put(p.keepOriginal, original)
+		}
+		for _, f := range fields {
+			root.put(f.key, f.value)
+		}
+	}
+	e.SetRaw(root.appendTo(make([]byte, 0, len(e.Raw)*2)))
+}
+
+// stringField is a parsed field holding text.
+func stringField(key, value string) jsonMember {
+	return jsonMember{key: key, value: &jsonNode{raw: string(appendJSONString(nil, value))}}
+}
+
+// parseLogfmt reads logfmt: space-separated key=value pairs, where values
+// may be double-quoted (with Go/JSON escapes) and a bare key means true.
+// A line needs at least one key=value pair to count as logfmt.
+func parseLogfmt(line string, fields []jsonMember) ([]jsonMember, bool) {
+	pairs := 0
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] > ' ' && line[i] != '=' && line[i] != '"' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return fields, false // stray '=' or '"'
+		}
+		if i == len(line) || line[i] != '=' {
+			if i < len(line) && line[i] == '"' {
+				return fields, false
+			}
+			fields = append(fields, jsonMember{key: key, value: &jsonNode{raw: "true"}})
+			continue
+		}
+		i++ // '='
+
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return fields, false // unterminated quote
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return fields, false
+			}
+			fields = append(fields, stringField(key, value))
+			i = end + 1
+		} else {
+			start = i
+			for i < len(line) && line[i] > ' ' {
+				i++
+			}
+			fields = append(fields, stringField(key, line[start:i]))
+		}
+		pairs++
+	}
+	return fields, pairs > 0
+}
+
+// kvParser reads generic key/value pairs. Values may be wrapped in single or
+// double quotes, which can contain the field separator.
+type kvParser struct {
+	fieldSplit string // "" means runs of whitespace
+	valueSplit string
+}
+
+func (p kvParser) parse(line string, fields []jsonMember) ([]jsonMember, bool) {
+	pairs := 0
+	for _, token := range p.split(line) {
+		key, value, ok := strings.Cut(token, p.valueSplit)
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if n := len(value); n >= 2 && (value[0] == '"' || value[0] == '\'') && value[n-1] == value[0] {
+			value = value[1 : n-1]
+		}
+		fields = append(fields, stringField(key, value))
+		pairs++
+	}
+	return fields, pairs > 0
+}
+
+// split cuts line at the field separator, ignoring separators inside quotes.
+func (p kvParser) split(line string) []string {
+	var tokens []string
+	start := 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '"' || c == '\'':
+			quote = c
+			continue
+		}
+
+		n := 0
+		if p.fieldSplit == "" {
+			if c == ' ' || c == '\t' {
+				n = 1
+			}
+		} else if strings.HasPrefix(line[i:], p.fieldSplit) {
+			n = len(p.fieldSplit)
+		}
+		if n > 0 {
+			if i > start {
+				tokens = append(tokens, line[start:i])
+			}
+			start = i + n
+			i += n - 1
+		}
+	}
+	if start < len(line) {
+		tokens = append(tokens, line[start:])
+	}
+	return tokens
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParse_Formats(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   ParseConfig
+		input string
+		want  string
+	}{
+		{
+			"logfmt",
+			ParseConfig{Format: ParseLogfmt},
+			`level=info msg="user logged in" user=42 cached`,
+			`{"level":"info","msg":"user logged in","user":"42","cached":true}`,
+		},
+		{
+			"logfmt escapes and empty value",
+			ParseConfig{Format: ParseLogfmt},
+			`msg="say \"hi\"" empty=`,
+			`{"msg":"say \"hi\"","empty":""}`,
+		},
+		{
+			"kv default delimiters",
+			ParseConfig{Format: ParseKV},
+			`user=bob action='log in' ok`,
+			`{"user":"bob","action":"log in"}`,
+		},
+		{
+			"kv custom delimiters",
+			ParseConfig{Format: ParseKV, FieldSplit: "&", ValueSplit: ":"},
+			`a:1&b: two &c:"x&y"`,
+			`{"a":"1","b":"two","c":"x&y"}`,
+		},
+		{
+			"regex named groups",
+			ParseConfig{Format: ParseRegex, Pattern: `^(?P<level>\w+): (?P<msg>.*)$`},
+			`ERROR: disk full`,
+			`{"level":"ERROR","msg":"disk full"}`,
+		},
+		{
+			"grok",
+			ParseConfig{Format: ParseGrok, Pattern: `%{TIMESTAMP_ISO8601:ts} %{LOGLEVEL:level} \[%{DATA:thread}\] %{GREEDYDATA:msg}`},
+			`2024-06-01T12:00:00Z WARN [main] slow query took 2s`,
+			`{"ts":"2024-06-01T12:00:00Z","level":"WARN","thread":"main","msg":"slow query took 2s"}`,
+		},
+		{
+			"keep original",
+			ParseConfig{Format: ParseLogfmt, KeepOriginal: "raw"},
+			`a=1`,
+			`{"a":"1","raw":"a=1"}`,
+		},
+		{
+			"failure untouched",
+			ParseConfig{Format: ParseLogfmt},
+			`disk full`,
+			`disk full`,
+		},
+		{
+			"failure tag",
+			ParseConfig{Format: ParseLogfmt, FailureTag: "_parse_failure"},
+			`disk full`,
+			`{"message":"disk full","_parse_failure":true}`,
+		},
+		{
+			"failure tag with keep original",
+			ParseConfig{Format: ParseRegex, Pattern: `(?P<n>\d+)`, KeepOriginal: "log", FailureTag: "unparsed"},
+			`no digits`,
+			`{"log":"no digits","unparsed":true}`,
+		},
+		{
+			"json passes through",
+			ParseConfig{Format: ParseLogfmt},
+			`{"a":"b=c"}`,
+			`{"a":"b=c"}`,
+		},
+		{
+			"field of json entry",
+			ParseConfig{Format: ParseLogfmt, Field: "log"},
+			`{"stream":"stdout","log":"level=debug id=7"}`,
+			`{"stream":"stdout","level":"debug","id":"7"}`,
+		},
+		{
+			"field kept in place",
+			ParseConfig{Format: ParseLogfmt, Field: "log", KeepOriginal: "log"},
+			`{"log":"a=1","stream":"stdout"}`,
+			`{"log":"a=1","stream":"stdout","a":"1"}`,
+		},
+		{
+			"field failure tag",
+			ParseConfig{Format: ParseLogfmt, Field: "log", FailureTag: "_parse_failure"},
+			`{"log":"plain text"}`,
+			`{"log":"plain text","_parse_failure":true}`,
+		},
+		{
+			"field missing",
+			ParseConfig{Format: ParseLogfmt, Field: "log", FailureTag: "_parse_failure"},
+			`{"msg":"a=1"}`,
+			`{"msg":"a=1"}`,
+		},
+	}
+
+	ctx := &ProcessingContext{Context: context.Background()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc, err := NewParseProcessor(tt.cfg)
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			out, drop, err := proc.Process(ctx, []byte(tt.input))
+			if err != nil || drop {
+				t.Fatalf("Process() drop = %v, err = %v", drop, err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("Process() = %s, want %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_FeedsAttributeFilter(t *testing.T) {
+	parse, err := NewParseProcessor(ParseConfig{Name: "logfmt", Format: ParseLogfmt})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	filter, err := NewAttributeFilterProcessor(AttributeFilterConfig{Name: "drop_debug", Attribute: "level", Value: "debug"})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	chain := NewProcessorChain(parse, filter)
+
+	ctx := &ProcessingContext{Context: context.Background()}
+	if _, drop, _ := chain.Process(ctx, []byte(`level=debug msg=noise`)); !drop {
+		t.Errorf("Process() drop = false, want true for debug line")
+	}
+	if _, drop, _ := chain.Process(ctx, []byte(`level=info msg=hello`)); drop {
+		t.Errorf("Process() drop = true, want false for info line")
+	}
+}
+
+func TestParse_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ParseConfig
+		want string
+	}{
+		{"unknown format", ParseConfig{Format: "xml"}, "unknown format"},
+		{"regex without pattern", ParseConfig{Format: ParseRegex}, "pattern must be specified"},
+		{"regex without groups", ParseConfig{Format: ParseRegex, Pattern: `\d+`}, "no named groups"},
+		{"bad regex", ParseConfig{Format: ParseRegex, Pattern: `(?P<a>`}, "invalid regex"},
+		{"unknown grok pattern", ParseConfig{Format: ParseGrok, Pattern: `%{NOPE:x}`}, "unknown grok pattern"},
+		{"recursive grok pattern", ParseConfig{Format: ParseGrok, Pattern: `%{A}`, Patterns: map[string]string{"A": "%{A}"}}, "nest too deeply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParseProcessor(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewParseProcessor() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
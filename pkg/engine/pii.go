@@ -0,0 +1,493 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// MaskStrategy controls how a detected PII value is rewritten.
+type MaskStrategy string
+
+const (
+	// MaskLabel replaces the value with "[REDACTED:<detector>]".
+	MaskLabel MaskStrategy = "label"
+	// MaskFull replaces every character with '*', keeping the length.
+	MaskFull MaskStrategy = "mask"
+	// MaskPartial keeps a detector-specific non-sensitive part
+	// (last 4 digits of a card, the domain of an email, ...).
+	MaskPartial MaskStrategy = "partial"
+)
+
+// piiDetector finds one kind of PII.
+// Patterns use non-capturing groups, except where only part of the match is
+// sensitive: if capture group 1 participates, only that group is masked.
+type piiDetector struct {
+	name      string
+	re        *regexp.Regexp
+	prefilter func(entry []byte) bool        // cheap check before running the regex; nil = always run
+	validate  func(value []byte) bool        // rejects regex false positives; nil = accept all
+	partial   func(dst, value []byte) []byte // MaskPartial implementation; nil = fall back to label
+	strategy  MaskStrategy                   // default strategy
+}
+
+// piiDetectors is the built-in library, in the order they run.
+// Structured identifiers (IBANs, cards, SSNs) run before the looser IP and
+// phone patterns so their digits are masked first.
+var piiDetectors = []*piiDetector{
+	{
+		name:      "private_key",
+		re:        regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY-----[\s\S]*?-----END (?:[A-Z0-9]+ )*PRIVATE KEY-----`),
+		prefilter: containsLiteral("PRIVATE KEY-----"),
+		strategy:  MaskLabel,
+	},
+	{
+		name:      "jwt",
+		re:        regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		prefilter: containsLiteral("eyJ"),
+		strategy:  MaskLabel,
+	},
+	{
+		name: "aws",
+		// Access key IDs, plus secret keys when they appear next to an "aws ... secret" label.
+		re:        regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b|(?i:aws.{0,20}?secret.{0,20}?["'=: ]+)([A-Za-z0-9/+]{40})`),
+		prefilter: containsAnyLiteral("AKIA", "ASIA", "AGPA", "AIDA", "AROA", "ANPA", "ANVA", "AIPA", "aws", "AWS"),
+		strategy:  MaskLabel,
+	},
+	{
+		name:      "gcp",
+		re:        regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b|\bya29\.[0-9A-Za-z_-]{20,}`),
+		prefilter: containsAnyLiteral("AIza", "ya29."),
+		strategy:  MaskLabel,
+	},
+	{
+		name:      "github",
+		re:        regexp.MustCompile(`\b(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}\b|\bgithub_pat_[A-Za-z0-9_]{82}\b`),
+		prefilter: containsAnyLiteral("gh", "github_pat_"),
+		strategy:  MaskLabel,
+	},
+	{
+		name:      "slack",
+		re:        regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}|https://hooks\.slack\.com/services/[A-Za-z0-9/]+`),
+		prefilter: containsAnyLiteral("xox", "hooks.slack.com"),
+		strategy:  MaskLabel,
+	},
+	{
+		name:      "iban",
+		re:        regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`),
+		prefilter: containsDigit,
+		validate:  validIBAN,
+		partial:   keepLast4,
+		strategy:  MaskPartial,
+	},
+	{
+		name:      "credit_card",
+		re:        regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		prefilter: containsDigit,
+		validate:  validCard,
+		partial:   keepLast4,
+		strategy:  MaskPartial,
+	},
+	{
+		name:      "ssn",
+		re:        regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		prefilter: containsDigit,
+		validate:  validSSN,
+		partial:   keepLast4,
+		strategy:  MaskPartial,
+	},
+	{
+		name:      "email",
+		re:        regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		prefilter: containsLiteral("@"),
+		partial:   maskEmailLocal,
+		strategy:  MaskPartial,
+	},
+	{
+		name:      "ipv4",
+		re:        regexp.MustCompile(`\b(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(?:\.(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}\b`),
+		prefilter: containsDigit,
+		partial:   maskLastOctet,
+		strategy:  MaskPartial,
+	},
+	{
+		name: "ipv6",
+		// Loose candidate; netip does the real validation.
+		re:        regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}`),
+		prefilter: containsIPv6Colon,
+		validate:  validIPv6,
+		strategy:  MaskLabel,
+	},
+	{
+		name: "phone",
+		// Either E.164 (+ and digits) or grouped with separators, so bare
+		// numeric IDs and epoch timestamps aren't taken for phone numbers.
+		re:        regexp.MustCompile(`\+\d{10,15}\b|(?:\+\d{1,3}[ .-]?)?(?:\(\d{2,4}\)[ .-]?|\b\d{2,4}[ .-])\d{3,4}[ .-]\d{3,4}\b`),
+		prefilter: containsDigit,
+		validate:  validPhone,
+		partial:   keepLast4,
+		strategy:  MaskPartial,
+	},
+}
+
+// PIIDetectorNames returns the names of all built-in detectors.
+func PIIDetectorNames() []string {
+	names := make([]string, len(piiDetectors))
+	for i, d := range piiDetectors {
+		names[i] = d.name
+	}
+	return names
+}
+
+// PIIRedactionConfig holds configuration for creating a PIIRedactionProcessor.
+type PIIRedactionConfig struct {
+	Name string
+
+	// Detectors selects detectors by name. Empty means all of them.
+	Detectors []string
+
+	// Strategy overrides the default strategy of every selected detector.
+	Strategy MaskStrategy
+
+	// Strategies overrides the strategy per detector (takes precedence over Strategy).
+	Strategies map[string]MaskStrategy
+}
+
+// activeDetector is a selected detector with its resolved strategy.
+type activeDetector struct {
+	*piiDetector
+	strategy MaskStrategy
+	label    []byte
+	hits     atomic.Uint64
+}
+
+// PIIRedactionProcessor masks values found by the built-in PII detectors.
+type PIIRedactionProcessor struct {
+	name      string
+	detectors []*activeDetector
+}
+
+// NewPIIRedactionProcessor selects detectors and resolves their strategies.
+func NewPIIRedactionProcessor(cfg PIIRedactionConfig) (*PIIRedactionProcessor, error) {
+	selected := make(map[string]bool, len(cfg.Detectors))
+	for _, name := range cfg.Detectors {
+		if findPIIDetector(name) == nil {
+			return nil, fmt.Errorf("unknown PII detector %q (available: %s)", name, strings.Join(PIIDetectorNames(), ", "))
+		}
+		selected[name] = true
+	}
+	for name, strategy := range cfg.Strategies {
+		if findPIIDetector(name) == nil {
+			return nil, fmt.Errorf("strategy for unknown PII detector %q", name)
+		}
+		if err := validateStrategy(strategy); err != nil {
+			return nil, fmt.Errorf("detector %s: %w", name, err)
+		}
+	}
+	if cfg.Strategy != "" {
+		if err := validateStrategy(cfg.Strategy); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &PIIRedactionProcessor{name: cfg.Name}
+	// Keep library order regardless of config order (see piiDetectors).
+	for _, d := range piiDetectors {
+		if len(selected) > 0 && !selected[d.name] {
+			continue
+		}
+		strategy := d.strategy
+		if cfg.Strategy != "" {
+			strategy = cfg.Strategy
+		}
+		if s, ok := cfg.Strategies[d.name]; ok {
+			strategy = s
+		}
+		if strategy == MaskPartial && d.partial == nil {
+			// Nothing meaningful to keep for this kind of value.
+			strategy = MaskLabel
+		}
+		p.detectors = append(p.detectors, &activeDetector{
+			piiDetector: d,
+			strategy:    strategy,
+			label:       []byte("[REDACTED:" + d.name + "]"),
+		})
+	}
+	return p, nil
+}
+
+func findPIIDetector(name string) *piiDetector {
+	for _, d := range piiDetectors {
+		if d.name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func validateStrategy(s MaskStrategy) error {
+	switch s {
+	case MaskLabel, MaskFull, MaskPartial:
+		return nil
+	default:
+		return fmt.Errorf("unknown mask strategy %q (want label, mask or partial)", s)
+	}
+}
+
+func (p *PIIRedactionProcessor) Name() string {
+	return p.name
+}
+
+// Hits returns how many values each detector has masked so far. It
+// implements HitCounter, so the pipeline logs them.
+func (p *PIIRedactionProcessor) Hits() map[string]uint64 {
+	hits := make(map[string]uint64, len(p.detectors))
+	for _, d := range p.detectors {
+		hits[d.name] = d.hits.Load()
+	}
+	return hits
+}
+
+func (p *PIIRedactionProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
+	for _, d := range p.detectors {
+		entry = d.redact(entry)
+	}
+	return entry, false, nil
+}
+
+// redact masks every validated match of this detector. Returns entry itself
+// (no allocation) when nothing matches.
+func (d *activeDetector) redact(entry []byte) []byte {
+	if d.prefilter != nil && !d.prefilter(entry) {
+		return entry
+	}
+	matches := d.re.FindAllSubmatchIndex(entry, -1)
+	if matches == nil {
+		return entry
+	}
+
+	var out []byte
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) > 2 && m[2] >= 0 {
+			// Mask only the sensitive group (e.g. the secret after an
+			// "aws_secret_access_key=" label), keeping the label readable.
+			start, end = m[2], m[3]
+		}
+		value := entry[start:end]
+		if d.validate != nil && !d.validate(value) {
+			continue
+		}
+		if out == nil {
+			out = make([]byte, 0, len(entry))
+		}
+		out = append(out, entry[last:start]...)
+		out = d.mask(out, value)
+		last = end
+		d.hits.Add(1)
+	}
+	if out == nil {
+		return entry // every candidate failed validation
+	}
+	return append(out, entry[last:]...)
+}
+
+func (d *activeDetector) mask(dst, value []byte) []byte {
+	switch d.strategy {
+	case MaskFull:
+		for n := utf8.RuneCount(value); n > 0; n-- {
+			dst = append(dst, '*')
+		}
+		return dst
+	case MaskPartial:
+		return d.partial(dst, value)
+	default:
+		return append(dst, d.label...)
+	}
+}
+
+// --- prefilters ---
+
+func containsLiteral(lit string) func([]byte) bool {
+	b := []byte(lit)
+	return func(entry []byte) bool {
+		return bytes.Contains(entry, b)
+	}
+}
+
+func containsAnyLiteral(lits ...string) func([]byte) bool {
+	bs := make([][]byte, len(lits))
+	for i, l := range lits {
+		bs[i] = []byte(l)
+	}
+	return func(entry []byte) bool {
+		for _, b := range bs {
+			if bytes.Contains(entry, b) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// containsIPv6Colon looks for "::" or a colon between hex digits. A bare
+// colon is too common ("INFO: ...") to be worth running the regex for.
+func containsIPv6Colon(entry []byte) bool {
+	for i := 0; i+1 < len(entry); i++ {
+		if entry[i] != ':' {
+			continue
+		}
+		if entry[i+1] == ':' || i > 0 && isHexDigit(entry[i-1]) && isHexDigit(entry[i+1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func containsDigit(entry []byte) bool {
+	for _, c := range entry {
+		if c >= '0' && c <= '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// --- validators ---
+
+// validCard accepts numbers from the major card networks (IIN starting 2-6)
+// that pass the Luhn checksum.
+func validCard(value []byte) bool {
+	return value[0] >= '2' && value[0] <= '6' && validLuhn(value)
+}
+
+// validLuhn checks the card checksum on the digits of value (separators ignored).
+func validLuhn(value []byte) bool {
+	sum, n := 0, 0
+	for i := len(value) - 1; i >= 0; i-- {
+		c := value[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// validSSN rejects numbers the SSA never issues (area 000/666/9xx, group 00, serial 0000).
+func validSSN(value []byte) bool {
+	area, group, serial := string(value[0:3]), string(value[4:6]), string(value[7:11])
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// validIBAN checks length and the ISO 7064 mod-97 checksum.
+func validIBAN(value []byte) bool {
+	iban := make([]byte, 0, len(value))
+	for _, c := range value {
+		if c != ' ' {
+			iban = append(iban, c)
+		}
+	}
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	// Move the country code and check digits to the end, map letters to 10..35.
+	rearranged := append(iban[4:len(iban):len(iban)], iban[:4]...)
+	rem := 0
+	for _, c := range rearranged {
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// validIPv6 parses the candidate. It also requires a digit, which rules out
+// things like "std::vector" whose "d::" happens to be a valid address.
+func validIPv6(value []byte) bool {
+	if !containsDigit(value) {
+		return false
+	}
+	addr, err := netip.ParseAddr(string(value))
+	return err == nil && addr.Is6() && !addr.Is4In6()
+}
+
+// validPhone requires 10-15 digits (E.164 max), which rules out short
+// numeric IDs that happen to fit the pattern.
+func validPhone(value []byte) bool {
+	n := 0
+	for _, c := range value {
+		if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n >= 10 && n <= 15
+}
+
+// --- partial maskers ---
+
+// keepLast4 masks every letter/digit except the last four, keeping separators.
+func keepLast4(dst, value []byte) []byte {
+	alnum := 0
+	for _, c := range value {
+		if isAlnum(c) {
+			alnum++
+		}
+	}
+	seen := 0
+	for _, c := range value {
+		if isAlnum(c) {
+			seen++
+			if seen <= alnum-4 {
+				c = '*'
+			}
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// maskEmailLocal keeps the first character of the local part and the domain.
+func maskEmailLocal(dst, value []byte) []byte {
+	at := bytes.IndexByte(value, '@')
+	if at <= 0 {
+		return append(dst, value...)
+	}
+	dst = append(dst, value[0])
+	for i := 1; i < at; i++ {
+		dst = append(dst, '*')
+	}
+	return append(dst, value[at:]...)
+}
+
+// maskLastOctet keeps the network part of an IPv4 address: 10.1.2.3 -> 10.1.2.***
+func maskLastOctet(dst, value []byte) []byte {
+	dot := bytes.LastIndexByte(value, '.')
+	return append(append(dst, value[:dot+1]...), "***"...)
+}
+
+func isAlnum(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
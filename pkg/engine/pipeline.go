@@ -2,13 +2,31 @@ package engine
 
 import (
 	"context"
+	"io"
 	"log"
+	"streamgate/pkg/model"
 	"streamgate/pkg/output"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// minShardSize is the smallest per-worker buffer used when sharding.
+const minShardSize = 64
+
+// outputCloseGrace is how long a swapped-out output stays open for writes
+// already in flight.
+const outputCloseGrace = time.Minute
+
+// hitsLogInterval is how often the chain's hit counters are logged.
+const hitsLogInterval = time.Minute
+
 // Pipeline connects the Ingest Buffer -> ProcessorChain -> Output.
+//
+// With a single worker, the worker pops straight from the ingest buffer.
+// With N > 1 workers, a dispatcher pops from the ingest buffer and routes each
+// entry to one of N shard buffers by its shard key, so entries sharing a key
+// are processed by the same worker and keep their relative order.
 type Pipeline struct {
 	buffer *RingBuffer
 	chain  atomic.Pointer[ProcessorChain] // Hot-swappable chain
@@ -16,13 +34,29 @@ type Pipeline struct {
 
 	// Config
 	batchSize atomic.Int64
-	workers   int
+
+	// Worker lifecycle. Only touched on Start/UpdateWorkers, never on the hot path.
+	mu       sync.Mutex
+	ctx      context.Context // parent context from Start; nil until started
+	workers  int
+	shardKey string
+	group    *workerGroup
+	stopHits chan struct{} // ends the hit counter reporting
+}
+
+// workerGroup is one generation of dispatcher + workers.
+// Changing the worker count stops the current group and starts a new one.
+type workerGroup struct {
+	stopDispatch chan struct{}
+	stopWorkers  chan struct{}
+	dispatchWG   sync.WaitGroup
+	workersWG    sync.WaitGroup
 }
 
 func NewPipeline(buf *RingBuffer, chain *ProcessorChain, out output.Output) *Pipeline {
 	p := &Pipeline{
 		buffer:  buf,
-		workers: 1, // single consumer for now
+		workers: 1,
 	}
 	p.batchSize.Store(100)
 	p.chain.Store(chain)
@@ -44,8 +78,30 @@ func (p *Pipeline) UpdateBatchSize(size int64) {
 
 // UpdateChain hot-swaps the processor chain safely.
 func (p *Pipeline) UpdateChain(chain *ProcessorChain) {
-	p.chain.Store(chain)
+	old := p.chain.Swap(chain)
 	log.Println("Pipeline: Processor chain hot-swapped.")
+
+	// Hand over whatever the old chain was holding (summaries, aggregates).
+	// A worker still mid-entry on the old chain may add to it afterwards;
+	// that residue is lost, which is acceptable for a reload.
+	if old != nil && old != chain {
+		p.writeFlushed(old.Flush(time.Now(), true))
+		old.LogHits()
+	}
+}
+
+// writeFlushed sends entries produced by Flushers to the current output.
+func (p *Pipeline) writeFlushed(entries [][]byte) {
+	if len(entries) == 0 {
+		return
+	}
+	out, ok := p.output.Load().(output.Output)
+	if !ok {
+		return // no output configured yet
+	}
+	if err := out.WriteBatch(entries); err != nil {
+		log.Printf("Output error: %v", err)
+	}
 }
 
 // UpdateOutput hot-swaps the output provider safely.
@@ -57,26 +113,207 @@ func (p *Pipeline) UpdateOutput(out output.Output) {
 		// Wrap it if it's not already a FanOut
 		out = output.NewFanOutOutput(out)
 	}
-	p.output.Store(out)
+	old := p.output.Swap(out)
 	log.Println("Pipeline: Output provider hot-swapped.")
+
+	// A worker may still be writing to the old output (and retrying), so
+	// give it time before closing its connections.
+	if c, ok := old.(io.Closer); ok && old != out {
+		time.AfterFunc(outputCloseGrace, func() { c.Close() })
+	}
+}
+
+// UpdateWorkers changes the number of workers and the shard key.
+// shardKey is "" or "hash" for a hash of the whole entry, or an attribute name
+// such as "service.name". If the pipeline is running, the current workers
+// drain their shards and stop before the new set starts, so per-key ordering
+// holds across the switch. It is a no-op if nothing changed.
+func (p *Pipeline) UpdateWorkers(workers int, shardKey string) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if workers == p.workers && shardKey == p.shardKey {
+		return
+	}
+	p.workers = workers
+	p.shardKey = shardKey
+
+	if p.group == nil {
+		return // not started yet; Start picks up the new settings
+	}
+	p.group.stop()
+	p.group = p.startGroup()
+	log.Printf("Pipeline: Resized to %d worker(s) (shard key %q).", workers, shardKey)
 }
 
 func (p *Pipeline) Start(ctx context.Context) {
-	log.Println("Starting Processing Pipeline...")
-	for i := 0; i < p.workers; i++ {
-		go p.worker(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	log.Printf("Starting Processing Pipeline with %d worker(s)...", p.workers)
+	p.ctx = ctx
+	p.group = p.startGroup()
+	p.stopHits = make(chan struct{})
+	go p.reportHits(ctx, p.stopHits)
+}
+
+// reportHits logs the chain's hit counters every hitsLogInterval, and once
+// more at shutdown.
+func (p *Pipeline) reportHits(ctx context.Context, stop <-chan struct{}) {
+	ticker := time.NewTicker(hitsLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.chain.Load().LogHits()
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.chain.Load().LogHits()
+		}
 	}
 }
 
-func (p *Pipeline) worker(ctx context.Context) {
+// Stop halts the workers, then drains whatever is left in the pipeline's
+// buffer through the chain and flushes it. Used when a pipeline is removed
+// from the manifest; the caller must stop routing entries to it first.
+func (p *Pipeline) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.group == nil {
+		return
+	}
+	p.group.stop()
+	p.group = nil
+	close(p.stopHits)
+
+	// A worker whose stop channel is already closed drains src and returns.
+	stopped := make(chan struct{})
+	close(stopped)
+	p.worker(p.ctx, p.buffer, stopped, true)
+	p.writeFlushed(p.chain.Load().Flush(time.Now(), true))
+	p.chain.Load().LogHits()
+	if c, ok := p.output.Load().(io.Closer); ok {
+		c.Close()
+	}
+	log.Println("Pipeline: Stopped.")
+}
+
+// startGroup launches a dispatcher (if sharding) and the workers. Caller holds p.mu.
+func (p *Pipeline) startGroup() *workerGroup {
+	g := &workerGroup{
+		stopDispatch: make(chan struct{}),
+		stopWorkers:  make(chan struct{}),
+	}
+	// Snapshot settings: goroutines must not read p's fields after we unlock.
+	ctx := p.ctx
+	key := newShardKeyFunc(p.shardKey)
+
+	if p.workers == 1 {
+		// No sharding: the worker consumes the ingest buffer directly.
+		// On stop it leaves remaining entries there for the next group.
+		g.workersWG.Add(1)
+		go func() {
+			defer g.workersWG.Done()
+			p.worker(ctx, p.buffer, g.stopWorkers, false)
+		}()
+		return g
+	}
+
+	shards := make([]*RingBuffer, p.workers)
+	size := shardSize(p.buffer.Capacity(), p.workers)
+	for i := range shards {
+		shards[i], _ = NewRingBuffer(size) // size is always a power of 2
+	}
+
+	g.workersWG.Add(len(shards))
+	for _, shard := range shards {
+		go func(shard *RingBuffer) {
+			defer g.workersWG.Done()
+			p.worker(ctx, shard, g.stopWorkers, true)
+		}(shard)
+	}
+
+	g.dispatchWG.Add(1)
+	go func() {
+		defer g.dispatchWG.Done()
+		p.dispatch(ctx, g.stopDispatch, shards, key)
+	}()
+
+	return g
+}
+
+// stop halts the dispatcher first, then lets workers drain their shards.
+func (g *workerGroup) stop() {
+	close(g.stopDispatch)
+	g.dispatchWG.Wait()
+	close(g.stopWorkers)
+	g.workersWG.Wait()
+}
+
+// shardSize splits the ingest capacity across workers, rounded down to a power of 2.
+func shardSize(capacity uint64, workers int) uint64 {
+	per := capacity / uint64(workers)
+	size := uint64(minShardSize)
+	for size*2 <= per {
+		size *= 2
+	}
+	return size
+}
+
+// dispatch routes entries from the ingest buffer to shard buffers by key.
+// When a shard is full it waits for that worker instead of dropping, which
+// pushes backpressure onto the ingest buffer (where drops are counted).
+func (p *Pipeline) dispatch(ctx context.Context, stop <-chan struct{}, shards []*RingBuffer, key ShardKeyFunc) {
+	n := uint64(len(shards))
+	quit := mergeDone(ctx, stop)
+	for {
+		// Checked every iteration: PopWait alone never returns nil while items keep coming.
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		item, src := p.buffer.PopWaitFrom(quit, nil)
+		if item == nil {
+			return // ctx cancelled or group stopped
+		}
+
+		// Waits for the worker to free a slot. Only shutdown gives up: on a
+		// group stop the workers are still draining, so the entry gets in.
+		shard := shards[key(item, src)%n]
+		if err := shard.PushWaitFrom(item, src, ctx.Done()); err != nil {
+			return // ctx cancelled
+		}
+	}
+}
+
+// worker pops from src, runs the chain and batches results to the output.
+// On ctx cancellation it flushes and exits. On stop it flushes and exits too,
+// draining src first if drain is set (shard buffers are owned by the group).
+func (p *Pipeline) worker(ctx context.Context, src *RingBuffer, stop <-chan struct{}, drain bool) {
 	// Reusable batch slice. Start with default 100 capacity.
 	// If batchSize increases later, append() will handle reallocation automatically.
 	batch := make([][]byte, 0, 100)
 	pCtx := &ProcessingContext{Context: ctx}
 
+	// One envelope per worker, refilled for every entry. Only its Raw slice
+	// goes into the batch, so reusing the struct is safe.
+	var env model.LogEntry
+
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
 
+	// Closed on either shutdown or group stop, so PopWait can park on one channel.
+	quit := mergeDone(ctx, stop)
+
 	flush := func() {
 		if len(batch) > 0 {
 			// Load current output safely
@@ -89,54 +326,85 @@ func (p *Pipeline) worker(ctx context.Context) {
 		}
 	}
 
+	handle := func(item []byte, src model.Source) {
+		// Fail-Open Check (Circuit Breaker)
+		// If the ingest buffer is > 80% full, bypass processing to drain quicker.
+		usage := p.buffer.Usage()
+		capacity := p.buffer.Capacity()
+
+		if float64(usage) > float64(capacity)*0.80 {
+			// Bypass Mode!
+			batch = append(batch, item)
+		} else {
+			// Normal Mode
+			env.SetRaw(item)
+			env.Source = src
+			clear(env.Metadata)
+
+			// Load current chain safely
+			currentChain := p.chain.Load()
+			drop, err := currentChain.ProcessEntry(pCtx, &env)
+			if err != nil {
+				log.Printf("Process error: %v", err)
+				return
+			}
+			if drop {
+				return
+			}
+			batch = append(batch, env.Raw)
+		}
+
+		// Check current batch limit dynamically
+		currentLimit := int(p.batchSize.Load())
+		if len(batch) >= currentLimit {
+			flush()
+		}
+	}
+
+	// tick also gives Flushers in the chain a chance to emit.
+	tick := func(final bool) {
+		batch = append(batch, p.chain.Load().Flush(time.Now(), final)...)
+		flush()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			flush()
+			tick(true)
+			return
+		case <-stop:
+			if drain {
+				for item, from := src.PopFrom(); item != nil; item, from = src.PopFrom() {
+					handle(item, from)
+				}
+			}
+			tick(false) // a worker group restart must not end Flusher windows
 			return
 		case <-ticker.C:
-			flush()
+			tick(false)
 		default:
-			// 1. Pop from Buffer
-			item := p.buffer.Pop()
+			// Park until a producer pushes, the flush ticker fires, or we are told to quit.
+			item, from := src.PopWaitFrom(quit, ticker.C)
 			if item == nil {
-				// Buffer empty, tiny sleep to save CPU?
-				// Or use a Cond/Signal (better).
-				// For V1 spin-wait with sleep is okay-ish but suboptimal.
-				time.Sleep(1 * time.Millisecond) // TODO: Replace with sync.Cond
+				// Woken by the ticker (or quitting): the tick was consumed here,
+				// so flush now instead of in the ticker case.
+				tick(false)
 				continue
 			}
-
-			// 2. Fail-Open Check (Circuit Breaker)
-			// If buffer is > 80% full, bypass processing to drain quicker.
-			usage := p.buffer.Usage()
-			capacity := p.buffer.Capacity()
-
-			if float64(usage) > float64(capacity)*0.80 {
-				// Bypass Mode!
-				batch = append(batch, item)
-			} else {
-				// Normal Mode
-				// Load current chain safely
-				currentChain := p.chain.Load()
-				processed, drop, err := currentChain.Process(pCtx, item)
-				if err != nil {
-					log.Printf("Process error: %v", err)
-					continue
-				}
-				if drop {
-					continue
-				}
-				batch = append(batch, processed)
-			}
-
-			// 4. Add to Batch (handled above)
-			// 4. Add to Batch (handled above)
-			// Check current batch limit dynamically
-			currentLimit := int(p.batchSize.Load())
-			if len(batch) >= currentLimit {
-				flush()
-			}
+			handle(item, from)
 		}
 	}
 }
+
+// mergeDone returns a channel that is closed once ctx is done or stop is closed.
+func mergeDone(ctx context.Context, stop <-chan struct{}) <-chan struct{} {
+	quit := make(chan struct{})
+	go func() {
+		defer close(quit)
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+	}()
+	return quit
+}
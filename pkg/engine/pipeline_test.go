@@ -3,17 +3,25 @@ package engine
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"streamgate/pkg/model"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/tidwall/gjson"
 )
 
 // MockOutput captures writes for verification
 type MockOutput struct {
+	mu       sync.Mutex // workers may write concurrently
 	Captured [][]byte
 }
 
 func (m *MockOutput) WriteBatch(entries [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for _, e := range entries {
 		// Copy because buffer is reused
 		c := make([]byte, len(e))
@@ -23,6 +31,20 @@ func (m *MockOutput) WriteBatch(entries [][]byte) error {
 	return nil
 }
 
+// Snapshot returns a copy of what has been captured so far.
+func (m *MockOutput) Snapshot() [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]byte(nil), m.Captured...)
+}
+
+// Reset clears captured entries.
+func (m *MockOutput) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Captured = nil
+}
+
 func TestPipeline_Integration(t *testing.T) {
 	// Setup
 	buf, _ := NewRingBuffer(128) // Small buffer
@@ -49,14 +71,15 @@ func TestPipeline_Integration(t *testing.T) {
 
 	time.Sleep(200 * time.Millisecond) // Wait for worker
 
-	if len(out.Captured) != 2 {
-		t.Fatalf("Expected 2 logs, got %d", len(out.Captured))
+	captured := out.Snapshot()
+	if len(captured) != 2 {
+		t.Fatalf("Expected 2 logs, got %d", len(captured))
 	}
-	if !bytes.Equal(out.Captured[0], []byte("good log")) {
+	if !bytes.Equal(captured[0], []byte("good log")) {
 		t.Errorf("Log 1 mismatch")
 	}
-	if !strings.Contains(string(out.Captured[1]), "xxxx") {
-		t.Errorf("Log 2 was not redacted: %s", string(out.Captured[1]))
+	if !strings.Contains(string(captured[1]), "xxxx") {
+		t.Errorf("Log 2 was not redacted: %s", string(captured[1]))
 	}
 
 	// Test 2: Fail-Open (Circuit Breaker)
@@ -67,24 +90,25 @@ func TestPipeline_Integration(t *testing.T) {
 	// but once specific threshold hits, it should bypass.
 
 	// Reset
-	out.Captured = nil
+	out.Reset()
 	// Fill buffer almost full
 	for i := 0; i < 110; i++ {
 		_ = buf.Push([]byte("fill_bad")) // 'bad' should be filtered normally
 	}
 
 	time.Sleep(500 * time.Millisecond)
+	captured = out.Snapshot()
 
 	// If normal: 0 logs (all filtered).
 	// If fail-open: some logs will bypass filter and appear.
 	// Since 110 > 102, we expect Fail-Open to trigger for the late arrivals.
-	if len(out.Captured) == 0 {
+	if len(captured) == 0 {
 		t.Log("No logs captured. Fail-Open might not have triggered fast enough or drained too fast.")
 	} else {
-		t.Logf("Captured %d logs in potential Fail-Open mode", len(out.Captured))
+		t.Logf("Captured %d logs in potential Fail-Open mode", len(captured))
 		// If we see "fill_bad", it means filter was skipped!
 		foundBypass := false
-		for _, l := range out.Captured {
+		for _, l := range captured {
 			if string(l) == "fill_bad" {
 				foundBypass = true
 				break
@@ -99,3 +123,129 @@ func TestPipeline_Integration(t *testing.T) {
 		}
 	}
 }
+
+// waitForCount polls the mock output until it has n entries or the timeout expires.
+func waitForCount(out *MockOutput, n int, timeout time.Duration) [][]byte {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if got := out.Snapshot(); len(got) >= n {
+			return got
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return out.Snapshot()
+}
+
+// checkPerKeyOrder asserts that for every service, seq numbers are strictly increasing.
+func checkPerKeyOrder(t *testing.T, captured [][]byte) {
+	t.Helper()
+	last := map[string]int64{}
+	for _, e := range captured {
+		svc := gjson.GetBytes(e, "service\\.name").String()
+		seq := gjson.GetBytes(e, "seq").Int()
+		if prev, ok := last[svc]; ok && seq <= prev {
+			t.Fatalf("service %s out of order: seq %d after %d", svc, seq, prev)
+		}
+		last[svc] = seq
+	}
+}
+
+func TestPipeline_MultiWorkerKeyOrdering(t *testing.T) {
+	const (
+		services   = 7
+		perService = 300
+	)
+
+	buf, _ := NewRingBuffer(1 << 13) // holds everything: no bypass, no drops
+	out := &MockOutput{}
+	p := NewPipeline(buf, NewProcessorChain(), out)
+	p.UpdateBatchSize(16)
+	p.UpdateWorkers(4, "service.name")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.Start(ctx)
+
+	for i := 0; i < perService; i++ {
+		for s := 0; s < services; s++ {
+			line := fmt.Sprintf(`{"service.name":"svc-%d","seq":%d}`, s, i)
+			if err := buf.Push([]byte(line)); err != nil {
+				t.Fatalf("push failed: %v", err)
+			}
+		}
+	}
+
+	captured := waitForCount(out, services*perService, 3*time.Second)
+	if len(captured) != services*perService {
+		t.Fatalf("Expected %d logs, got %d", services*perService, len(captured))
+	}
+	checkPerKeyOrder(t, captured)
+}
+
+func TestPipeline_UpdateWorkersWhileRunning(t *testing.T) {
+	buf, _ := NewRingBuffer(1 << 14)
+	out := &MockOutput{}
+	p := NewPipeline(buf, NewProcessorChain(), out)
+	p.UpdateBatchSize(8)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.Start(ctx)
+
+	total := 0
+	push := func(n int) {
+		for i := 0; i < n; i++ {
+			line := fmt.Sprintf(`{"service.name":"svc-%d","seq":%d}`, i%3, total)
+			if err := buf.Push([]byte(line)); err != nil {
+				t.Fatalf("push failed: %v", err)
+			}
+			total++
+		}
+	}
+
+	push(500)
+	p.UpdateWorkers(4, "service.name")
+	push(500)
+	p.UpdateWorkers(2, "service.name")
+	push(500)
+	p.UpdateWorkers(1, "")
+	push(500)
+
+	captured := waitForCount(out, total, 3*time.Second)
+	if len(captured) != total {
+		t.Fatalf("Expected %d logs across resizes, got %d", total, len(captured))
+	}
+	checkPerKeyOrder(t, captured)
+}
+
+func TestShardSize(t *testing.T) {
+	tests := []struct {
+		capacity uint64
+		workers  int
+		want     uint64
+	}{
+		{65536, 1, 65536},
+		{65536, 3, 16384},
+		{65536, 4, 16384},
+		{128, 8, minShardSize},
+	}
+	for _, tt := range tests {
+		if got := shardSize(tt.capacity, tt.workers); got != tt.want {
+			t.Errorf("shardSize(%d, %d) = %d, want %d", tt.capacity, tt.workers, got, tt.want)
+		}
+	}
+}
+
+func TestShardKey_SourceAttribute(t *testing.T) {
+	key := newShardKeyFunc("@source.identity")
+	billing := model.Source{Identity: "billing-agent"}
+
+	a := key([]byte(`{"msg":"a"}`), billing)
+	b := key([]byte("plain text"), billing)
+	if a != b {
+		t.Errorf("same identity hashed to %d and %d", a, b)
+	}
+	if c := key([]byte(`{"msg":"a"}`), model.Source{Identity: "web"}); c == a {
+		t.Errorf("different identities hashed to the same key %d", c)
+	}
+}
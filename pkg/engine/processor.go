@@ -1,5 +1,10 @@
 package engine
 
+import (
+	"streamgate/pkg/model"
+	"time"
+)
+
 // Processor defines the interface for any component that transforms or filters logs.
 type Processor interface {
 	// Process applies logic to the entry.
@@ -11,3 +16,46 @@ type Processor interface {
 	// Name returns the identifier of the processor (for metrics/logging).
 	Name() string
 }
+
+// EntryProcessor is implemented by processors that work on the parsed
+// envelope instead of raw bytes. They share the entry's JSON validation and
+// field lookups with every other EntryProcessor in the chain, so ten
+// attribute filters parse a log once instead of ten times.
+//
+// Implementations that change the entry must do so through e.SetRaw (or
+// call e.Touch after an in-place edit). Processors that only implement
+// Processor keep working: the chain hands them e.Raw and assumes they may
+// have changed it.
+type EntryProcessor interface {
+	ProcessEntry(ctx *ProcessingContext, e *model.LogEntry) (drop bool, err error)
+
+	// Name returns the identifier of the processor (for metrics/logging).
+	Name() string
+}
+
+// processRaw implements Processor.Process for an EntryProcessor, so it can
+// still be used on raw bytes (tests, benchmarks, callers outside a chain).
+func processRaw(p EntryProcessor, ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
+	e := model.LogEntry{Raw: entry}
+	drop, err := p.ProcessEntry(ctx, &e)
+	return e.Raw, drop, err
+}
+
+// Flusher is implemented by processors that produce entries of their own,
+// such as periodic summaries or aggregates.
+// The pipeline calls Flush on every flush tick (about every 100ms, from each
+// worker) and once with final=true when it stops or the chain is replaced.
+// The processor decides whether anything is due; returned entries go straight
+// to the output, bypassing the rest of the chain.
+// Flush may be called concurrently with Process.
+type Flusher interface {
+	Flush(now time.Time, final bool) [][]byte
+}
+
+// HitCounter is implemented by processors that count matches per rule, such
+// as the PII redactor's per-detector hits. The pipeline logs the counts
+// periodically, when the chain is replaced and when it stops.
+// Hits may be called concurrently with Process.
+type HitCounter interface {
+	Hits() map[string]uint64
+}
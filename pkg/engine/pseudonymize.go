@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// minPseudonymKeyLen is the shortest HMAC key we accept (128 bits).
+	minPseudonymKeyLen = 16
+
+	// pseudonymTokenBytes is how much of the HMAC-SHA256 digest ends up in a
+	// token. 16 bytes (32 hex chars) keeps collisions out of reach while
+	// staying short enough to read in a log line.
+	pseudonymTokenBytes = 16
+)
+
+// PseudonymizeConfig holds configuration for creating a PseudonymizeProcessor.
+// At least one of Paths or Pattern must be set; both may be.
+type PseudonymizeConfig struct {
+	Name string
+
+	// Paths are JSON paths using "/" as separator, as in AttributeFilterConfig.
+	// Each must point at a string, number or bool.
+	Paths []string
+
+	// Pattern is an RE2 regex whose matches are replaced. If Groups is set,
+	// only those named capture groups are replaced.
+	Pattern string
+	Groups  []string
+
+	// KeyID is prepended to every token ("<kid>:<hex>"), so tokens minted under
+	// different keys are told apart after a rotation.
+	KeyID string
+	Key   []byte
+}
+
+// PseudonymizeProcessor replaces values with a keyed HMAC token.
+// The same value under the same key always yields the same token, so a
+// user can still be followed across log lines without exposing who they are.
+type PseudonymizeProcessor struct {
+	name   string
+	paths  []string // gjson paths
+	re     *regexp.Regexp
+	groups []int // submatch indexes, ascending; nil = whole match
+	prefix []byte
+
+	macs sync.Pool // hash.Hash keyed with the configured key
+}
+
+// NewPseudonymizeProcessor validates the config and prepares the HMAC key.
+func NewPseudonymizeProcessor(cfg PseudonymizeConfig) (*PseudonymizeProcessor, error) {
+	if len(cfg.Paths) == 0 && cfg.Pattern == "" {
+		return nil, fmt.Errorf("either paths or pattern must be specified")
+	}
+	if cfg.KeyID == "" {
+		return nil, fmt.Errorf("key id must be specified")
+	}
+	if strings.ContainsAny(cfg.KeyID, ": \t\"\\") {
+		return nil, fmt.Errorf("key id %q must not contain ':', quotes, backslashes or whitespace", cfg.KeyID)
+	}
+	if len(cfg.Key) < minPseudonymKeyLen {
+		return nil, fmt.Errorf("key must be at least %d bytes, got %d", minPseudonymKeyLen, len(cfg.Key))
+	}
+
+	p := &PseudonymizeProcessor{
+		name:   cfg.Name,
+		prefix: []byte(cfg.KeyID + ":"),
+	}
+
+	for _, path := range cfg.Paths {
+		p.paths = append(p.paths, convertToGjsonPath(path))
+	}
+
+	if cfg.Pattern != "" {
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern: %w", err)
+		}
+		p.re = re
+		for _, g := range cfg.Groups {
+			idx := re.SubexpIndex(g)
+			if idx < 0 {
+				return nil, fmt.Errorf("pattern has no named group %q", g)
+			}
+			p.groups = append(p.groups, idx)
+		}
+		sort.Ints(p.groups)
+	} else if len(cfg.Groups) > 0 {
+		return nil, fmt.Errorf("groups require a pattern")
+	}
+
+	// Copy the key so the caller can't change it under us.
+	key := append([]byte(nil), cfg.Key...)
+	p.macs.New = func() any { return hmac.New(sha256.New, key) }
+
+	return p, nil
+}
+
+func (p *PseudonymizeProcessor) Name() string {
+	return p.name
+}
+
+func (p *PseudonymizeProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
+	if len(p.paths) > 0 {
+		entry = p.replacePaths(entry)
+	}
+	if p.re != nil {
+		entry = p.replaceMatches(entry)
+	}
+	return entry, false, nil
+}
+
+// span is a byte range of the entry to swap for replacement.
+type span struct {
+	start, end  int
+	replacement []byte
+}
+
+// replacePaths swaps each JSON value found at a configured path for a quoted
+// token. Missing paths, objects and arrays are left alone (fail-open).
+func (p *PseudonymizeProcessor) replacePaths(entry []byte) []byte {
+	if !gjson.ValidBytes(entry) {
+		return entry
+	}
+
+	var spans []span
+	for _, path := range p.paths {
+		value := gjson.GetBytes(entry, path)
+		if !value.Exists() || value.Index <= 0 {
+			continue // not found, or not addressable (e.g. modifier output)
+		}
+		switch value.Type {
+		case gjson.String, gjson.Number, gjson.True, gjson.False:
+		default:
+			continue
+		}
+
+		// Hash the decoded string, so "abc" and "abc" get the same token.
+		var input []byte
+		if value.Type == gjson.String {
+			input = []byte(value.Str)
+		} else {
+			input = []byte(value.Raw)
+		}
+
+		token := make([]byte, 0, len(p.prefix)+2*pseudonymTokenBytes+2)
+		token = append(token, '"')
+		token = p.token(token, input)
+		token = append(token, '"')
+		spans = append(spans, span{start: value.Index, end: value.Index + len(value.Raw), replacement: token})
+	}
+	if len(spans) == 0 {
+		return entry
+	}
+
+	// Two paths may resolve to the same value; replace it once.
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	out := make([]byte, 0, len(entry))
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			continue
+		}
+		out = append(out, entry[last:s.start]...)
+		out = append(out, s.replacement...)
+		last = s.end
+	}
+	return append(out, entry[last:]...)
+}
+
+// replaceMatches swaps regex matches (or the selected groups) for a token.
+func (p *PseudonymizeProcessor) replaceMatches(entry []byte) []byte {
+	matches := p.re.FindAllSubmatchIndex(entry, -1)
+	if matches == nil {
+		return entry
+	}
+
+	out := make([]byte, 0, len(entry))
+	last := 0
+	for _, m := range matches {
+		if p.groups == nil {
+			out = append(out, entry[last:m[0]]...)
+			out = p.token(out, entry[m[0]:m[1]])
+			last = m[1]
+			continue
+		}
+		for _, g := range p.groups {
+			start, end := m[2*g], m[2*g+1]
+			if start < 0 || start < last {
+				continue // didn't participate, or nested in a replaced group
+			}
+			out = append(out, entry[last:start]...)
+			out = p.token(out, entry[start:end])
+			last = end
+		}
+	}
+	return append(out, entry[last:]...)
+}
+
+// token appends "<kid>:<hex(HMAC-SHA256(key, value))[:32]>" to dst.
+func (p *PseudonymizeProcessor) token(dst, value []byte) []byte {
+	mac := p.macs.Get().(hash.Hash)
+	mac.Reset()
+	mac.Write(value)
+	var sum [sha256.Size]byte
+	digest := mac.Sum(sum[:0])
+	p.macs.Put(mac)
+
+	dst = append(dst, p.prefix...)
+	return hex.AppendEncode(dst, digest[:pseudonymTokenBytes])
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+var testPseudonymKey = []byte("0123456789abcdef0123456789abcdef")
+
+var tokenPattern = regexp.MustCompile(`^k1:[0-9a-f]{32}$`)
+
+func TestPseudonymize_Paths(t *testing.T) {
+	proc, err := NewPseudonymizeProcessor(PseudonymizeConfig{
+		Name:  "pseudo",
+		Paths: []string{"user/email", "user/id", "missing/path"},
+		KeyID: "k1",
+		Key:   testPseudonymKey,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	out, drop, err := proc.Process(nil, []byte(`{"user":{"email":"bob@example.com","id":42},"msg":"login"}`))
+	if err != nil || drop {
+		t.Fatalf("Process() drop=%v err=%v", drop, err)
+	}
+	if !gjson.ValidBytes(out) {
+		t.Fatalf("Process() produced invalid JSON: %s", out)
+	}
+
+	email := gjson.GetBytes(out, "user.email").String()
+	id := gjson.GetBytes(out, "user.id").String()
+	if !tokenPattern.MatchString(email) || !tokenPattern.MatchString(id) {
+		t.Errorf("Expected tokens, got email=%q id=%q", email, id)
+	}
+	if email == id {
+		t.Errorf("Different values produced the same token %q", email)
+	}
+	if msg := gjson.GetBytes(out, "msg").String(); msg != "login" {
+		t.Errorf("msg = %q, want %q", msg, "login")
+	}
+}
+
+func TestPseudonymize_Deterministic(t *testing.T) {
+	newProc := func(kid string, key []byte) *PseudonymizeProcessor {
+		proc, err := NewPseudonymizeProcessor(PseudonymizeConfig{
+			Name:  "pseudo",
+			Paths: []string{"user"},
+			KeyID: kid,
+			Key:   key,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		return proc
+	}
+	token := func(proc *PseudonymizeProcessor, entry string) string {
+		out, _, _ := proc.Process(nil, []byte(entry))
+		return gjson.GetBytes(out, "user").String()
+	}
+
+	a := newProc("k1", testPseudonymKey)
+	first := token(a, `{"user":"alice"}`)
+	if got := token(a, `{"msg":"other","user":"alice"}`); got != first {
+		t.Errorf("Same value produced different tokens: %q vs %q", first, got)
+	}
+	// Escaped and unescaped forms of the same string are the same value.
+	if got := token(a, `{"user":"\u0061lice"}`); got != first {
+		t.Errorf("Escaped value produced a different token: %q vs %q", first, got)
+	}
+
+	rotated := newProc("k2", []byte("fedcba9876543210fedcba9876543210"))
+	got := token(rotated, `{"user":"alice"}`)
+	if !strings.HasPrefix(got, "k2:") {
+		t.Errorf("Rotated token %q should carry the new key id", got)
+	}
+	if got[3:] == first[3:] {
+		t.Errorf("Different keys produced the same digest")
+	}
+}
+
+func TestPseudonymize_Regex(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		groups  []string
+		input   string
+		want    *regexp.Regexp
+	}{
+		{
+			name:    "whole match",
+			pattern: `[\w.]+@[\w.]+`,
+			input:   "login bob@example.com from web",
+			want:    regexp.MustCompile(`^login k1:[0-9a-f]{32} from web$`),
+		},
+		{
+			name:    "named group",
+			pattern: `user=(?P<user>\w+)`,
+			groups:  []string{"user"},
+			input:   "user=bob action=login user=eve",
+			want:    regexp.MustCompile(`^user=k1:[0-9a-f]{32} action=login user=k1:[0-9a-f]{32}$`),
+		},
+		{
+			name:    "no match",
+			pattern: `user=(?P<user>\w+)`,
+			groups:  []string{"user"},
+			input:   "anonymous request",
+			want:    regexp.MustCompile(`^anonymous request$`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc, err := NewPseudonymizeProcessor(PseudonymizeConfig{
+				Name:    "pseudo",
+				Pattern: tt.pattern,
+				Groups:  tt.groups,
+				KeyID:   "k1",
+				Key:     testPseudonymKey,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			out, _, _ := proc.Process(nil, []byte(tt.input))
+			if !tt.want.Match(out) {
+				t.Errorf("Process() = %q, want match for %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestPseudonymize_InvalidConfig(t *testing.T) {
+	bad := []PseudonymizeConfig{
+		{KeyID: "k1", Key: testPseudonymKey},                                        // nothing to replace
+		{Paths: []string{"user"}, Key: testPseudonymKey},                            // no key id
+		{Paths: []string{"user"}, KeyID: "k:1", Key: testPseudonymKey},              // separator in key id
+		{Paths: []string{"user"}, KeyID: "k1", Key: []byte("short")},                // weak key
+		{Pattern: `(\d+`, KeyID: "k1", Key: testPseudonymKey},                       // bad regex
+		{Pattern: `\d+`, Groups: []string{"x"}, KeyID: "k1", Key: testPseudonymKey}, // unknown group
+	}
+	for _, cfg := range bad {
+		if _, err := NewPseudonymizeProcessor(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
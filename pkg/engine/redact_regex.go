@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// defaultRedactReplacement is used when no replacement is configured.
+const defaultRedactReplacement = "[REDACTED]"
+
+// RegexRedactionConfig holds configuration for creating a RegexRedactionProcessor.
+type RegexRedactionConfig struct {
+	Name    string
+	Pattern string // RE2 syntax, compiled once at build time
+
+	// Replacement is a template in regexp.Expand syntax ($1, ${name}), so
+	// "XXX-XX-${last4}" keeps a captured group. Defaults to "[REDACTED]".
+	Replacement string
+
+	// Groups limits masking to these named capture groups; the rest of the
+	// match is kept as-is. Empty means the whole match is masked.
+	Groups []string
+
+	// MaskChar, if set, masks each character of the target with this string
+	// (length-preserving) instead of using Replacement.
+	MaskChar string
+}
+
+// RegexRedactionProcessor masks regex matches, either as a whole or only
+// selected named capture groups.
+type RegexRedactionProcessor struct {
+	name     string
+	re       *regexp.Regexp
+	template []byte
+	groups   []int // submatch indexes to mask, ascending; nil = whole match
+	maskChar []byte
+}
+
+// NewRegexRedactionProcessor compiles the pattern and validates group names.
+func NewRegexRedactionProcessor(cfg RegexRedactionConfig) (*RegexRedactionProcessor, error) {
+	if cfg.Pattern == "" {
+		return nil, fmt.Errorf("pattern must be specified")
+	}
+	re, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex pattern: %w", err)
+	}
+
+	replacement := cfg.Replacement
+	if replacement == "" {
+		replacement = defaultRedactReplacement
+	}
+
+	p := &RegexRedactionProcessor{
+		name:     cfg.Name,
+		re:       re,
+		template: []byte(replacement),
+		maskChar: []byte(cfg.MaskChar),
+	}
+
+	for _, g := range cfg.Groups {
+		idx := re.SubexpIndex(g)
+		if idx < 0 {
+			return nil, fmt.Errorf("pattern has no named group %q", g)
+		}
+		p.groups = append(p.groups, idx)
+	}
+	// Submatch indexes follow the order of opening parens, which is also the
+	// order groups appear in the text (nested groups are skipped in Process).
+	sort.Ints(p.groups)
+
+	return p, nil
+}
+
+func (r *RegexRedactionProcessor) Name() string {
+	return r.name
+}
+
+func (r *RegexRedactionProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
+	matches := r.re.FindAllSubmatchIndex(entry, -1)
+	if matches == nil {
+		return entry, false, nil // no match, no allocation
+	}
+
+	out := make([]byte, 0, len(entry))
+	last := 0
+	for _, m := range matches {
+		if r.groups == nil {
+			out = append(out, entry[last:m[0]]...)
+			out = r.mask(out, entry, m, m[0], m[1])
+			last = m[1]
+			continue
+		}
+
+		for _, g := range r.groups {
+			start, end := m[2*g], m[2*g+1]
+			if start < 0 || start < last {
+				// Group didn't participate, or is nested in one already masked.
+				continue
+			}
+			out = append(out, entry[last:start]...)
+			out = r.mask(out, entry, m, start, end)
+			last = end
+		}
+	}
+	out = append(out, entry[last:]...)
+
+	return out, false, nil
+}
+
+// mask appends the masked form of entry[start:end] to dst.
+func (r *RegexRedactionProcessor) mask(dst, entry []byte, match []int, start, end int) []byte {
+	if len(r.maskChar) > 0 {
+		for n := utf8.RuneCount(entry[start:end]); n > 0; n-- {
+			dst = append(dst, r.maskChar...)
+		}
+		return dst
+	}
+	return r.re.Expand(dst, r.template, entry, match)
+}
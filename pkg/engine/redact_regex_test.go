@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestRegexRedaction_WholeMatch(t *testing.T) {
+	proc, err := NewRegexRedactionProcessor(RegexRedactionConfig{
+		Name:        "ssn",
+		Pattern:     `\d{3}-\d{2}-\d{4}`,
+		Replacement: "XXX-XX-XXXX",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "single match",
+			input: "SSN: 123-45-6789",
+			want:  "SSN: XXX-XX-XXXX",
+		},
+		{
+			name:  "multiple matches",
+			input: `{"a":"111-22-3333","b":"444-55-6666"}`,
+			want:  `{"a":"XXX-XX-XXXX","b":"XXX-XX-XXXX"}`,
+		},
+		{
+			name:  "no match - unchanged",
+			input: "nothing to see here",
+			want:  "nothing to see here",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, drop, err := proc.Process(nil, []byte(tt.input))
+			if err != nil || drop {
+				t.Fatalf("Process() drop=%v err=%v", drop, err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("Process() = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegexRedaction_ReplacementTemplate(t *testing.T) {
+	// Keep the last 4 digits.
+	proc, err := NewRegexRedactionProcessor(RegexRedactionConfig{
+		Name:        "ssn_last4",
+		Pattern:     `\b\d{3}-\d{2}-(?P<last4>\d{4})\b`,
+		Replacement: "XXX-XX-${last4}",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	out, _, _ := proc.Process(nil, []byte("SSN 123-45-6789 and 987-65-4321"))
+	if want := "SSN XXX-XX-6789 and XXX-XX-4321"; string(out) != want {
+		t.Errorf("Process() = %q, want %q", out, want)
+	}
+}
+
+func TestRegexRedaction_NamedGroupsOnly(t *testing.T) {
+	proc, err := NewRegexRedactionProcessor(RegexRedactionConfig{
+		Name:     "email_user",
+		Pattern:  `(?P<user>[\w.+-]+)@(?P<domain>[\w-]+\.[\w.]+)`,
+		Groups:   []string{"user"},
+		MaskChar: "*",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	out, _, _ := proc.Process(nil, []byte("from bob.smith@example.com to al@test.io"))
+	if want := "from *********@example.com to **@test.io"; string(out) != want {
+		t.Errorf("Process() = %q, want %q", out, want)
+	}
+}
+
+func TestRegexRedaction_MultipleGroupsWithTemplate(t *testing.T) {
+	// Mask both halves of a card number but keep the separator and last 4.
+	proc, err := NewRegexRedactionProcessor(RegexRedactionConfig{
+		Name:        "card",
+		Pattern:     `(?P<a>\d{4})-(?P<b>\d{4})-(?P<c>\d{4})-\d{4}`,
+		Groups:      []string{"c", "a"}, // order in config doesn't matter
+		Replacement: "####",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	out, _, _ := proc.Process(nil, []byte("card=4111-1111-1111-1234;"))
+	if want := "card=####-1111-####-1234;"; string(out) != want {
+		t.Errorf("Process() = %q, want %q", out, want)
+	}
+}
+
+func TestRegexRedaction_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  RegexRedactionConfig
+	}{
+		{"empty pattern", RegexRedactionConfig{}},
+		{"invalid regex", RegexRedactionConfig{Pattern: `(\d+`}},
+		{"unknown group", RegexRedactionConfig{Pattern: `(?P<x>\d+)`, Groups: []string{"y"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRegexRedactionProcessor(tt.cfg); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"path"
+	"streamgate/pkg/model"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// RouteConfig holds the match conditions for sending entries to a pipeline.
+// Every non-empty condition must hold (AND). A config with no conditions
+// matches everything, which makes it a catch-all.
+type RouteConfig struct {
+	Listener string // ingestor name, e.g. "tcp" or "udp"
+	Source   string // sender IP or CIDR, e.g. "10.0.0.0/8"
+	Identity string // verified TLS client identity, a path.Match glob, e.g. "*.payments.internal"
+
+	// Optional attribute match, same semantics as AttributeFilterProcessor.
+	Attribute string
+	Path      string
+	Operator  Operator
+	Value     string
+}
+
+// Route sends entries matching its conditions to a pipeline.
+type Route struct {
+	name     string
+	pipeline *Pipeline
+
+	listener string
+	source   netip.Prefix              // zero value = any source
+	identity string                    // glob; "" = any (or no) identity
+	attr     *AttributeFilterProcessor // nil = no attribute condition
+}
+
+// NewRoute compiles a route to the named pipeline.
+func NewRoute(name string, pipeline *Pipeline, cfg RouteConfig) (*Route, error) {
+	r := &Route{
+		name:     name,
+		pipeline: pipeline,
+		listener: cfg.Listener,
+		identity: cfg.Identity,
+	}
+	if _, err := path.Match(cfg.Identity, ""); err != nil {
+		return nil, fmt.Errorf("route %s: invalid identity pattern %q: %w", name, cfg.Identity, err)
+	}
+
+	if cfg.Source != "" {
+		prefix, err := parseSourcePrefix(cfg.Source)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", name, err)
+		}
+		r.source = prefix
+	}
+
+	if cfg.Attribute != "" || cfg.Path != "" {
+		attr, err := NewAttributeFilterProcessor(AttributeFilterConfig{
+			Name:      name,
+			Attribute: cfg.Attribute,
+			Path:      cfg.Path,
+			Operator:  cfg.Operator,
+			Value:     cfg.Value,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", name, err)
+		}
+		r.attr = attr
+	}
+
+	return r, nil
+}
+
+// Name returns the name of the pipeline this route feeds.
+func (r *Route) Name() string {
+	return r.name
+}
+
+// parseSourcePrefix accepts either a CIDR or a single IP.
+func parseSourcePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid source CIDR %q: %w", s, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid source address %q: %w", s, err)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// sourceAddr extracts the IP from a "host:port" (or bare host) address.
+func sourceAddr(addr string) (netip.Addr, bool) {
+	if ap, err := netip.ParseAddrPort(addr); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	if a, err := netip.ParseAddr(addr); err == nil {
+		return a.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+func (r *Route) matches(e *model.LogEntry) bool {
+	if r.listener != "" && r.listener != e.Source.Listener {
+		return false
+	}
+	if r.source.IsValid() {
+		addr, ok := sourceAddr(e.Source.Addr)
+		if !ok || !r.source.Contains(addr) {
+			return false
+		}
+	}
+	if r.identity != "" {
+		// An unauthenticated sender never matches, not even "*".
+		if ok, _ := path.Match(r.identity, e.Source.Identity); !ok || e.Source.Identity == "" {
+			return false
+		}
+	}
+	if r.attr != nil && !r.attr.matches(e) {
+		return false
+	}
+	return true
+}
+
+// Router pops entries from the ingest buffer and hands each one to the first
+// route that matches, in manifest order. Entries that match no route are
+// dropped and counted.
+//
+// When the matching pipeline's buffer is full the router waits for it, so a
+// slow pipeline backs up into the ingest buffer, where the listeners that
+// push back (HTTP 429, Forward acks, the file tailer) can see it.
+type Router struct {
+	input *RingBuffer
+
+	// mu is held for reading while one entry is routed, and for writing while
+	// the route table is swapped. Once Update returns, no entry can still be on
+	// its way to a pipeline that was removed, so the caller may stop it.
+	mu     sync.RWMutex
+	routes []*Route
+
+	unrouted atomic.Uint64
+	dropped  atomic.Uint64 // routed, but shut down while waiting for the pipeline
+}
+
+func NewRouter(input *RingBuffer) *Router {
+	return &Router{input: input}
+}
+
+// Update atomically replaces the route table.
+func (r *Router) Update(routes []*Route) {
+	r.mu.Lock()
+	r.routes = routes
+	r.mu.Unlock()
+
+	names := make([]string, len(routes))
+	for i, rt := range routes {
+		names[i] = rt.name
+	}
+	log.Printf("Router: Routes updated: %v", names)
+}
+
+// UnroutedCount returns the number of entries that matched no route.
+func (r *Router) UnroutedCount() uint64 {
+	return r.unrouted.Load()
+}
+
+// DroppedCount returns the number of routed entries lost because shutdown
+// came while they were waiting for room in their pipeline's buffer.
+func (r *Router) DroppedCount() uint64 {
+	return r.dropped.Load()
+}
+
+// Start launches the routing loop. It returns immediately.
+func (r *Router) Start(ctx context.Context) {
+	log.Println("Starting Router...")
+	go r.run(ctx)
+}
+
+func (r *Router) run(ctx context.Context) {
+	done := ctx.Done()
+	for {
+		item, src := r.input.PopWaitFrom(done, nil)
+		if item == nil {
+			if n := r.dropped.Load(); n > 0 {
+				log.Printf("Router: %d entries lost waiting for a full pipeline at shutdown", n)
+			}
+			return // ctx cancelled
+		}
+		r.route(done, item, src)
+	}
+}
+
+// route waits for room in the pipeline's buffer while holding mu for
+// reading, so Update also waits for that entry before the old pipeline can
+// be stopped. done abandons the wait.
+func (r *Router) route(done <-chan struct{}, item []byte, src model.Source) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Shared by all routes, so attribute conditions parse the entry once.
+	e := model.LogEntry{Raw: item, Source: src}
+	for _, rt := range r.routes {
+		if rt.matches(&e) {
+			if err := rt.pipeline.buffer.PushWaitFrom(item, src, done); err != nil {
+				r.dropped.Add(1)
+			}
+			return
+		}
+	}
+	r.unrouted.Add(1)
+}
@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"streamgate/pkg/model"
+	"testing"
+	"time"
+)
+
+func newTestPipeline(t *testing.T) (*Pipeline, *MockOutput) {
+	t.Helper()
+	buf, _ := NewRingBuffer(256)
+	out := &MockOutput{}
+	p := NewPipeline(buf, NewProcessorChain(), out)
+	p.UpdateBatchSize(1)
+	return p, out
+}
+
+func mustRoute(t *testing.T, name string, p *Pipeline, cfg RouteConfig) *Route {
+	t.Helper()
+	r, err := NewRoute(name, p, cfg)
+	if err != nil {
+		t.Fatalf("NewRoute(%s) error: %v", name, err)
+	}
+	return r
+}
+
+func TestRoute_Matches(t *testing.T) {
+	p, _ := newTestPipeline(t)
+
+	tests := []struct {
+		name  string
+		cfg   RouteConfig
+		entry string
+		src   model.Source
+		want  bool
+	}{
+		{
+			name: "catch-all",
+			cfg:  RouteConfig{},
+			src:  model.Source{Listener: "udp"},
+			want: true,
+		},
+		{
+			name: "listener match",
+			cfg:  RouteConfig{Listener: "tcp"},
+			src:  model.Source{Listener: "tcp", Addr: "10.1.2.3:5000"},
+			want: true,
+		},
+		{
+			name: "listener mismatch",
+			cfg:  RouteConfig{Listener: "tcp"},
+			src:  model.Source{Listener: "udp"},
+			want: false,
+		},
+		{
+			name: "source in CIDR",
+			cfg:  RouteConfig{Source: "10.0.0.0/8"},
+			src:  model.Source{Addr: "10.1.2.3:5000"},
+			want: true,
+		},
+		{
+			name: "source outside CIDR",
+			cfg:  RouteConfig{Source: "10.0.0.0/8"},
+			src:  model.Source{Addr: "192.168.1.1:5000"},
+			want: false,
+		},
+		{
+			name: "source single IPv6",
+			cfg:  RouteConfig{Source: "::1"},
+			src:  model.Source{Addr: "[::1]:5000"},
+			want: true,
+		},
+		{
+			name: "source unknown address",
+			cfg:  RouteConfig{Source: "10.0.0.0/8"},
+			src:  model.Source{},
+			want: false,
+		},
+		{
+			name: "identity glob match",
+			cfg:  RouteConfig{Identity: "*.payments"},
+			src:  model.Source{Listener: "tcp", Identity: "billing.payments"},
+			want: true,
+		},
+		{
+			name: "identity mismatch",
+			cfg:  RouteConfig{Identity: "*.payments"},
+			src:  model.Source{Listener: "tcp", Identity: "web.frontend"},
+			want: false,
+		},
+		{
+			name: "identity required",
+			cfg:  RouteConfig{Identity: "*"},
+			src:  model.Source{Listener: "tcp"},
+			want: false,
+		},
+		{
+			name:  "attribute match",
+			cfg:   RouteConfig{Attribute: "service.name", Value: "audit"},
+			entry: `{"resource":{"attributes":{"service.name":"audit"}}}`,
+			want:  true,
+		},
+		{
+			name:  "attribute and listener must both match",
+			cfg:   RouteConfig{Listener: "tcp", Attribute: "service.name", Value: "audit"},
+			entry: `{"service.name":"audit"}`,
+			src:   model.Source{Listener: "udp"},
+			want:  false,
+		},
+		{
+			name:  "attribute missing",
+			cfg:   RouteConfig{Attribute: "service.name", Value: "audit"},
+			entry: `not json`,
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mustRoute(t, "r", p, tt.cfg)
+			if got := r.matches(model.NewLogEntry([]byte(tt.entry), tt.src)); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRoute_InvalidConfig(t *testing.T) {
+	p, _ := newTestPipeline(t)
+	bad := []RouteConfig{
+		{Source: "10.0.0.0/99"},
+		{Source: "not-an-ip"},
+		{Attribute: "a", Path: "b"},
+		{Attribute: "a", Operator: OpRegex, Value: "[bad"},
+		{Identity: "[bad"},
+	}
+	for _, cfg := range bad {
+		if _, err := NewRoute("bad", p, cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestRouter_FirstMatchWins(t *testing.T) {
+	audit, auditOut := newTestPipeline(t)
+	app, appOut := newTestPipeline(t)
+	udpOnly, udpOut := newTestPipeline(t)
+
+	ingest, _ := NewRingBuffer(256)
+	router := NewRouter(ingest)
+	router.Update([]*Route{
+		mustRoute(t, "audit", audit, RouteConfig{Attribute: "log.type", Value: "audit"}),
+		mustRoute(t, "udp", udpOnly, RouteConfig{Listener: "udp"}),
+		mustRoute(t, "app", app, RouteConfig{Listener: "tcp"}),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, p := range []*Pipeline{audit, app, udpOnly} {
+		p.Start(ctx)
+	}
+	router.Start(ctx)
+
+	tcp := model.Source{Listener: "tcp", Addr: "10.0.0.1:1234"}
+	udp := model.Source{Listener: "udp", Addr: "10.0.0.2:1234"}
+	_ = ingest.PushFrom([]byte(`{"log.type":"audit","msg":"tcp audit"}`), tcp)
+	_ = ingest.PushFrom([]byte(`{"log.type":"audit","msg":"udp audit"}`), udp)
+	_ = ingest.PushFrom([]byte(`app line`), tcp)
+	_ = ingest.PushFrom([]byte(`udp line`), udp)
+	_ = ingest.PushFrom([]byte(`unrouted`), model.Source{Listener: "http"})
+
+	if got := waitForCount(auditOut, 2, time.Second); len(got) != 2 {
+		t.Errorf("audit pipeline got %d entries, want 2", len(got))
+	}
+	if got := waitForCount(appOut, 1, time.Second); len(got) != 1 || string(got[0]) != "app line" {
+		t.Errorf("app pipeline got %q, want [app line]", got)
+	}
+	if got := waitForCount(udpOut, 1, time.Second); len(got) != 1 || string(got[0]) != "udp line" {
+		t.Errorf("udp pipeline got %q, want [udp line]", got)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for router.UnroutedCount() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := router.UnroutedCount(); n != 1 {
+		t.Errorf("UnroutedCount() = %d, want 1", n)
+	}
+}
+
+func TestRouter_WaitsForFullPipeline(t *testing.T) {
+	buf, _ := NewRingBuffer(2)
+	out := &MockOutput{}
+	p := NewPipeline(buf, NewProcessorChain(), out)
+	p.UpdateBatchSize(1)
+
+	ingest, _ := NewRingBuffer(8)
+	router := NewRouter(ingest)
+	router.Update([]*Route{mustRoute(t, "all", p, RouteConfig{})})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router.Start(ctx)
+	for i := 0; i < 5; i++ {
+		_ = ingest.Push([]byte(fmt.Sprintf("line %d", i)))
+	}
+
+	// The pipeline isn't running: two entries fill its buffer, the router
+	// holds a third and the rest stay in the ingest buffer.
+	deadline := time.Now().Add(time.Second)
+	for ingest.Usage() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := ingest.Usage(); n != 2 {
+		t.Fatalf("ingest usage = %d, want 2", n)
+	}
+
+	p.Start(ctx)
+	if got := waitForCount(out, 5, time.Second); len(got) != 5 {
+		t.Errorf("pipeline got %d entries, want 5", len(got))
+	}
+	if n := buf.DroppedCount() + router.DroppedCount(); n != 0 {
+		t.Errorf("dropped %d entries", n)
+	}
+}
+
+func TestPipeline_StopDrainsBuffer(t *testing.T) {
+	p, out := newTestPipeline(t)
+	p.UpdateBatchSize(1000) // only the final flush writes
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.Start(ctx)
+
+	for i := 0; i < 50; i++ {
+		_ = p.buffer.Push([]byte("entry"))
+	}
+	p.Stop()
+
+	if got := len(out.Snapshot()); got != 50 {
+		t.Errorf("Expected Stop to flush 50 entries, got %d", got)
+	}
+
+	// Stop is idempotent.
+	p.Stop()
+}
@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"streamgate/pkg/model"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// SampleMode selects how the keep decision is made.
+type SampleMode string
+
+const (
+	// SampleRandom keeps each entry independently with probability rate.
+	SampleRandom SampleMode = "random"
+
+	// SampleHash keeps an entry when a hash of its key attribute falls below
+	// rate, so every entry sharing a key (e.g. one trace) is kept or dropped
+	// together, on every StreamGate instance.
+	SampleHash SampleMode = "hash"
+)
+
+// defaultSampleRateField is the field kept entries are annotated with.
+const defaultSampleRateField = "sample_rate"
+
+// severityAttribute is resolved through the well-known OTel paths
+// (severity, severityText, level, ...).
+const severityAttribute = "log.level"
+
+// SampleConfig holds configuration for creating a SampleProcessor.
+// The rate for an entry is, in order of precedence: AttributeRates for the
+// value of Attribute, SeverityRates for its severity, then Rate.
+type SampleConfig struct {
+	Name string
+	Mode SampleMode // defaults to SampleRandom
+	Rate float64    // keep probability, 0..1
+
+	// Key is the attribute hashed in SampleHash mode (e.g. "trace_id").
+	// Entries without it fall back to a random decision.
+	Key string
+
+	SeverityRates  map[string]float64 // keyed by lowercase severity, e.g. "debug"
+	Attribute      string
+	AttributeRates map[string]float64 // keyed by the value of Attribute
+
+	// Field is the top-level JSON field kept entries are annotated with.
+	// Defaults to "sample_rate".
+	Field string
+}
+
+// SampleProcessor keeps a fraction of entries and drops the rest.
+// Kept JSON entries sampled at a rate below 1 are annotated with that rate, so
+// downstream counts can be re-weighted (each kept entry stands for 1/rate).
+// If an entry already carries a rate from an earlier stage, the two are
+// multiplied. Non-JSON entries are sampled but not annotated.
+type SampleProcessor struct {
+	name           string
+	mode           SampleMode
+	rate           float64
+	key            attrLookup
+	severityRates  map[string]float64
+	severity       attrLookup
+	attr           attrLookup
+	attributeRates map[string]float64
+	field          string
+	fieldPath      string
+}
+
+// NewSampleProcessor validates the mode and rates.
+func NewSampleProcessor(cfg SampleConfig) (*SampleProcessor, error) {
+	p := &SampleProcessor{
+		name:           cfg.Name,
+		mode:           cfg.Mode,
+		rate:           cfg.Rate,
+		key:            newAttrLookup(cfg.Key),
+		severityRates:  make(map[string]float64, len(cfg.SeverityRates)),
+		severity:       newAttrLookup(severityAttribute),
+		attr:           newAttrLookup(cfg.Attribute),
+		attributeRates: cfg.AttributeRates,
+		field:          cfg.Field,
+	}
+
+	switch p.mode {
+	case "":
+		p.mode = SampleRandom
+	case SampleRandom:
+	case SampleHash:
+		if cfg.Key == "" {
+			return nil, fmt.Errorf("hash mode requires a key attribute")
+		}
+	default:
+		return nil, fmt.Errorf("unknown sample mode %q", cfg.Mode)
+	}
+
+	if err := validRate(cfg.Rate); err != nil {
+		return nil, err
+	}
+	for level, rate := range cfg.SeverityRates {
+		if err := validRate(rate); err != nil {
+			return nil, fmt.Errorf("severity %s: %w", level, err)
+		}
+		p.severityRates[strings.ToLower(level)] = rate
+	}
+	if len(cfg.AttributeRates) > 0 && cfg.Attribute == "" {
+		return nil, fmt.Errorf("attribute rates require an attribute")
+	}
+	for value, rate := range cfg.AttributeRates {
+		if err := validRate(rate); err != nil {
+			return nil, fmt.Errorf("attribute value %s: %w", value, err)
+		}
+	}
+
+	if p.field == "" {
+		p.field = defaultSampleRateField
+	}
+	if strings.ContainsAny(p.field, "\"\\") {
+		return nil, fmt.Errorf("invalid annotation field %q", p.field)
+	}
+	p.fieldPath = escapeGjsonKey(p.field)
+
+	return p, nil
+}
+
+func validRate(rate float64) error {
+	if math.IsNaN(rate) || rate < 0 || rate > 1 {
+		return fmt.Errorf("rate must be between 0 and 1, got %v", rate)
+	}
+	return nil
+}
+
+func (p *SampleProcessor) Name() string {
+	return p.name
+}
+
+func (p *SampleProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
+	return processRaw(p, ctx, entry)
+}
+
+// ProcessEntry is Process on the shared envelope.
+func (p *SampleProcessor) ProcessEntry(ctx *ProcessingContext, e *model.LogEntry) (bool, error) {
+	isObject := isObjectEntry(e)
+
+	rate := p.rateFor(e, isObject)
+	if rate >= 1 {
+		return false, nil
+	}
+	if rate <= 0 || !p.keep(e, rate, isObject) {
+		return true, nil
+	}
+	if isObject {
+		p.annotate(e, rate)
+	}
+	return false, nil
+}
+
+// rateFor picks the most specific configured rate for the entry.
+func (p *SampleProcessor) rateFor(e *model.LogEntry, isObject bool) float64 {
+	if !isObject {
+		return p.rate
+	}
+	if len(p.attributeRates) > 0 {
+		if v := p.attr.get(e); v.Exists() {
+			if rate, ok := p.attributeRates[v.String()]; ok {
+				return rate
+			}
+		}
+	}
+	if len(p.severityRates) > 0 {
+		if v := p.severity.get(e); v.Exists() {
+			if rate, ok := p.severityRates[strings.ToLower(v.String())]; ok {
+				return rate
+			}
+		}
+	}
+	return p.rate
+}
+
+func (p *SampleProcessor) keep(e *model.LogEntry, rate float64, isObject bool) bool {
+	if p.mode == SampleHash && isObject {
+		if v := p.key.get(e); v.Exists() {
+			return hashFraction(v.String()) < rate
+		}
+	}
+	return rand.Float64() < rate
+}
+
+// hashFraction maps a key to [0, 1). It must stay stable across releases and
+// instances, or traces sampled by two collectors would be split.
+func hashFraction(key string) float64 {
+	h := mix64(hashString(key))
+	return float64(h>>11) / (1 << 53)
+}
+
+// mix64 is the splitmix64 finalizer. FNV-1a alone leaves similar keys (e.g.
+// sequential trace IDs) clustered; mixing spreads them over the whole range.
+func mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// annotate records the effective sample rate on a kept entry.
+func (p *SampleProcessor) annotate(e *model.LogEntry, rate float64) {
+	if prev := e.Get(p.fieldPath); prev.Type == gjson.Number {
+		if r := prev.Float(); r > 0 && r <= 1 {
+			rate *= r
+		}
+	}
+	setEntryField(e, p.field, strconv.AppendFloat(nil, rate, 'g', -1, 64))
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"streamgate/pkg/model"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func newSample(t *testing.T, cfg SampleConfig) *SampleProcessor {
+	t.Helper()
+	proc, err := NewSampleProcessor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	return proc
+}
+
+func TestSample_RandomRate(t *testing.T) {
+	proc := newSample(t, SampleConfig{Name: "sample", Rate: 0.25})
+
+	const n = 20000
+	kept := 0
+	for i := 0; i < n; i++ {
+		if _, drop, _ := proc.Process(nil, []byte(`{"msg":"hello"}`)); !drop {
+			kept++
+		}
+	}
+	if got := float64(kept) / n; math.Abs(got-0.25) > 0.02 {
+		t.Errorf("Kept fraction = %.3f, want ~0.25", got)
+	}
+}
+
+func TestSample_EdgeRates(t *testing.T) {
+	input := []byte(`{"msg":"hello"}`)
+
+	all := newSample(t, SampleConfig{Name: "all", Rate: 1})
+	out, drop, _ := all.Process(nil, input)
+	if drop || string(out) != string(input) {
+		t.Errorf("Rate 1: Process() = %q, drop=%v; want entry unchanged", out, drop)
+	}
+
+	none := newSample(t, SampleConfig{Name: "none", Rate: 0})
+	if _, drop, _ := none.Process(nil, input); !drop {
+		t.Errorf("Rate 0: expected drop")
+	}
+}
+
+func TestSample_HashConsistent(t *testing.T) {
+	proc := newSample(t, SampleConfig{Name: "sample", Mode: SampleHash, Rate: 0.5, Key: "trace_id"})
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		traceID := fmt.Sprintf("trace-%d", i)
+		_, first, _ := proc.Process(nil, []byte(`{"trace_id":"`+traceID+`","msg":"start"}`))
+		for j := 0; j < 5; j++ {
+			entry := fmt.Sprintf(`{"trace_id":%q,"msg":"span %d"}`, traceID, j)
+			if _, drop, _ := proc.Process(nil, []byte(entry)); drop != first {
+				t.Fatalf("Trace %s split: first drop=%v, span %d drop=%v", traceID, first, j, drop)
+			}
+		}
+		if !first {
+			kept++
+		}
+	}
+	// Sequential IDs must still spread evenly.
+	if kept < 400 || kept > 600 {
+		t.Errorf("Kept %d of 1000 traces, want ~500", kept)
+	}
+}
+
+func TestSample_RateOverrides(t *testing.T) {
+	proc := newSample(t, SampleConfig{
+		Name:           "sample",
+		Rate:           0.5,
+		SeverityRates:  map[string]float64{"DEBUG": 0, "error": 1},
+		Attribute:      "service.name",
+		AttributeRates: map[string]float64{"checkout": 1},
+	})
+
+	tests := []struct {
+		name  string
+		input string
+		rate  float64
+	}{
+		{"severity drop", `{"level":"debug","msg":"x"}`, 0},
+		{"severity keep", `{"severityText":"ERROR","msg":"x"}`, 1},
+		{"attribute beats severity", `{"level":"debug","service.name":"checkout"}`, 1},
+		{"default", `{"level":"info","msg":"x"}`, 0.5},
+		{"non-JSON", `plain text line`, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := model.NewLogEntry([]byte(tt.input), model.Source{})
+			if got := proc.rateFor(e, isObjectEntry(e)); got != tt.rate {
+				t.Errorf("rateFor() = %v, want %v", got, tt.rate)
+			}
+		})
+	}
+}
+
+func TestSample_Annotation(t *testing.T) {
+	proc := newSample(t, SampleConfig{Name: "sample", Mode: SampleHash, Rate: 0.999999, Key: "id"})
+
+	tests := []struct {
+		name  string
+		input string
+		want  float64
+	}{
+		{"appended", `{"id":"a","msg":"x"}`, 0.999999},
+		{"compounded", `{"id":"a","sample_rate":0.5}`, 0.4999995},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, drop, _ := proc.Process(nil, []byte(tt.input))
+			if drop {
+				t.Fatalf("Expected entry to be kept")
+			}
+			if !gjson.ValidBytes(out) {
+				t.Fatalf("Process() produced invalid JSON: %s", out)
+			}
+			if got := gjson.GetBytes(out, "sample_rate").Float(); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("sample_rate = %v, want %v (%s)", got, tt.want, out)
+			}
+		})
+	}
+
+	// Plain text is sampled but left untouched.
+	out, _, _ := proc.Process(nil, []byte("plain id=a"))
+	if string(out) != "plain id=a" {
+		t.Errorf("Non-JSON entry modified: %q", out)
+	}
+}
+
+func TestSetTopLevelField(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{`{"a":1}`, `{"a":1,"k":2}`, true},
+		{`{ }`, `{"k":2}`, true},
+		{`{"k":"old","a":1}`, `{"k":2,"a":1}`, true},
+		{`{"a":{"k":1}}`, `{"a":{"k":1},"k":2}`, true},
+		{`[1,2]`, `[1,2]`, false},
+		{`not json`, `not json`, false},
+	}
+	for _, tt := range tests {
+		out, ok := setTopLevelField([]byte(tt.input), "k", []byte("2"))
+		if string(out) != tt.want || ok != tt.ok {
+			t.Errorf("setTopLevelField(%s) = %s, %v; want %s, %v", tt.input, out, ok, tt.want, tt.ok)
+		}
+	}
+
+	// A new key is written as a JSON string, escapes and all.
+	out, _ := setTopLevelField([]byte(`{"a":1}`), `we"ird\`, []byte("2"))
+	if want := `{"a":1,"we\"ird\\":2}`; string(out) != want {
+		t.Errorf("setTopLevelField with a quoted key = %s, want %s", out, want)
+	}
+}
+
+func TestSample_InvalidConfig(t *testing.T) {
+	bad := []SampleConfig{
+		{Rate: 1.5},
+		{Rate: -0.1},
+		{Mode: "reservoir", Rate: 0.5},
+		{Mode: SampleHash, Rate: 0.5}, // no key
+		{Rate: 0.5, SeverityRates: map[string]float64{"debug": 2}},
+		{Rate: 0.5, AttributeRates: map[string]float64{"x": 0.1}}, // no attribute
+	}
+	for _, cfg := range bad {
+		if _, err := NewSampleProcessor(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"streamgate/pkg/model"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ShardKeyFunc maps an entry to a partition hash.
+// Entries with the same hash always land on the same worker, which keeps
+// them in order relative to each other.
+type ShardKeyFunc func(entry []byte, src model.Source) uint64
+
+const (
+	// ShardKeyHash partitions by a hash of the whole entry.
+	// It spreads load evenly but gives no cross-entry ordering guarantee.
+	ShardKeyHash = "hash"
+
+	// ShardKeySource partitions by the sender's host, so every entry from
+	// one host (across all of its connections) stays in order.
+	ShardKeySource = "source"
+)
+
+// newShardKeyFunc resolves a shard key spec from the manifest.
+// "" or "hash" hashes the whole entry, "source" hashes the sender's host;
+// anything else is treated as an attribute name and resolved like
+// AttributeFilterProcessor does (well-known OTel paths first, then generic
+// paths; "@source.identity" and friends read the entry's Source).
+func newShardKeyFunc(spec string) ShardKeyFunc {
+	switch spec {
+	case "", ShardKeyHash:
+		return entryShardKey
+	case ShardKeySource:
+		return sourceShardKey
+	default:
+		return attributeShardKey(spec)
+	}
+}
+
+func entryShardKey(entry []byte, _ model.Source) uint64 {
+	return hashBytes(entry)
+}
+
+// sourceShardKey hashes the host part of the sender address.
+// Entries without an address fall back to a hash of the whole entry.
+func sourceShardKey(entry []byte, src model.Source) uint64 {
+	if src.Addr == "" {
+		return hashBytes(entry)
+	}
+	host := src.Addr
+	if i := strings.LastIndexByte(host, ':'); i > 0 {
+		host = host[:i]
+	}
+	return hashString(host)
+}
+
+// attributeShardKey partitions by the value of an attribute.
+// Entries that don't carry the attribute (or aren't JSON) fall back to a hash
+// of the whole entry, so they are still spread across workers.
+func attributeShardKey(attr string) ShardKeyFunc {
+	lookup := newAttrLookup(attr)
+	return func(entry []byte, src model.Source) uint64 {
+		if lookup.source == nil && !gjson.ValidBytes(entry) {
+			return hashBytes(entry)
+		}
+		value := lookup.getBytes(entry, src)
+		if !value.Exists() {
+			return hashBytes(entry)
+		}
+		// Raw keeps number vs string distinct ("200" vs 200) without allocating.
+		return hashString(value.Raw)
+	}
+}
+
+// FNV-1a, inlined so hashing a key doesn't allocate a hash.Hash64.
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+func hashBytes(b []byte) uint64 {
+	h := uint64(fnvOffset64)
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= fnvPrime64
+	}
+	return h
+}
+
+func hashString(s string) uint64 {
+	return fnvAddString(fnvOffset64, s)
+}
+
+// fnvAddString folds s into a running FNV-1a hash, for multi-part keys.
+func fnvAddString(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+func fnvAddByte(h uint64, b byte) uint64 {
+	h ^= uint64(b)
+	return h * fnvPrime64
+}
@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"streamgate/pkg/model"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThrottleAction is what happens to an entry once its key is over the limit.
+type ThrottleAction string
+
+const (
+	ThrottleDrop   ThrottleAction = "drop"   // drop every over-limit entry
+	ThrottleSample ThrottleAction = "sample" // keep a fraction (SampleRate) of them
+	ThrottleTag    ThrottleAction = "tag"    // keep them all, marked with TagField
+)
+
+const (
+	defaultThrottleMaxKeys  = 10000
+	defaultThrottleWindow   = time.Minute
+	defaultThrottleTagField = "throttled"
+)
+
+// ThrottleConfig holds configuration for creating a ThrottleProcessor.
+type ThrottleConfig struct {
+	Name string
+
+	// Key source, as in AttributeFilterConfig: a well-known/generic attribute
+	// (auto-search) or an explicit "/" path. Entries without the key (or that
+	// aren't JSON) share one bucket.
+	Attribute string
+	Path      string
+
+	Rate  float64 // tokens per second, per key
+	Burst int     // bucket size; defaults to Rate rounded up (at least 1)
+
+	MaxKeys int // buckets kept before the least recently used is evicted
+
+	Action     ThrottleAction // defaults to ThrottleDrop
+	SampleRate float64        // for ThrottleSample, 0..1
+	TagField   string         // for ThrottleTag, defaults to "throttled"
+
+	// Window is how often a summary of over-limit counts is emitted.
+	Window time.Duration
+}
+
+// ThrottleProcessor applies a token-bucket limit per key, so one noisy
+// service can't crowd everyone else out of the buffer and the output.
+// At the end of each window it emits one JSON summary line with the
+// number of over-limit entries per key.
+type ThrottleProcessor struct {
+	name       string
+	lookup     attrLookup // attribute (auto-search) or explicit path
+	rate       float64
+	burst      float64
+	maxKeys    int
+	action     ThrottleAction
+	sampleRate float64
+	tagField   string
+	window     time.Duration
+
+	now func() time.Time // overridable for tests
+
+	mu          sync.Mutex
+	buckets     map[string]*list.Element // of *tokenBucket
+	lru         *list.List               // front = most recently used
+	windowStart time.Time
+	overLimit   map[string]uint64 // per key, current window
+	overflow    uint64            // over-limit entries whose key didn't fit in overLimit
+}
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// Summary keys for entries that aren't attributed to a single key.
+const (
+	throttleNoKey    = "_unkeyed" // entries without the key attribute
+	throttleOtherKey = "_other"   // keys beyond MaxKeys in one window
+)
+
+// NewThrottleProcessor validates the config.
+func NewThrottleProcessor(cfg ThrottleConfig) (*ThrottleProcessor, error) {
+	if cfg.Attribute == "" && cfg.Path == "" {
+		return nil, fmt.Errorf("either attribute or path must be specified")
+	}
+	if cfg.Attribute != "" && cfg.Path != "" {
+		return nil, fmt.Errorf("cannot specify both attribute and path")
+	}
+	if cfg.Rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive, got %v", cfg.Rate)
+	}
+	if cfg.Burst < 0 || cfg.MaxKeys < 0 || cfg.Window < 0 {
+		return nil, fmt.Errorf("burst, max keys and window must not be negative")
+	}
+
+	p := &ThrottleProcessor{
+		name:       cfg.Name,
+		lookup:     newAttrLookup(cfg.Attribute),
+		rate:       cfg.Rate,
+		burst:      float64(cfg.Burst),
+		maxKeys:    cfg.MaxKeys,
+		action:     cfg.Action,
+		sampleRate: cfg.SampleRate,
+		tagField:   cfg.TagField,
+		window:     cfg.Window,
+		now:        time.Now,
+		buckets:    make(map[string]*list.Element),
+		lru:        list.New(),
+		overLimit:  make(map[string]uint64),
+	}
+	if cfg.Path != "" {
+		p.lookup = newPathLookup(cfg.Path)
+	}
+	if p.burst == 0 {
+		p.burst = max(1, math.Ceil(cfg.Rate))
+	}
+	if p.maxKeys == 0 {
+		p.maxKeys = defaultThrottleMaxKeys
+	}
+	if p.window == 0 {
+		p.window = defaultThrottleWindow
+	}
+
+	switch p.action {
+	case "":
+		p.action = ThrottleDrop
+	case ThrottleDrop:
+	case ThrottleSample:
+		if err := validRate(cfg.SampleRate); err != nil {
+			return nil, fmt.Errorf("sample rate: %w", err)
+		}
+	case ThrottleTag:
+		if p.tagField == "" {
+			p.tagField = defaultThrottleTagField
+		}
+		if strings.ContainsAny(p.tagField, "\"\\") {
+			return nil, fmt.Errorf("invalid tag field %q", p.tagField)
+		}
+	default:
+		return nil, fmt.Errorf("unknown throttle action %q", cfg.Action)
+	}
+
+	return p, nil
+}
+
+func (p *ThrottleProcessor) Name() string {
+	return p.name
+}
+
+func (p *ThrottleProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
+	return processRaw(p, ctx, entry)
+}
+
+// ProcessEntry is Process on the shared envelope.
+func (p *ThrottleProcessor) ProcessEntry(ctx *ProcessingContext, e *model.LogEntry) (bool, error) {
+	if p.allow(p.key(e)) {
+		return false, nil
+	}
+
+	switch p.action {
+	case ThrottleSample:
+		return rand.Float64() >= p.sampleRate, nil
+	case ThrottleTag:
+		setEntryField(e, p.tagField, []byte("true"))
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+// key extracts the throttle key. "" is the shared bucket for entries without one.
+func (p *ThrottleProcessor) key(e *model.LogEntry) string {
+	if !e.IsJSON() {
+		return ""
+	}
+	return p.lookup.get(e).String()
+}
+
+// allow takes a token from key's bucket, counting the entry if none is left.
+func (p *ThrottleProcessor) allow(key string) bool {
+	now := p.now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b *tokenBucket
+	if elem, ok := p.buckets[key]; ok {
+		p.lru.MoveToFront(elem)
+		b = elem.Value.(*tokenBucket)
+		b.tokens = min(p.burst, b.tokens+now.Sub(b.last).Seconds()*p.rate)
+		b.last = now
+	} else {
+		if p.lru.Len() >= p.maxKeys {
+			// Evicting a key hands it a fresh (full) bucket if it comes back,
+			// so MaxKeys must comfortably exceed the number of active keys.
+			oldest := p.lru.Back()
+			p.lru.Remove(oldest)
+			delete(p.buckets, oldest.Value.(*tokenBucket).key)
+		}
+		b = &tokenBucket{key: key, tokens: p.burst, last: now}
+		p.buckets[key] = p.lru.PushFront(b)
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+
+	if _, ok := p.overLimit[key]; ok || len(p.overLimit) < p.maxKeys {
+		p.overLimit[key]++
+	} else {
+		p.overflow++
+	}
+	return false
+}
+
+// throttleSummary is the line emitted at the end of each window.
+type throttleSummary struct {
+	Timestamp string            `json:"timestamp"`
+	Level     string            `json:"level"`
+	Message   string            `json:"message"`
+	Processor string            `json:"processor"`
+	Action    ThrottleAction    `json:"action"`
+	Window    float64           `json:"window_seconds"`
+	Counts    map[string]uint64 `json:"suppressed"`
+}
+
+// Flush emits the summary once the window has elapsed (or on final).
+// Windows with nothing over the limit produce no line.
+func (p *ThrottleProcessor) Flush(now time.Time, final bool) [][]byte {
+	p.mu.Lock()
+	if p.windowStart.IsZero() {
+		p.windowStart = now
+	}
+	elapsed := now.Sub(p.windowStart)
+	if !final && elapsed < p.window {
+		p.mu.Unlock()
+		return nil
+	}
+	counts, overflow := p.overLimit, p.overflow
+	p.overLimit = make(map[string]uint64)
+	p.overflow = 0
+	p.windowStart = now
+	p.mu.Unlock()
+
+	if len(counts) == 0 && overflow == 0 {
+		return nil
+	}
+	if n, ok := counts[""]; ok {
+		delete(counts, "")
+		counts[throttleNoKey] += n
+	}
+	if overflow > 0 {
+		counts[throttleOtherKey] += overflow
+	}
+
+	line, err := json.Marshal(throttleSummary{
+		Timestamp: now.UTC().Format(time.RFC3339Nano),
+		Level:     "WARN",
+		Message:   "throttle summary",
+		Processor: p.name,
+		Action:    p.action,
+		Window:    elapsed.Seconds(),
+		Counts:    counts,
+	})
+	if err != nil {
+		return nil // map[string]uint64 always marshals
+	}
+	return [][]byte{line}
+}
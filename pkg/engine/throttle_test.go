@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// fakeClock is a manually advanced time source for rate tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newThrottle(t *testing.T, cfg ThrottleConfig) (*ThrottleProcessor, *fakeClock) {
+	t.Helper()
+	proc, err := NewThrottleProcessor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	proc.now = clock.now
+	return proc, clock
+}
+
+func serviceEntry(name string) []byte {
+	return []byte(fmt.Sprintf(`{"resource":{"attributes":{"service.name":%q}},"msg":"x"}`, name))
+}
+
+func TestThrottle_PerKeyBuckets(t *testing.T) {
+	proc, clock := newThrottle(t, ThrottleConfig{Name: "t", Attribute: "service.name", Rate: 2, Burst: 3})
+
+	count := func(svc string, n int) (kept int) {
+		for i := 0; i < n; i++ {
+			if _, drop, _ := proc.Process(nil, serviceEntry(svc)); !drop {
+				kept++
+			}
+		}
+		return kept
+	}
+
+	if got := count("noisy", 10); got != 3 {
+		t.Errorf("noisy kept %d, want burst of 3", got)
+	}
+	// Another key has its own bucket.
+	if got := count("quiet", 2); got != 2 {
+		t.Errorf("quiet kept %d, want 2", got)
+	}
+	// Refill at 2 tokens/s.
+	clock.advance(time.Second)
+	if got := count("noisy", 10); got != 2 {
+		t.Errorf("noisy kept %d after 1s, want 2", got)
+	}
+}
+
+func TestThrottle_Actions(t *testing.T) {
+	t.Run("tag", func(t *testing.T) {
+		proc, _ := newThrottle(t, ThrottleConfig{Name: "t", Attribute: "service.name", Rate: 1, Action: ThrottleTag})
+		proc.Process(nil, serviceEntry("a"))
+		out, drop, _ := proc.Process(nil, serviceEntry("a"))
+		if drop {
+			t.Fatalf("tag action dropped the entry")
+		}
+		if !gjson.GetBytes(out, "throttled").Bool() {
+			t.Errorf("Expected throttled=true, got %s", out)
+		}
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		proc, _ := newThrottle(t, ThrottleConfig{Name: "t", Attribute: "service.name", Rate: 1, Action: ThrottleSample, SampleRate: 0.1})
+		kept := 0
+		for i := 0; i < 10001; i++ {
+			if _, drop, _ := proc.Process(nil, serviceEntry("a")); !drop {
+				kept++
+			}
+		}
+		if kept < 800 || kept > 1200 {
+			t.Errorf("sample action kept %d of 10000 over-limit entries, want ~1000", kept)
+		}
+	})
+}
+
+func TestThrottle_LRUEviction(t *testing.T) {
+	proc, _ := newThrottle(t, ThrottleConfig{Name: "t", Attribute: "service.name", Rate: 1, MaxKeys: 2})
+
+	for _, svc := range []string{"a", "b", "a", "c"} {
+		proc.Process(nil, serviceEntry(svc))
+	}
+	if len(proc.buckets) != 2 || proc.lru.Len() != 2 {
+		t.Fatalf("Expected 2 buckets, got %d", len(proc.buckets))
+	}
+	if _, ok := proc.buckets["b"]; ok {
+		t.Errorf("Least recently used key b should have been evicted")
+	}
+	if _, ok := proc.buckets["a"]; !ok {
+		t.Errorf("Recently used key a should still be tracked")
+	}
+}
+
+func TestThrottle_Summary(t *testing.T) {
+	proc, clock := newThrottle(t, ThrottleConfig{Name: "t", Attribute: "service.name", Rate: 1, Window: time.Minute})
+
+	if lines := proc.Flush(clock.now(), false); lines != nil {
+		t.Fatalf("Expected no summary before any traffic, got %q", lines)
+	}
+	for i := 0; i < 5; i++ {
+		proc.Process(nil, serviceEntry("noisy"))
+	}
+	proc.Process(nil, []byte("plain text"))
+	proc.Process(nil, []byte("plain text"))
+
+	clock.advance(30 * time.Second)
+	if lines := proc.Flush(clock.now(), false); lines != nil {
+		t.Fatalf("Summary emitted before the window ended: %q", lines)
+	}
+
+	clock.advance(30 * time.Second)
+	lines := proc.Flush(clock.now(), false)
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 summary line, got %d", len(lines))
+	}
+	summary := gjson.ParseBytes(lines[0])
+	if got := summary.Get("suppressed.noisy").Int(); got != 4 {
+		t.Errorf("suppressed.noisy = %d, want 4 (%s)", got, lines[0])
+	}
+	if got := summary.Get("suppressed._unkeyed").Int(); got != 1 {
+		t.Errorf("suppressed._unkeyed = %d, want 1 (%s)", got, lines[0])
+	}
+
+	// Counters reset with the window.
+	clock.advance(time.Minute)
+	if lines := proc.Flush(clock.now(), false); lines != nil {
+		t.Errorf("Expected empty window to emit nothing, got %q", lines)
+	}
+}
+
+func TestPipeline_StopFlushesSummaries(t *testing.T) {
+	proc, _ := newThrottle(t, ThrottleConfig{Name: "t", Attribute: "service.name", Rate: 1, Window: time.Hour})
+	p, out := newTestPipeline(t)
+	p.UpdateChain(NewProcessorChain(proc))
+	p.Start(context.Background())
+
+	for i := 0; i < 3; i++ {
+		_ = p.buffer.Push(serviceEntry("noisy"))
+	}
+	p.Stop()
+
+	var summary []byte
+	for _, entry := range out.Snapshot() {
+		if gjson.GetBytes(entry, "message").String() == "throttle summary" {
+			summary = entry
+		}
+	}
+	if summary == nil {
+		t.Fatalf("Expected a final throttle summary on Stop")
+	}
+	if got := gjson.GetBytes(summary, "suppressed.noisy").Int(); got != 2 {
+		t.Errorf("suppressed.noisy = %d, want 2", got)
+	}
+}
+
+func TestThrottle_InvalidConfig(t *testing.T) {
+	bad := []ThrottleConfig{
+		{Rate: 1},                                  // no key
+		{Attribute: "a", Path: "b", Rate: 1},       // both
+		{Attribute: "a"},                           // no rate
+		{Attribute: "a", Rate: 1, Action: "queue"}, // unknown action
+		{Attribute: "a", Rate: 1, Action: ThrottleSample, SampleRate: 2},
+		{Attribute: "a", Rate: 1, Burst: -1},
+		{Attribute: "a", Rate: 1, Action: ThrottleTag, TagField: `say "hi"`},
+	}
+	for _, cfg := range bad {
+		if _, err := NewThrottleProcessor(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,595 @@
+package engine
+
+import (
+	"fmt"
+	"streamgate/pkg/model"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// TransformOpKind names a transform operation.
+type TransformOpKind string
+
+const (
+	TransformSet       TransformOpKind = "set"       // Path = Value
+	TransformRename    TransformOpKind = "rename"    // rename the key at Path to To (same parent)
+	TransformRemove    TransformOpKind = "remove"    // delete Path
+	TransformCopy      TransformOpKind = "copy"      // To = Path
+	TransformMove      TransformOpKind = "move"      // To = Path, then delete Path
+	TransformFlatten   TransformOpKind = "flatten"   // {"a":{"b":1}} -> {"a.b":1}
+	TransformUnflatten TransformOpKind = "unflatten" // {"a.b":1} -> {"a":{"b":1}}
+)
+
+// TransformOp is one edit. Paths are "/" separated keys, as in
+// AttributeFilterConfig; they address objects only, not array elements.
+type TransformOp struct {
+	Kind TransformOpKind
+	Path string // the field operated on; for flatten/unflatten, empty means the whole entry
+	To   string // rename: the new key name; copy/move: the destination path
+
+	// Value is what set writes. Valid JSON other than a string (42, true,
+	// null, {...}, [...]) is written as is; anything else is a string, in
+	// which ${path} is replaced by the current value of that field.
+	// Quote a value to keep it a string: "42".
+	Value string
+}
+
+// TransformConfig holds configuration for creating a TransformProcessor.
+type TransformConfig struct {
+	Name string
+	Ops  []TransformOp // applied in order
+
+	// When, if set, is a condition (see expr.go) an entry must satisfy to be
+	// transformed, e.g. `NOT level in (error, fatal)`.
+	When string
+
+	// Separator joins keys for flatten and splits them for unflatten.
+	// Defaults to ".".
+	Separator string
+}
+
+// TransformProcessor edits JSON entries. Entries that aren't JSON objects,
+// or don't satisfy When, pass through untouched. It never drops entries.
+type TransformProcessor struct {
+	name  string
+	steps []transformStep
+	when  exprNode
+	sep   string
+}
+
+type transformStep struct {
+	kind TransformOpKind
+	path []string // key segments
+	to   []string // destination segments (copy/move), or the new name (rename)
+
+	// source is path as a gjson path, for a cheap existence check before
+	// rebuilding the entry.
+	source string
+
+	value    []byte         // set: literal JSON
+	template []templatePart // set: string template, if it references fields
+}
+
+// templatePart is either literal text or a field reference.
+type templatePart struct {
+	literal string
+	path    []string
+}
+
+// NewTransformProcessor validates and compiles the operations.
+func NewTransformProcessor(cfg TransformConfig) (*TransformProcessor, error) {
+	if len(cfg.Ops) == 0 {
+		return nil, fmt.Errorf("at least one operation must be specified")
+	}
+
+	p := &TransformProcessor{
+		name: cfg.Name,
+		sep:  cfg.Separator,
+	}
+	if p.sep == "" {
+		p.sep = "."
+	}
+	if cfg.When != "" {
+		when, err := compileExpr(cfg.When)
+		if err != nil {
+			return nil, fmt.Errorf("when: %w", err)
+		}
+		p.when = when
+	}
+
+	for i, op := range cfg.Ops {
+		step, err := compileTransformOp(op)
+		if err != nil {
+			return nil, fmt.Errorf("op %d (%s): %w", i+1, op.Kind, err)
+		}
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+func compileTransformOp(op TransformOp) (transformStep, error) {
+	step := transformStep{
+		kind:   op.Kind,
+		path:   splitTransformPath(op.Path),
+		source: convertToGjsonPath(op.Path),
+	}
+	needsPath := op.Kind != TransformFlatten && op.Kind != TransformUnflatten
+	if needsPath && len(step.path) == 0 {
+		return step, fmt.Errorf("path must be specified")
+	}
+
+	switch op.Kind {
+	case TransformSet:
+		value, template, err := compileTransformValue(op.Value)
+		if err != nil {
+			return step, err
+		}
+		step.value, step.template = value, template
+	case TransformRename:
+		if op.To == "" || strings.Contains(op.To, "/") {
+			return step, fmt.Errorf("rename needs a new key name without /")
+		}
+		step.to = []string{op.To}
+	case TransformCopy, TransformMove:
+		step.to = splitTransformPath(op.To)
+		if len(step.to) == 0 {
+			return step, fmt.Errorf("destination must be specified")
+		}
+		if op.Kind == TransformMove && hasPathPrefix(step.to, step.path) {
+			return step, fmt.Errorf("cannot move %s into itself", op.Path)
+		}
+	case TransformRemove, TransformFlatten, TransformUnflatten:
+	default:
+		return step, fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	return step, nil
+}
+
+// compileTransformValue splits a set value into literal JSON or a template.
+func compileTransformValue(v string) ([]byte, []templatePart, error) {
+	s := v
+	if r := gjson.Parse(v); gjson.Valid(v) {
+		if r.Type != gjson.String {
+			return []byte(strings.TrimSpace(v)), nil, nil
+		}
+		s = r.Str
+	}
+
+	var parts []templatePart
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return nil, nil, fmt.Errorf("unterminated ${ in value %q", v)
+		}
+		ref := splitTransformPath(s[start+2 : start+end])
+		if len(ref) == 0 {
+			return nil, nil, fmt.Errorf("empty ${} in value %q", v)
+		}
+		if start > 0 {
+			parts = append(parts, templatePart{literal: s[:start]})
+		}
+		parts = append(parts, templatePart{path: ref})
+		s = s[start+end+1:]
+	}
+	if len(parts) == 0 {
+		return appendJSONString(nil, s), nil, nil
+	}
+	if s != "" {
+		parts = append(parts, templatePart{literal: s})
+	}
+	return nil, parts, nil
+}
+
+func splitTransformPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// hasPathPrefix reports whether path is prefix or a field below it.
+func hasPathPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *TransformProcessor) Name() string {
+	return p.name
+}
+
+func (p *TransformProcessor) Process(ctx *ProcessingContext, entry []byte) ([]byte, bool, error) {
+	return processRaw(p, ctx, entry)
+}
+
+// ProcessEntry is Process on the shared envelope.
+func (p *TransformProcessor) ProcessEntry(ctx *ProcessingContext, e *model.LogEntry) (bool, error) {
+	if !isObjectEntry(e) {
+		return false, nil
+	}
+	if p.when != nil && !p.when.eval(e) {
+		return false, nil
+	}
+	if !p.applies(e) {
+		return false, nil
+	}
+
+	root := parseJSONNode(gjson.Parse(string(e.Raw)))
+	changed := false
+	for i := range p.steps {
+		if p.steps[i].apply(root, p.sep) {
+			changed = true
+		}
+	}
+	if changed {
+		e.SetRaw(root.appendTo(make([]byte, 0, len(e.Raw)+64)))
+	}
+	return false, nil
+}
+
+// applies reports whether any step could change the entry, so the common
+// case (e.g. "remove stack_trace" on a log without one) skips the rebuild.
+// Steps that only edit existing fields can't apply if none of them exist:
+// only set, copy and move create fields, and copy and move need a source.
+func (p *TransformProcessor) applies(e *model.LogEntry) bool {
+	for i := range p.steps {
+		switch p.steps[i].kind {
+		case TransformSet, TransformFlatten, TransformUnflatten:
+			return true
+		default:
+			if e.Get(p.steps[i].source).Exists() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// apply runs one step against the tree, reporting whether it changed it.
+func (s *transformStep) apply(root *jsonNode, sep string) bool {
+	switch s.kind {
+	case TransformSet:
+		value := s.value
+		if s.template != nil {
+			value = s.render(root)
+		}
+		return root.set(s.path, &jsonNode{raw: string(value)})
+	case TransformRename:
+		return root.rename(s.path, s.to[0])
+	case TransformRemove:
+		return root.remove(s.path) != nil
+	case TransformCopy:
+		v := root.find(s.path)
+		return v != nil && root.set(s.to, v.clone())
+	case TransformMove:
+		v := root.remove(s.path)
+		if v == nil {
+			return false
+		}
+		if !root.set(s.to, v) {
+			root.set(s.path, v) // destination unreachable: put it back
+		}
+		return true
+	case TransformFlatten, TransformUnflatten:
+		n := root.find(s.path)
+		if n == nil || !n.object {
+			return false
+		}
+		if s.kind == TransformFlatten {
+			n.members = flattenMembers(nil, "", n, sep)
+		} else {
+			n.members = unflattenMembers(n, sep)
+		}
+		return true
+	}
+	return false
+}
+
+// render expands a template against the current tree. Missing fields
+// expand to nothing; objects and arrays to their JSON.
+func (s *transformStep) render(root *jsonNode) []byte {
+	var b strings.Builder
+	for _, part := range s.template {
+		if part.path == nil {
+			b.WriteString(part.literal)
+			continue
+		}
+		n := root.find(part.path)
+		switch {
+		case n == nil:
+		case n.object:
+			b.Write(n.appendTo(nil))
+		default:
+			b.WriteString(gjson.Parse(n.raw).String())
+		}
+	}
+	return appendJSONString(nil, b.String())
+}
+
+// jsonNode is a minimal ordered JSON tree: objects are split into members,
+// everything else (including arrays) is kept as raw JSON. Key order is
+// preserved, so untouched fields come out where they went in.
+type jsonNode struct {
+	object  bool
+	members []jsonMember
+	raw     string
+}
+
+type jsonMember struct {
+	key   string
+	value *jsonNode
+}
+
+func parseJSONNode(r gjson.Result) *jsonNode {
+	if !r.IsObject() {
+		return &jsonNode{raw: r.Raw}
+	}
+	n := &jsonNode{object: true}
+	r.ForEach(func(key, value gjson.Result) bool {
+		n.members = append(n.members, jsonMember{key: key.String(), value: parseJSONNode(value)})
+		return true
+	})
+	return n
+}
+
+// appendTo serializes the tree (compact).
+func (n *jsonNode) appendTo(dst []byte) []byte {
+	if !n.object {
+		return append(dst, n.raw...)
+	}
+	dst = append(dst, '{')
+	for i, m := range n.members {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, m.key)
+		dst = append(dst, ':')
+		dst = m.value.appendTo(dst)
+	}
+	return append(dst, '}')
+}
+
+func (n *jsonNode) clone() *jsonNode {
+	c := &jsonNode{object: n.object, raw: n.raw}
+	for _, m := range n.members {
+		c.members = append(c.members, jsonMember{key: m.key, value: m.value.clone()})
+	}
+	return c
+}
+
+func (n *jsonNode) index(key string) int {
+	for i, m := range n.members {
+		if m.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// walk follows path through objects, optionally creating missing ones.
+// It returns nil if the path runs into a non-object.
+func (n *jsonNode) walk(path []string, create bool) *jsonNode {
+	for _, key := range path {
+		if !n.object {
+			return nil
+		}
+		i := n.index(key)
+		if i < 0 {
+			if !create {
+				return nil
+			}
+			n.members = append(n.members, jsonMember{key: key, value: &jsonNode{object: true}})
+			i = len(n.members) - 1
+		}
+		n = n.members[i].value
+	}
+	return n
+}
+
+func (n *jsonNode) find(path []string) *jsonNode {
+	return n.walk(path, false)
+}
+
+// set stores v at path, replacing an existing value in place.
+func (n *jsonNode) set(path []string, v *jsonNode) bool {
+	parent := n.walk(path[:len(path)-1], true)
+	if parent == nil || !parent.object {
+		return false
+	}
+	parent.put(path[len(path)-1], v)
+	return true
+}
+
+func (n *jsonNode) put(key string, v *jsonNode) {
+	if i := n.index(key); i >= 0 {
+		n.members[i].value = v
+		return
+	}
+	n.members = append(n.members, jsonMember{key: key, value: v})
+}
+
+func (n *jsonNode) remove(path []string) *jsonNode {
+	parent := n.find(path[:len(path)-1])
+	if parent == nil || !parent.object {
+		return nil
+	}
+	i := parent.index(path[len(path)-1])
+	if i < 0 {
+		return nil
+	}
+	v := parent.members[i].value
+	parent.members = append(parent.members[:i], parent.members[i+1:]...)
+	return v
+}
+
+// rename changes a key in place, replacing any sibling already called name.
+func (n *jsonNode) rename(path []string, name string) bool {
+	parent := n.find(path[:len(path)-1])
+	if parent == nil || !parent.object {
+		return false
+	}
+	i := parent.index(path[len(path)-1])
+	if i < 0 || parent.members[i].key == name {
+		return false
+	}
+	if j := parent.index(name); j >= 0 {
+		parent.members = append(parent.members[:j], parent.members[j+1:]...)
+		if j < i {
+			i--
+		}
+	}
+	parent.members[i].key = name
+	return true
+}
+
+// flattenMembers lifts nested object members to the top, joining keys with
+// sep. Empty objects are kept as values.
+func flattenMembers(dst []jsonMember, prefix string, n *jsonNode, sep string) []jsonMember {
+	for _, m := range n.members {
+		key := m.key
+		if prefix != "" {
+			key = prefix + sep + key
+		}
+		if m.value.object && len(m.value.members) > 0 {
+			dst = flattenMembers(dst, key, m.value, sep)
+			continue
+		}
+		dst = append(dst, jsonMember{key: key, value: m.value})
+	}
+	return dst
+}
+
+// unflattenMembers nests members whose keys contain sep. Keys that would
+// collide with a non-object value stay flat, so nothing is lost.
+func unflattenMembers(n *jsonNode, sep string) []jsonMember {
+	out := &jsonNode{object: true}
+	for _, m := range n.members {
+		if path := strings.Split(m.key, sep); len(path) > 1 && out.merge(path, m.value) {
+			continue
+		}
+		if !out.merge([]string{m.key}, m.value) {
+			out.members = append(out.members, m)
+		}
+	}
+	return out.members
+}
+
+// merge is set, except that two objects at the same key are combined.
+func (n *jsonNode) merge(path []string, v *jsonNode) bool {
+	for _, key := range path {
+		if key == "" {
+			return false
+		}
+	}
+	parent := n.walk(path[:len(path)-1], true)
+	if parent == nil || !parent.object {
+		return false
+	}
+	key := path[len(path)-1]
+	if i := parent.index(key); i >= 0 {
+		existing := parent.members[i].value
+		if !existing.object || !v.object {
+			return false
+		}
+		for _, m := range v.members {
+			existing.merge([]string{m.key}, m.value)
+		}
+		return true
+	}
+	parent.members = append(parent.members, jsonMember{key: key, value: v})
+	return true
+}
+
+// ParseTransformOps parses the compact text form of a list of operations,
+// one per line or separated by ";":
+//
+//	set env prod
+//	set tag "${service}-${env}"
+//	rename msg message
+//	remove stack_trace debug/raw
+//	copy user/id user_id; move kubernetes/pod pod
+//	flatten attributes
+//	unflatten
+//
+// The value of set is the rest of its line; quote it (JSON string syntax)
+// if it contains ";".
+func ParseTransformOps(spec string) ([]TransformOp, error) {
+	var ops []TransformOp
+	for _, stmt := range splitTransformStatements(spec) {
+		kind, rest, _ := strings.Cut(stmt, " ")
+		rest = strings.TrimSpace(rest)
+		args := strings.Fields(rest)
+		op := TransformOp{Kind: TransformOpKind(kind)}
+
+		switch op.Kind {
+		case TransformSet:
+			path, value, ok := strings.Cut(rest, " ")
+			if !ok {
+				return nil, fmt.Errorf("%q: want set <path> <value>", stmt)
+			}
+			op.Path, op.Value = path, strings.TrimSpace(value)
+		case TransformRemove:
+			if len(args) == 0 {
+				return nil, fmt.Errorf("%q: want remove <path>...", stmt)
+			}
+			for _, path := range args {
+				ops = append(ops, TransformOp{Kind: TransformRemove, Path: path})
+			}
+			continue
+		case TransformRename, TransformCopy, TransformMove:
+			if len(args) != 2 {
+				return nil, fmt.Errorf("%q: want %s <path> <to>", stmt, kind)
+			}
+			op.Path, op.To = args[0], args[1]
+		case TransformFlatten, TransformUnflatten:
+			if len(args) > 1 {
+				return nil, fmt.Errorf("%q: want %s [path]", stmt, kind)
+			}
+			if len(args) == 1 {
+				op.Path = args[0]
+			}
+		default:
+			return nil, fmt.Errorf("%q: unknown operation %q", stmt, kind)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// splitTransformStatements splits on newlines and on ";" outside quotes,
+// dropping empty statements.
+func splitTransformStatements(spec string) []string {
+	var stmts []string
+	start, quoted := 0, false
+	for i := 0; i <= len(spec); i++ {
+		if i < len(spec) {
+			switch c := spec[i]; {
+			case c == '\\' && quoted:
+				i++
+				continue
+			case c == '"':
+				quoted = !quoted
+				continue
+			case c == '\n' || (c == ';' && !quoted):
+			default:
+				continue
+			}
+		}
+		if stmt := strings.TrimSpace(spec[start:min(i, len(spec))]); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		start = i + 1
+	}
+	return stmts
+}
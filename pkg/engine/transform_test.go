@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTransform_Ops(t *testing.T) {
+	tests := []struct {
+		name  string
+		ops   string
+		input string
+		want  string
+	}{
+		{"set literal", "set env prod", `{"msg":"hi"}`, `{"msg":"hi","env":"prod"}`},
+		{"set number", "set attempts 3", `{"msg":"hi"}`, `{"msg":"hi","attempts":3}`},
+		{"set quoted number stays string", `set code "42"`, `{}`, `{"code":"42"}`},
+		{"set replaces in place", "set level info", `{"level":"debug","msg":"hi"}`, `{"level":"info","msg":"hi"}`},
+		{"set nested creates parents", "set k8s/ns default", `{"msg":"hi"}`, `{"msg":"hi","k8s":{"ns":"default"}}`},
+		{"set template", "set svc ${service}-${env}", `{"service":"api","env":"prod"}`, `{"service":"api","env":"prod","svc":"api-prod"}`},
+		{"set template missing field", "set svc ${service}/${nope}", `{"service":"api"}`, `{"service":"api","svc":"api/"}`},
+		{"rename keeps position", "rename msg message", `{"ts":1,"msg":"hi","level":"info"}`, `{"ts":1,"message":"hi","level":"info"}`},
+		{"rename replaces sibling", "rename msg message", `{"message":"old","msg":"new"}`, `{"message":"new"}`},
+		{"rename nested", "rename attributes/http.code status", `{"attributes":{"http.code":200}}`, `{"attributes":{"status":200}}`},
+		{"remove", "remove stack_trace", `{"msg":"hi","stack_trace":"at main()"}`, `{"msg":"hi"}`},
+		{"remove many", "remove a b/c", `{"a":1,"b":{"c":2,"d":3}}`, `{"b":{"d":3}}`},
+		{"remove missing is a no-op", "remove stack_trace", `{"msg": "hi"}`, `{"msg": "hi"}`},
+		{"copy", "copy user/id user_id", `{"user":{"id":7}}`, `{"user":{"id":7},"user_id":7}`},
+		{"copy is deep", "copy a b; set b/x 2", `{"a":{"x":1}}`, `{"a":{"x":1},"b":{"x":2}}`},
+		{"move", "move kubernetes/pod pod", `{"kubernetes":{"pod":"p1","ns":"n"}}`, `{"kubernetes":{"ns":"n"},"pod":"p1"}`},
+		{"move onto scalar parent keeps value", "move a b/c", `{"a":1,"b":2}`, `{"b":2,"a":1}`},
+		{"flatten all", "flatten", `{"a":{"b":{"c":1},"d":[1]},"e":{}}`, `{"a.b.c":1,"a.d":[1],"e":{}}`},
+		{"flatten path", "flatten attributes", `{"msg":"x","attributes":{"http":{"code":200}}}`, `{"msg":"x","attributes":{"http.code":200}}`},
+		{"unflatten", "unflatten", `{"http.code":200,"http.method":"GET","msg":"x"}`, `{"http":{"code":200,"method":"GET"},"msg":"x"}`},
+		{"unflatten keeps collisions flat", "unflatten", `{"a":1,"a.b":2}`, `{"a":1,"a.b":2}`},
+		{"unflatten merges objects", "unflatten", `{"a":{"x":1},"a.y":2}`, `{"a":{"x":1,"y":2}}`},
+		{"invalid json passes through", "set env prod", `{"msg":`, `{"msg":`},
+		{"plain text passes through", "set env prod", `disk full`, `disk full`},
+		{"escapes", "set note a\"b", `{}`, `{"note":"a\"b"}`},
+	}
+
+	ctx := &ProcessingContext{Context: context.Background()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := ParseTransformOps(tt.ops)
+			if err != nil {
+				t.Fatalf("ParseTransformOps() error = %v", err)
+			}
+			proc, err := NewTransformProcessor(TransformConfig{Name: "test", Ops: ops})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			out, drop, err := proc.Process(ctx, []byte(tt.input))
+			if err != nil || drop {
+				t.Fatalf("Process() drop = %v, err = %v", drop, err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("Process() = %s, want %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransform_When(t *testing.T) {
+	proc, err := NewTransformProcessor(TransformConfig{
+		Name: "strip_stack",
+		Ops:  []TransformOp{{Kind: TransformRemove, Path: "stack_trace"}},
+		When: "NOT level in (error, fatal)",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`{"level":"info","stack_trace":"..."}`, `{"level":"info"}`},
+		{`{"level":"error","stack_trace":"..."}`, `{"level":"error","stack_trace":"..."}`},
+	}
+	ctx := &ProcessingContext{Context: context.Background()}
+	for _, tt := range tests {
+		out, _, _ := proc.Process(ctx, []byte(tt.input))
+		if string(out) != tt.want {
+			t.Errorf("Process(%s) = %s, want %s", tt.input, out, tt.want)
+		}
+	}
+}
+
+func TestTransform_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  string
+		when string
+		want string
+	}{
+		{"unknown op", "explode a", "", "unknown operation"},
+		{"set without value", "set a", "", "want set"},
+		{"copy without destination", "copy a", "", "want copy"},
+		{"rename to a path", "rename a b/c", "", "without /"},
+		{"move into itself", "move a a/b", "", "into itself"},
+		{"unterminated template", "set a ${b", "", "unterminated"},
+		{"bad condition", "remove a", "level =", "when"},
+		{"no ops", "", "", "at least one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := ParseTransformOps(tt.ops)
+			if err == nil {
+				_, err = NewTransformProcessor(TransformConfig{Ops: ops, When: tt.when})
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTransformOps_Statements(t *testing.T) {
+	ops, err := ParseTransformOps("set note \"a;b\"; remove x\n\nrename y z")
+	if err != nil {
+		t.Fatalf("ParseTransformOps() error = %v", err)
+	}
+	want := []TransformOp{
+		{Kind: TransformSet, Path: "note", Value: `"a;b"`},
+		{Kind: TransformRemove, Path: "x"},
+		{Kind: TransformRename, Path: "y", To: "z"},
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("ParseTransformOps() = %+v, want %+v", ops, want)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Errorf("op %d = %+v, want %+v", i, ops[i], want[i])
+		}
+	}
+}
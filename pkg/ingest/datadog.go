@@ -0,0 +1,143 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"streamgate/pkg/model"
+	"strings"
+)
+
+// ListenerDatadog is the listener name attached to entries received on
+// the Datadog logs intake endpoint.
+const ListenerDatadog = "datadog"
+
+// DatadogLogsPath is the Datadog logs intake API (v2).
+const DatadogLogsPath = "/api/v2/logs"
+
+// datadogLogsHandler emulates Datadog's logs intake. The body is a JSON
+// array of logs (or a single one):
+//
+//	[{"message":"GET /","ddsource":"nginx","ddtags":"env:prod,team:web",
+//	  "hostname":"web1","service":"frontend","status":"info"}]
+//
+// Each log is kept as sent, with normalized fields added: "host" from
+// hostname, "source" from ddsource, "level" from status, and each ddtag as
+// a field ("env":"prod"; a bare tag is true). The ddtags, ddsource,
+// service and hostname query parameters apply to every log.
+//
+// Clients send the API key in the DD-API-KEY header; it is checked against
+// the ingest token. A full buffer gets 429, which the Agent retries.
+type datadogLogsHandler struct {
+	h *HTTPIngestor
+}
+
+func (d datadogLogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeDatadogError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	if !d.h.vendorAuthorized(r) {
+		writeDatadogError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	body, err := d.h.readBody(w, r)
+	if err != nil {
+		var he *httpError
+		if errors.As(err, &he) {
+			writeDatadogError(w, he.status, he.msg)
+		} else {
+			writeDatadogError(w, http.StatusBadRequest, "reading body: "+err.Error())
+		}
+		return
+	}
+
+	entries, err := datadogEntries(body, r.URL.Query())
+	if err != nil {
+		writeDatadogError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if pushAll(d.h.buffer, entries, model.Source{Listener: ListenerDatadog, Addr: r.RemoteAddr}) {
+		w.Header().Set("Retry-After", d.h.retryAfter())
+		writeDatadogError(w, http.StatusTooManyRequests, "Too Many Requests")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, struct{}{})
+}
+
+// datadogEntries normalizes a body of one log or an array of them.
+func datadogEntries(body []byte, query url.Values) ([][]byte, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var logs []json.RawMessage
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &logs); err != nil {
+			return nil, err
+		}
+	} else {
+		logs = []json.RawMessage{body}
+	}
+
+	entries := make([][]byte, 0, len(logs))
+	for _, raw := range logs {
+		var f vendorFields
+		if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '{' {
+			var err error
+			if f, err = decodeJSONObject(raw); err != nil {
+				return nil, err
+			}
+		} else {
+			var message interface{}
+			if err := json.Unmarshal(raw, &message); err != nil {
+				return nil, err
+			}
+			f = vendorFields{"message": message}
+		}
+
+		for _, key := range []string{"ddsource", "service", "hostname"} {
+			f.add(key, query.Get(key))
+		}
+		f.add("host", f["hostname"])
+		f.add("source", f["ddsource"])
+		f.add("level", f["status"])
+		if tags, ok := f["ddtags"].(string); ok {
+			addDatadogTags(f, tags)
+		}
+		addDatadogTags(f, query.Get("ddtags"))
+
+		entry, err := marshalEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// addDatadogTags adds "key:value,..." tags as fields.
+func addDatadogTags(f vendorFields, tags string) {
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if key, value, ok := strings.Cut(tag, ":"); ok {
+			f.add(key, value)
+		} else {
+			f.add(tag, true)
+		}
+	}
+}
+
+func writeDatadogError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, struct {
+		Errors []string `json:"errors"`
+	}{[]string{msg}})
+}
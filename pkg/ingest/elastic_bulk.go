@@ -0,0 +1,236 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"streamgate/pkg/model"
+	"time"
+)
+
+// ListenerElasticsearch is the listener name attached to entries received
+// on the Elasticsearch bulk endpoint.
+const ListenerElasticsearch = "elasticsearch"
+
+// Elasticsearch bulk API paths; the second names a default index.
+const (
+	ElasticBulkPath      = "/_bulk"
+	ElasticIndexBulkPath = "/{index}/_bulk"
+)
+
+// Elasticsearch cluster endpoints that clients probe before sending.
+const (
+	ElasticInfoPath   = "/{$}"
+	ElasticHealthPath = "/_cluster/health"
+)
+
+// elasticVersion is the Elasticsearch version reported to clients. Beats
+// and Logstash refuse to send to a cluster older than themselves.
+const elasticVersion = "8.17.0"
+
+// elasticBulkHandler emulates the Elasticsearch bulk API, as used by
+// Filebeat, Logstash, Fluent Bit and Vector. Filebeat and Logstash read the
+// version from GET / before their first bulk request and Vector's
+// healthcheck calls GET /_cluster/health, so both are answered too (see
+// info and health). Filebeat's index template and ILM setup is not; turn
+// it off with setup.template.enabled and setup.ilm.enabled set to false.
+//
+// The body is NDJSON action and document pairs:
+//
+//	{"index":{"_index":"logs-web"}}
+//	{"@timestamp":"2024-06-01T12:00:00Z","message":"GET /"}
+//
+// Each index or create document becomes an entry with its index added as
+// "index". Update and delete actions fail their item; logs are only ever
+// appended.
+//
+// Per-item results are reported like Elasticsearch does: documents that
+// don't fit in the buffer get status 429, which bulk clients retry. If none
+// fit, the whole request gets 429.
+type elasticBulkHandler struct {
+	h *HTTPIngestor
+}
+
+// esError is Elasticsearch's error object.
+type esError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// bulkItem is one action's result.
+type bulkItem struct {
+	Index  string   `json:"_index"`
+	ID     string   `json:"_id,omitempty"`
+	Status int      `json:"status"`
+	Result string   `json:"result,omitempty"`
+	Error  *esError `json:"error,omitempty"`
+}
+
+func (e elasticBulkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		writeESError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if !e.h.vendorAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="security", ApiKey, Bearer`)
+		writeESError(w, http.StatusUnauthorized, "security_exception", "missing or invalid credentials")
+		return
+	}
+
+	body, err := e.h.readBody(w, r)
+	if err != nil {
+		var he *httpError
+		if errors.As(err, &he) {
+			writeESError(w, he.status, "parse_exception", he.msg)
+		} else {
+			writeESError(w, http.StatusBadRequest, "parse_exception", "reading body: "+err.Error())
+		}
+		return
+	}
+
+	actions, items, entries, err := parseBulk(body, r.PathValue("index"))
+	if err != nil {
+		writeESError(w, http.StatusBadRequest, "illegal_argument_exception", err.Error())
+		return
+	}
+
+	if pushAll(e.h.buffer, entries, model.Source{Listener: ListenerElasticsearch, Addr: r.RemoteAddr}) {
+		w.Header().Set("Retry-After", e.h.retryAfter())
+		writeESError(w, http.StatusTooManyRequests, "es_rejected_execution_exception", "buffer full")
+		return
+	}
+
+	hasErrors := false
+	resp := make([]map[string]*bulkItem, len(items))
+	for i, item := range items {
+		hasErrors = hasErrors || item.Status >= 300
+		resp[i] = map[string]*bulkItem{actions[i]: item}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Took   int64                  `json:"took"`
+		Errors bool                   `json:"errors"`
+		Items  []map[string]*bulkItem `json:"items"`
+	}{time.Since(start).Milliseconds(), hasErrors, resp})
+}
+
+// parseBulk reads the action/document pairs. It returns each action's name
+// and provisional result (201 for a document to push), and the entries in
+// document order. A malformed action line fails the whole request.
+func parseBulk(body []byte, defaultIndex string) ([]string, []*bulkItem, [][]byte, error) {
+	var actions []string
+	var items []*bulkItem
+	var entries [][]byte
+
+	lines := bytes.Split(body, []byte("\n"))
+	for i := 0; i < len(lines); i++ {
+		line := bytes.TrimSpace(lines[i])
+		if len(line) == 0 {
+			continue
+		}
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			return nil, nil, nil, fmt.Errorf("malformed action/metadata line [%d]", i+1)
+		}
+		for name, meta := range action {
+			item := &bulkItem{Index: meta.Index, ID: meta.ID}
+			if item.Index == "" {
+				item.Index = defaultIndex
+			}
+			actions = append(actions, name)
+			items = append(items, item)
+
+			switch name {
+			case "index", "create":
+			case "update":
+				i++ // skip the partial document
+				fallthrough
+			case "delete":
+				item.Status = http.StatusBadRequest
+				item.Error = &esError{"action_request_validation_exception", name + " is not supported"}
+				continue
+			default:
+				return nil, nil, nil, fmt.Errorf("malformed action/metadata line [%d], unknown action [%s]", i+1, name)
+			}
+
+			i++
+			if i >= len(lines) {
+				return nil, nil, nil, fmt.Errorf("no document after action line [%d]", i)
+			}
+			f, err := decodeJSONObject(bytes.TrimSpace(lines[i]))
+			if err != nil {
+				item.Status = http.StatusBadRequest
+				item.Error = &esError{"document_parsing_exception", "failed to parse document: " + err.Error()}
+				continue
+			}
+			f.add("index", item.Index)
+			entry, err := marshalEntry(f)
+			if err != nil {
+				item.Status = http.StatusBadRequest
+				item.Error = &esError{"document_parsing_exception", err.Error()}
+				continue
+			}
+			item.Status, item.Result = http.StatusCreated, "created"
+			entries = append(entries, entry)
+		}
+	}
+	return actions, items, entries, nil
+}
+
+// info answers GET /, the cluster info the clients check the version of.
+func (e elasticBulkHandler) info(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	if !e.h.vendorAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="security", ApiKey, Bearer`)
+		writeESError(w, http.StatusUnauthorized, "security_exception", "missing or invalid credentials")
+		return
+	}
+	type version struct {
+		Number                           string `json:"number"`
+		BuildFlavor                      string `json:"build_flavor"`
+		MinimumWireCompatibilityVersion  string `json:"minimum_wire_compatibility_version"`
+		MinimumIndexCompatibilityVersion string `json:"minimum_index_compatibility_version"`
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Name        string  `json:"name"`
+		ClusterName string  `json:"cluster_name"`
+		Version     version `json:"version"`
+		Tagline     string  `json:"tagline"`
+	}{"streamgate", "streamgate", version{elasticVersion, "default", "7.17.0", "7.0.0"}, "You Know, for Search"})
+}
+
+// health answers GET /_cluster/health: green, or yellow while the buffer
+// is full.
+func (e elasticBulkHandler) health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	if !e.h.vendorAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="security", ApiKey, Bearer`)
+		writeESError(w, http.StatusUnauthorized, "security_exception", "missing or invalid credentials")
+		return
+	}
+	status := "green"
+	if e.h.buffer.Usage() >= e.h.buffer.Capacity() {
+		status = "yellow"
+	}
+	writeJSON(w, http.StatusOK, struct {
+		ClusterName       string `json:"cluster_name"`
+		Status            string `json:"status"`
+		TimedOut          bool   `json:"timed_out"`
+		NumberOfNodes     int    `json:"number_of_nodes"`
+		NumberOfDataNodes int    `json:"number_of_data_nodes"`
+	}{"streamgate", status, false, 1, 1})
+}
+
+func writeESError(w http.ResponseWriter, status int, typ, reason string) {
+	writeJSON(w, status, struct {
+		Error  esError `json:"error"`
+		Status int     `json:"status"`
+	}{esError{typ, reason}, status})
+}
@@ -0,0 +1,494 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"streamgate/pkg/engine"
+	"streamgate/pkg/model"
+	"sync"
+	"time"
+)
+
+// ListenerFile is the listener name attached to entries read by the file
+// ingestor. The entry's source address is the file's path.
+const ListenerFile = "file"
+
+// Where to start files found at startup that have no checkpoint.
+const (
+	FileStartAtBeginning = "beginning"
+	FileStartAtEnd       = "end"
+)
+
+// File tailing defaults.
+const (
+	defaultFilePollInterval = time.Second
+	defaultFingerprintBytes = 1024
+	defaultFileMaxLineBytes = 1 << 20 // 1 MiB
+)
+
+// FileConfig configures a FileIngestor. Zero values use the defaults.
+type FileConfig struct {
+	// Include and Exclude are filepath.Match globs. A file is tailed if
+	// an include pattern matches it and no exclude pattern does.
+	Include []string
+	Exclude []string
+	// StartAt is where files found at startup without a checkpoint are
+	// read from: FileStartAtEnd (the default) or FileStartAtBeginning.
+	// Files that appear later are always read from the beginning.
+	StartAt string
+	// CheckpointFile keeps read offsets across restarts. Empty disables
+	// checkpointing.
+	CheckpointFile string
+	// PollInterval is how often files are scanned for new lines (1s).
+	PollInterval time.Duration
+	// FingerprintBytes is how much of a file's head identifies it (1 KiB).
+	FingerprintBytes int
+	// MaxLineBytes splits longer lines into several entries (1 MiB).
+	MaxLineBytes int
+}
+
+// FileIngestor tails files matching glob patterns, one entry per line.
+//
+// Files are polled rather than watched. Each is identified by its device
+// and inode plus a fingerprint, the first FingerprintBytes of its content,
+// so a path can be rotated underneath it:
+//
+//   - rename: the old file is kept open and read to the end once it stops
+//     growing, and the new file at the path is read from the beginning.
+//   - copytruncate: a file shorter than the read offset, or whose head no
+//     longer matches the fingerprint, is read again from the beginning.
+//
+// The tailer itself drops nothing: while the buffer is full, reading pauses
+// and resumes at the first line that didn't fit. The offset past the last
+// line in the buffer is written to the checkpoint file after each poll, so
+// a restart resumes where the tailer stopped. A crash between a push and
+// the next checkpoint repeats the lines of that poll.
+//
+// The checkpoint tracks the ingest buffer, not the outputs: once a line is
+// in the buffer its offset may be saved. On a clean shutdown Stop writes the
+// final checkpoint and the pipelines are drained to their outputs before
+// exit, so nothing is lost or repeated. Lines still in the ingest, router or
+// pipeline buffers when the process crashes are lost, not re-read.
+type FileIngestor struct {
+	buffer *engine.RingBuffer
+	cfg    FileConfig
+
+	files   []*tailedFile
+	saved   []fileCheckpoint // loaded checkpoints not yet matched to a file, kept until one is
+	scanned bool             // the startup scan is done
+	dirty   bool             // offsets changed since the last checkpoint
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// tailedFile is an open file being read.
+type tailedFile struct {
+	path        string
+	id          fileID
+	fingerprint []byte
+	file        *os.File
+	reader      *bufio.Reader
+	offset      int64  // just past the last line pushed
+	pending     []byte // read past offset, no newline yet
+	seen        bool   // matched by the current scan
+}
+
+// fileCheckpoint is a file's entry in the checkpoint file.
+type fileCheckpoint struct {
+	Path        string `json:"path"`
+	Dev         uint64 `json:"dev"`
+	Inode       uint64 `json:"inode"`
+	Fingerprint []byte `json:"fingerprint"`
+	Offset      int64  `json:"offset"`
+}
+
+// NewFileIngestor validates the patterns and loads the checkpoint file.
+func NewFileIngestor(buffer *engine.RingBuffer, cfg FileConfig) (*FileIngestor, error) {
+	if len(cfg.Include) == 0 {
+		return nil, errors.New("no include patterns")
+	}
+	for _, pattern := range append(append([]string(nil), cfg.Include...), cfg.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	switch cfg.StartAt {
+	case "":
+		cfg.StartAt = FileStartAtEnd
+	case FileStartAtBeginning, FileStartAtEnd:
+	default:
+		return nil, fmt.Errorf("invalid start_at %q: want %q or %q", cfg.StartAt, FileStartAtBeginning, FileStartAtEnd)
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultFilePollInterval
+	}
+	if cfg.FingerprintBytes <= 0 {
+		cfg.FingerprintBytes = defaultFingerprintBytes
+	}
+	if cfg.MaxLineBytes <= 0 {
+		cfg.MaxLineBytes = defaultFileMaxLineBytes
+	}
+
+	saved, err := loadCheckpoints(cfg.CheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+	return &FileIngestor{
+		buffer: buffer,
+		cfg:    cfg,
+		saved:  saved,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// Start polls the files until Stop is called.
+func (f *FileIngestor) Start() error {
+	defer close(f.done)
+	log.Printf("File Ingestor tailing %v", f.cfg.Include)
+
+	ticker := time.NewTicker(f.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		f.poll()
+		select {
+		case <-f.stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop ends a started ingestor, writes a final checkpoint and closes the
+// files.
+func (f *FileIngestor) Stop() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	<-f.done
+	err := f.saveCheckpoint()
+	for _, t := range f.files {
+		t.file.Close()
+	}
+	f.files = nil
+	return err
+}
+
+// poll scans for files, reads new lines from each and checkpoints.
+func (f *FileIngestor) poll() {
+	for _, t := range f.files {
+		t.seen = false
+	}
+	for _, path := range f.match() {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if t := f.tracked(path, info); t != nil {
+			if t.path != path {
+				t.path = path // renamed to another matching path
+				f.dirty = true
+			}
+			t.seen = true
+			continue
+		}
+		t, err := f.open(path)
+		if err != nil {
+			log.Printf("File Ingestor: %v", err)
+			continue
+		}
+		t.seen = true
+		f.files = append(f.files, t)
+		f.dirty = true
+	}
+	f.scanned = true
+
+	live := f.files[:0]
+	for _, t := range f.files {
+		progress, eof := f.read(t)
+		// A file gone from the patterns (rotated by rename, or deleted) is
+		// closed once a poll finds nothing more in it.
+		if !t.seen && eof && !progress && f.flushPending(t) {
+			t.file.Close()
+			f.dirty = true
+			continue
+		}
+		live = append(live, t)
+	}
+	f.files = live
+
+	if f.dirty {
+		if err := f.saveCheckpoint(); err != nil {
+			log.Printf("File Ingestor: %v", err)
+		}
+	}
+}
+
+// match returns the paths matching the include but not the exclude
+// patterns.
+func (f *FileIngestor) match() []string {
+	set := make(map[string]bool)
+	for _, pattern := range f.cfg.Include {
+		paths, _ := filepath.Glob(pattern) // patterns are validated up front
+		for _, path := range paths {
+			set[path] = true
+		}
+	}
+	paths := make([]string, 0, len(set))
+outer:
+	for path := range set {
+		for _, pattern := range f.cfg.Exclude {
+			if ok, _ := filepath.Match(pattern, path); ok {
+				continue outer
+			}
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// tracked returns the open file at path: the same inode, or without
+// inodes, the same path.
+func (f *FileIngestor) tracked(path string, info os.FileInfo) *tailedFile {
+	id := statFileID(info)
+	for _, t := range f.files {
+		if (id.known() && t.id == id) || (!id.known() && t.path == path) {
+			return t
+		}
+	}
+	return nil
+}
+
+// open starts tailing a file: from its checkpoint if it has one, from the
+// end if it was found at startup and StartAt says so, else from the
+// beginning.
+func (f *FileIngestor) open(path string) (*tailedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	fp, err := readFingerprint(file, f.cfg.FingerprintBytes)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	t := &tailedFile{
+		path:        path,
+		id:          statFileID(info),
+		fingerprint: fp,
+		file:        file,
+		reader:      bufio.NewReader(file),
+	}
+	if offset, ok := f.checkpointed(t); ok {
+		t.offset = min(offset, info.Size())
+	} else if !f.scanned && f.cfg.StartAt == FileStartAtEnd {
+		t.offset = info.Size()
+	}
+	if err := t.rewind(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// checkpointed looks up and consumes t's saved offset. A checkpoint
+// matches on inode (or path, without inodes) and its fingerprint must be a
+// prefix of the file's, so a recycled inode or a rewritten file starts over.
+func (f *FileIngestor) checkpointed(t *tailedFile) (int64, bool) {
+	for i, c := range f.saved {
+		cid := fileID{c.Dev, c.Inode}
+		sameFile := (t.id.known() && cid == t.id) || (!t.id.known() && !cid.known() && c.Path == t.path)
+		if sameFile && bytes.HasPrefix(t.fingerprint, c.Fingerprint) {
+			f.saved = append(f.saved[:i], f.saved[i+1:]...)
+			return c.Offset, true
+		}
+	}
+	return 0, false
+}
+
+// read pushes t's complete lines to the buffer. It reports whether any
+// bytes were read and whether it stopped at the end of the file rather
+// than on a full buffer or an error.
+func (f *FileIngestor) read(t *tailedFile) (progress, eof bool) {
+	if truncated, err := t.truncated(f.cfg.FingerprintBytes); err != nil {
+		log.Printf("File Ingestor: checking %s: %v", t.path, err)
+		return false, false
+	} else if truncated {
+		log.Printf("File Ingestor: %s was truncated, reading it from the start", t.path)
+		t.offset = 0
+		f.dirty = true
+		if err := t.rewind(); err != nil {
+			log.Printf("File Ingestor: %v", err)
+			return false, false
+		}
+	}
+
+	for {
+		chunk, err := t.reader.ReadSlice('\n')
+		t.pending = append(t.pending, chunk...)
+		progress = progress || len(chunk) > 0
+		switch {
+		case err == nil:
+		case errors.Is(err, bufio.ErrBufferFull):
+			if len(t.pending) < f.cfg.MaxLineBytes {
+				continue
+			}
+		case errors.Is(err, io.EOF):
+			return progress, true // a partial line waits for the rest
+		default:
+			log.Printf("File Ingestor: reading %s: %v", t.path, err)
+			return progress, false
+		}
+		if !f.pushPending(t) {
+			return progress, false
+		}
+	}
+}
+
+// pushPending pushes the pending bytes as an entry and advances the
+// offset past them. On a full buffer it rewinds to the offset so the line
+// is read again next poll. The capacity check keeps these pauses, which
+// lose nothing, out of the buffer's drop count.
+func (f *FileIngestor) pushPending(t *tailedFile) bool {
+	if entry := bytes.TrimRight(t.pending, "\r\n"); len(entry) > 0 {
+		src := model.Source{Listener: ListenerFile, Addr: t.path}
+		full := f.buffer.Usage() >= f.buffer.Capacity()
+		if full || f.buffer.PushFrom(append([]byte(nil), entry...), src) != nil {
+			if err := t.rewind(); err != nil {
+				log.Printf("File Ingestor: %v", err)
+			}
+			return false
+		}
+	}
+	t.offset += int64(len(t.pending))
+	t.pending = t.pending[:0]
+	f.dirty = true
+	return true
+}
+
+// flushPending pushes a final line that has no newline.
+func (f *FileIngestor) flushPending(t *tailedFile) bool {
+	return len(t.pending) == 0 || f.pushPending(t)
+}
+
+// truncated reports whether the file shrank below the offset or its head
+// no longer matches the fingerprint, which grows until it is n bytes.
+func (t *tailedFile) truncated(n int) (bool, error) {
+	info, err := t.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	fp, err := readFingerprint(t.file, n)
+	if err != nil {
+		return false, err
+	}
+	same := bytes.HasPrefix(fp, t.fingerprint)
+	t.fingerprint = fp
+	return info.Size() < t.offset || !same, nil
+}
+
+// rewind drops anything read past the offset and seeks back to it.
+func (t *tailedFile) rewind() error {
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking %s: %w", t.path, err)
+	}
+	t.reader.Reset(t.file)
+	t.pending = t.pending[:0]
+	return nil
+}
+
+// readFingerprint returns up to the first n bytes of file.
+func readFingerprint(file *os.File, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := file.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// loadCheckpoints reads the checkpoint file. A missing file means no
+// checkpoints.
+func loadCheckpoints(path string) ([]fileCheckpoint, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading checkpoint file: %w", err)
+	}
+	var cp struct {
+		Files []fileCheckpoint `json:"files"`
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file %s: %w", path, err)
+	}
+	return cp.Files, nil
+}
+
+// saveCheckpoint writes the offsets of the open files, plus the loaded
+// checkpoints no file has matched yet (a file missing at startup resumes
+// when it shows up). It writes a temporary file and renames it over the old
+// one, so a crash leaves either the old or the new checkpoints.
+func (f *FileIngestor) saveCheckpoint() error {
+	if f.cfg.CheckpointFile == "" {
+		return nil
+	}
+	var cp struct {
+		Files []fileCheckpoint `json:"files"`
+	}
+	cp.Files = make([]fileCheckpoint, 0, len(f.files)+len(f.saved))
+	cp.Files = append(cp.Files, f.saved...)
+	for _, t := range f.files {
+		cp.Files = append(cp.Files, fileCheckpoint{
+			Path:        t.path,
+			Dev:         t.id.dev,
+			Inode:       t.id.inode,
+			Fingerprint: t.fingerprint,
+			Offset:      t.offset,
+		})
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.cfg.CheckpointFile), filepath.Base(f.cfg.CheckpointFile)+".*")
+	if err != nil {
+		return fmt.Errorf("writing checkpoint file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.cfg.CheckpointFile)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing checkpoint file: %w", err)
+	}
+	f.dirty = false
+	return nil
+}
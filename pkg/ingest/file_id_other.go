@@ -0,0 +1,16 @@
+//go:build !unix
+
+package ingest
+
+import "os"
+
+// fileID is a file's device and inode. The zero value means unknown.
+type fileID struct {
+	dev, inode uint64
+}
+
+func (id fileID) known() bool { return id != fileID{} }
+
+// statFileID has no inodes to offer here, so files are told apart by path
+// and fingerprint.
+func statFileID(os.FileInfo) fileID { return fileID{} }
@@ -0,0 +1,23 @@
+//go:build unix
+
+package ingest
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID is a file's device and inode. The zero value means unknown.
+type fileID struct {
+	dev, inode uint64
+}
+
+func (id fileID) known() bool { return id != fileID{} }
+
+func statFileID(info os.FileInfo) fileID {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}
+	}
+	return fileID{dev: uint64(st.Dev), inode: uint64(st.Ino)}
+}
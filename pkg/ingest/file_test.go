@@ -0,0 +1,232 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"streamgate/pkg/engine"
+	"testing"
+)
+
+func appendFile(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestFileIngestor(t *testing.T, rb *engine.RingBuffer, cfg FileConfig) *FileIngestor {
+	t.Helper()
+	f, err := NewFileIngestor(rb, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, tf := range f.files {
+			tf.file.Close()
+		}
+	})
+	return f
+}
+
+func TestFileIngestor_StartAt(t *testing.T) {
+	tests := []struct {
+		startAt string
+		want    []string
+	}{
+		{FileStartAtBeginning, []string{"a", "b", "c", "d"}},
+		{FileStartAtEnd, []string{"c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.startAt, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			appendFile(t, path, "a\nb\n")
+
+			rb, _ := engine.NewRingBuffer(16)
+			f := newTestFileIngestor(t, rb, FileConfig{Include: []string{filepath.Join(dir, "*.log")}, StartAt: tt.startAt})
+			f.poll()
+			appendFile(t, path, "c\r\n\nd\n")
+			f.poll()
+
+			// Files created after startup are read from the beginning.
+			appendFile(t, filepath.Join(dir, "new.log"), "x\n")
+			appendFile(t, filepath.Join(dir, "new.txt"), "ignored\n")
+			f.poll()
+			want := append(tt.want, "x")
+
+			var got []string
+			for entry, src := rb.PopFrom(); entry != nil; entry, src = rb.PopFrom() {
+				got = append(got, string(entry))
+				if src.Listener != ListenerFile {
+					t.Errorf("listener = %q, want %q", src.Listener, ListenerFile)
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("entries = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFileIngestor_Checkpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	cfg := FileConfig{
+		Include:        []string{path},
+		StartAt:        FileStartAtBeginning,
+		CheckpointFile: filepath.Join(dir, "checkpoint.json"),
+	}
+	appendFile(t, path, "one\ntwo\nthr")
+
+	rb, _ := engine.NewRingBuffer(16)
+	f := newTestFileIngestor(t, rb, cfg)
+	f.poll()
+	if got := drain(rb); !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Fatalf("first run = %q", got)
+	}
+
+	// A restart resumes at the partial line, even with StartAt beginning.
+	appendFile(t, path, "ee\nfour\n")
+	f = newTestFileIngestor(t, rb, cfg)
+	f.poll()
+	if got := drain(rb); !reflect.DeepEqual(got, []string{"three", "four"}) {
+		t.Errorf("after restart = %q", got)
+	}
+
+	// A different file at the same path (recycled inode or not) has another
+	// fingerprint and is read from the beginning.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "other\nfile\nhere\n")
+	f = newTestFileIngestor(t, rb, cfg)
+	f.poll()
+	if got := drain(rb); !reflect.DeepEqual(got, []string{"other", "file", "here"}) {
+		t.Errorf("replaced file = %q", got)
+	}
+}
+
+func TestFileIngestor_CheckpointKeepsMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	app, other := filepath.Join(dir, "app.log"), filepath.Join(dir, "other.log")
+	cfg := FileConfig{
+		Include:        []string{filepath.Join(dir, "*.log")},
+		StartAt:        FileStartAtBeginning,
+		CheckpointFile: filepath.Join(dir, "checkpoint.json"),
+	}
+	appendFile(t, app, "a1\n")
+	appendFile(t, other, "o1\n")
+
+	rb, _ := engine.NewRingBuffer(16)
+	newTestFileIngestor(t, rb, cfg).poll()
+	drain(rb)
+
+	// other.log is missing for one run (an unmounted volume, say); its
+	// checkpoint must outlive that run's saves.
+	hidden := filepath.Join(dir, "other.hidden")
+	if err := os.Rename(other, hidden); err != nil {
+		t.Fatal(err)
+	}
+	newTestFileIngestor(t, rb, cfg).poll()
+
+	if err := os.Rename(hidden, other); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, other, "o2\n")
+	newTestFileIngestor(t, rb, cfg).poll()
+	if got := drain(rb); !reflect.DeepEqual(got, []string{"o2"}) {
+		t.Errorf("entries = %q, want [o2]", got)
+	}
+}
+
+func TestFileIngestor_Rotation(t *testing.T) {
+	tests := []struct {
+		name   string
+		rotate func(t *testing.T, path string)
+	}{
+		{
+			name: "rename",
+			rotate: func(t *testing.T, path string) {
+				if err := os.Rename(path, path+".1"); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, path+".1", "late\n") // written before the app reopens
+			},
+		},
+		{
+			name: "copytruncate",
+			rotate: func(t *testing.T, path string) {
+				if err := os.Truncate(path, 0); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			appendFile(t, path, "before\n")
+
+			rb, _ := engine.NewRingBuffer(16)
+			f := newTestFileIngestor(t, rb, FileConfig{Include: []string{filepath.Join(dir, "*.log")}, StartAt: FileStartAtBeginning})
+			f.poll()
+			tt.rotate(t, path)
+			appendFile(t, path, "after\n")
+			f.poll()
+			f.poll()
+
+			got := drain(rb)
+			want := []string{"before", "after"}
+			if tt.name == "rename" {
+				want = []string{"before", "late", "after"}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("entries = %q, want %q", got, want)
+			}
+			if len(f.files) != 1 {
+				t.Errorf("%d files open, want 1", len(f.files))
+			}
+		})
+	}
+}
+
+func TestFileIngestor_BufferFull(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "a\nb\nc\n")
+
+	rb, _ := engine.NewRingBuffer(2)
+	f := newTestFileIngestor(t, rb, FileConfig{Include: []string{path}, StartAt: FileStartAtBeginning})
+	var got []string
+	for i := 0; i < 3; i++ {
+		f.poll()
+		got = append(got, drain(rb)...)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if rb.DroppedCount() != 0 {
+		t.Errorf("dropped %d", rb.DroppedCount())
+	}
+}
+
+func TestNewFileIngestor_Invalid(t *testing.T) {
+	rb, _ := engine.NewRingBuffer(2)
+	for name, cfg := range map[string]FileConfig{
+		"no include":  {},
+		"bad pattern": {Include: []string{"[bad"}},
+		"bad exclude": {Include: []string{"*.log"}, Exclude: []string{"[bad"}},
+		"bad start":   {Include: []string{"*.log"}, StartAt: "middle"},
+	} {
+		if _, err := NewFileIngestor(rb, cfg); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"streamgate/pkg/engine"
+	"streamgate/pkg/model"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// ListenerForward is the listener name attached to entries received by the
+// Fluent Forward ingestor.
+const ListenerForward = "forward"
+
+// maxForwardChunk bounds a decompressed CompressedPackedForward chunk. A
+// larger one is treated as a protocol error and the connection is closed.
+const maxForwardChunk = 64 << 20 // 64 MiB
+
+// eventTimeExt is the msgpack extension type of a Forward EventTime:
+// seconds and nanoseconds as two big-endian uint32s.
+const eventTimeExt = 0
+
+// ForwardIngestor receives the Fluent Forward protocol (Fluent Bit's and
+// Fluentd's "forward" output): msgpack over TCP in Message, Forward,
+// PackedForward and CompressedPackedForward modes. Each record becomes a JSON
+// entry with its tag and time:
+//
+//	["kube.app", EventTime, {"log":"hello","stream":"stdout"}]
+//	{"log":"hello","stream":"stdout","tag":"kube.app","timestamp":"2024-06-01T12:00:00.5Z"}
+//
+// A record's own "tag" or "timestamp" field is kept over the added one.
+//
+// When the sender asks for an ack (the "chunk" option, Fluent Bit's
+// require_ack_response), the ack is sent only after every record of the
+// message is in the buffer. If they don't all fit, nothing is pushed and the
+// connection is closed, so the sender retries the chunk instead of losing it.
+// Messages without a chunk option are pushed with tail drop, like TCP.
+type ForwardIngestor struct {
+	addr   string
+	buffer *engine.RingBuffer
+}
+
+func NewForwardIngestor(addr string, buffer *engine.RingBuffer) *ForwardIngestor {
+	return &ForwardIngestor{
+		addr:   addr,
+		buffer: buffer,
+	}
+}
+
+// Start begins listening on the TCP address. Blocking call.
+func (f *ForwardIngestor) Start() error {
+	listener, err := net.Listen("tcp", f.addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Forward Ingestor listening on %s", f.addr)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			log.Printf("Error accepting connection: %v", err)
+			continue
+		}
+		go f.handleConnection(conn)
+	}
+}
+
+func (f *ForwardIngestor) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	src := model.Source{Listener: ListenerForward, Addr: conn.RemoteAddr().String()}
+	dec := msgpack.NewDecoder(bufio.NewReader(conn))
+	dec.UseLooseInterfaceDecoding(true) // bin as string, all ints as int64/uint64
+
+	for {
+		entries, chunk, err := decodeForwardMessage(dec)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Forward read error from %s: %v", src.Addr, err)
+			}
+			return
+		}
+		if chunk == "" {
+			for _, entry := range entries {
+				// On buffer full, silently drop (tail drop strategy).
+				_ = f.buffer.PushFrom(entry, src)
+			}
+			continue
+		}
+		if pushAll(f.buffer, entries, src) {
+			log.Printf("Forward: buffer full, closing %s so chunk %s is retried", src.Addr, chunk)
+			return
+		}
+		if err := msgpack.NewEncoder(conn).Encode(map[string]string{"ack": chunk}); err != nil {
+			log.Printf("Forward ack to %s failed: %v", src.Addr, err)
+			return
+		}
+	}
+}
+
+// decodeForwardMessage reads one message in any of the four modes and
+// returns its records as JSON entries, plus the chunk ID to ack (if any).
+// It returns io.EOF at a clean end of stream.
+func decodeForwardMessage(dec *msgpack.Decoder) ([][]byte, string, error) {
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		return nil, "", err
+	}
+	if n < 2 || n > 4 {
+		return nil, "", fmt.Errorf("message is an array of %d, want 2 to 4", n)
+	}
+	tag, err := dec.DecodeString()
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding tag: %w", err)
+	}
+	code, err := dec.PeekCode()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var entries [][]byte
+	var packed []byte
+	fields := 2 // tag and entries
+	switch {
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		// Forward: [tag, [[time, record], ...], option?]
+		m, err := dec.DecodeArrayLen()
+		if err != nil {
+			return nil, "", err
+		}
+		for i := 0; i < m; i++ {
+			entry, err := decodeForwardEntry(dec, tag)
+			if err != nil {
+				return nil, "", err
+			}
+			entries = append(entries, entry)
+		}
+	case msgpcode.IsString(code) || msgpcode.IsBin(code):
+		// PackedForward: [tag, <concatenated [time, record]>, option?]
+		// The entries are decoded once the option says if they're compressed.
+		if packed, err = dec.DecodeBytes(); err != nil {
+			return nil, "", err
+		}
+	default:
+		// Message: [tag, time, record, option?]
+		if n < 3 {
+			return nil, "", fmt.Errorf("message mode without a record")
+		}
+		t, err := decodeEventTime(dec)
+		if err != nil {
+			return nil, "", err
+		}
+		entry, err := decodeRecord(dec, tag, t)
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, entry)
+		fields = 3
+	}
+
+	var option map[string]interface{}
+	switch n - fields {
+	case 0:
+	case 1:
+		if option, err = dec.DecodeMap(); err != nil {
+			return nil, "", fmt.Errorf("decoding option: %w", err)
+		}
+	default:
+		return nil, "", fmt.Errorf("unexpected fields after option")
+	}
+	chunk, _ := option["chunk"].(string)
+
+	if packed != nil {
+		if compressed, _ := option["compressed"].(string); compressed == "gzip" {
+			if packed, err = gunzipChunk(packed); err != nil {
+				return nil, "", err
+			}
+		}
+		if entries, err = decodePackedEntries(packed, tag); err != nil {
+			return nil, "", err
+		}
+	}
+	return entries, chunk, nil
+}
+
+// decodePackedEntries decodes a PackedForward stream of [time, record].
+func decodePackedEntries(packed []byte, tag string) ([][]byte, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(packed))
+	dec.UseLooseInterfaceDecoding(true)
+	var entries [][]byte
+	for {
+		entry, err := decodeForwardEntry(dec, tag)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("packed entries: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// gunzipChunk decompresses a CompressedPackedForward chunk, which may be
+// several concatenated gzip members.
+func gunzipChunk(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("compressed entries: %w", err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, maxForwardChunk+1))
+	if err != nil {
+		return nil, fmt.Errorf("compressed entries: %w", err)
+	}
+	if len(out) > maxForwardChunk {
+		return nil, fmt.Errorf("compressed entries exceed %d bytes", maxForwardChunk)
+	}
+	return out, nil
+}
+
+// decodeForwardEntry reads one [time, record] pair.
+func decodeForwardEntry(dec *msgpack.Decoder, tag string) ([]byte, error) {
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+	if n != 2 {
+		return nil, fmt.Errorf("entry is an array of %d, want 2", n)
+	}
+	t, err := decodeEventTime(dec)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRecord(dec, tag, t)
+}
+
+// decodeEventTime reads an EventTime extension or integer (or float) Unix
+// seconds.
+func decodeEventTime(dec *msgpack.Decoder) (time.Time, error) {
+	code, err := dec.PeekCode()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if msgpcode.IsExt(code) || msgpcode.IsFixedExt(code) {
+		id, n, err := dec.DecodeExtHeader()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if id != eventTimeExt || n != 8 {
+			return time.Time{}, fmt.Errorf("time is extension %d of %d bytes, want EventTime", id, n)
+		}
+		var b [8]byte
+		if err := dec.ReadFull(b[:]); err != nil {
+			return time.Time{}, err
+		}
+		sec, nsec := binary.BigEndian.Uint32(b[:4]), binary.BigEndian.Uint32(b[4:])
+		return time.Unix(int64(sec), int64(nsec)), nil
+	}
+	v, err := dec.DecodeInterfaceLoose()
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch v := v.(type) {
+	case int64:
+		return time.Unix(v, 0), nil
+	case uint64:
+		return time.Unix(int64(v), 0), nil
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	return time.Time{}, fmt.Errorf("time is %T, want EventTime or integer", v)
+}
+
+// decodeRecord reads a record map and encodes it as the JSON entry.
+func decodeRecord(dec *msgpack.Decoder, tag string, t time.Time) ([]byte, error) {
+	record, err := dec.DecodeMap()
+	if err != nil {
+		return nil, fmt.Errorf("decoding record: %w", err)
+	}
+	if record == nil {
+		record = make(map[string]interface{}, 2)
+	}
+	if _, ok := record["tag"]; !ok {
+		record["tag"] = tag
+	}
+	if _, ok := record["timestamp"]; !ok {
+		record["timestamp"] = t.UTC().Format(time.RFC3339Nano)
+	}
+	for k, v := range record {
+		record[k] = jsonSafe(v)
+	}
+	entry, err := marshalEntry(record)
+	if err != nil {
+		return nil, fmt.Errorf("encoding record: %w", err)
+	}
+	return entry, nil
+}
+
+// jsonSafe replaces what encoding/json rejects (NaN and infinite floats)
+// with null.
+func jsonSafe(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonSafe(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonSafe(e)
+		}
+	}
+	return v
+}
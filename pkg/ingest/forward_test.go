@@ -0,0 +1,167 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net"
+	"streamgate/pkg/engine"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// eventTime encodes t as a Forward EventTime (fixext 8, type 0).
+func eventTime(t time.Time) msgpack.RawMessage {
+	b := []byte{0xd7, eventTimeExt, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[2:], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[6:], uint32(t.Nanosecond()))
+	return b
+}
+
+func mustMsgpack(t *testing.T, vs ...interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for _, v := range vs {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeForwardMessage(t *testing.T) {
+	ts := time.Date(2024, 6, 1, 12, 0, 0, 500000000, time.UTC)
+	record := map[string]interface{}{"log": "hello", "level": "info"}
+	packed := mustMsgpack(t,
+		[]interface{}{eventTime(ts), record},
+		[]interface{}{eventTime(ts), map[string]interface{}{"log": "second"}},
+	)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(packed)
+	zw.Close()
+
+	tests := []struct {
+		name      string
+		msg       []interface{}
+		wantChunk string
+		want      []map[string]string // per entry: gjson path -> value
+	}{
+		{
+			"message with integer time",
+			[]interface{}{"app.web", ts.Unix(), record},
+			"",
+			[]map[string]string{{"tag": "app.web", "timestamp": "2024-06-01T12:00:00Z", "log": "hello", "level": "info"}},
+		},
+		{
+			"message with option",
+			[]interface{}{"app.web", eventTime(ts), record, map[string]interface{}{"chunk": "c1"}},
+			"c1",
+			[]map[string]string{{"timestamp": "2024-06-01T12:00:00.5Z", "log": "hello"}},
+		},
+		{
+			"forward",
+			[]interface{}{"kube.app", []interface{}{
+				[]interface{}{eventTime(ts), record},
+				[]interface{}{eventTime(ts), map[string]interface{}{"tag": "own", "nested": map[string]interface{}{"n": 1}}},
+			}, map[string]interface{}{"chunk": "c2", "size": 2}},
+			"c2",
+			[]map[string]string{{"tag": "kube.app", "log": "hello"}, {"tag": "own", "nested.n": "1"}},
+		},
+		{
+			"packed forward",
+			[]interface{}{"kube.app", packed},
+			"",
+			[]map[string]string{{"tag": "kube.app", "log": "hello"}, {"log": "second"}},
+		},
+		{
+			"compressed packed forward",
+			[]interface{}{"kube.app", gz.Bytes(), map[string]interface{}{"chunk": "c3", "compressed": "gzip"}},
+			"c3",
+			[]map[string]string{{"tag": "kube.app", "log": "hello"}, {"log": "second"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := msgpack.NewDecoder(bytes.NewReader(mustMsgpack(t, tt.msg)))
+			dec.UseLooseInterfaceDecoding(true)
+			entries, chunk, err := decodeForwardMessage(dec)
+			if err != nil {
+				t.Fatalf("decodeForwardMessage: %v", err)
+			}
+			if chunk != tt.wantChunk {
+				t.Errorf("chunk = %q, want %q", chunk, tt.wantChunk)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d: %q", len(entries), len(tt.want), entries)
+			}
+			for i, want := range tt.want {
+				for path, v := range want {
+					if got := gjson.GetBytes(entries[i], path).String(); got != v {
+						t.Errorf("entry %d: %s = %q, want %q (%s)", i, path, got, v, entries[i])
+					}
+				}
+			}
+		})
+	}
+
+	bad := [][]interface{}{
+		{"tag"},
+		{"tag", ts.Unix()},
+		{"tag", "not a time", record},
+		{"tag", ts.Unix(), "not a record"},
+		{"tag", []interface{}{[]interface{}{ts.Unix()}}},
+		{"tag", []byte("\x92\x01"), map[string]interface{}{"compressed": "gzip"}},
+		{"tag", []interface{}{}, map[string]interface{}{}, "extra"},
+	}
+	for _, msg := range bad {
+		dec := msgpack.NewDecoder(bytes.NewReader(mustMsgpack(t, msg)))
+		if _, _, err := decodeForwardMessage(dec); err == nil || err == io.EOF {
+			t.Errorf("decodeForwardMessage(%v) err = %v, want a protocol error", msg, err)
+		}
+	}
+}
+
+func TestForwardIngestor_Ack(t *testing.T) {
+	rb, _ := engine.NewRingBuffer(2)
+	f := NewForwardIngestor("", rb)
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		f.handleConnection(server)
+		close(done)
+	}()
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	dec := msgpack.NewDecoder(client)
+
+	entry := []interface{}{time.Now().Unix(), map[string]string{"log": "x"}}
+	client.Write(mustMsgpack(t, []interface{}{"t", []interface{}{entry, entry}, map[string]string{"chunk": "fits"}}))
+	ack, err := dec.DecodeMap()
+	if err != nil || ack["ack"] != "fits" {
+		t.Fatalf("ack = %v, %v; want fits", ack, err)
+	}
+	if got := drain(rb); len(got) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got))
+	}
+
+	// Three records never fit in two slots: no ack, nothing pushed, and the
+	// connection is closed so the sender retries.
+	client.Write(mustMsgpack(t, []interface{}{"t", []interface{}{entry, entry, entry}, map[string]string{"chunk": "too-big"}}))
+	if ack, err := dec.DecodeMap(); err == nil {
+		t.Errorf("got ack %v for a chunk that didn't fit", ack)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection handler did not return")
+	}
+	if got := drain(rb); len(got) != 0 {
+		t.Errorf("entries = %q, want none", got)
+	}
+}
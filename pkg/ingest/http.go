@@ -0,0 +1,256 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"streamgate/pkg/engine"
+	"streamgate/pkg/model"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tidwall/gjson"
+)
+
+// ListenerHTTP is the listener name attached to entries received over HTTP.
+const ListenerHTTP = "http"
+
+// IngestPath is where the HTTP ingestor accepts logs.
+const IngestPath = "/ingest"
+
+const (
+	defaultHTTPMaxBodyBytes = 10 << 20 // 10 MiB
+	defaultHTTPRetryAfter   = time.Second
+)
+
+// HTTPConfig holds the HTTP ingestor's options.
+type HTTPConfig struct {
+	// MaxBodyBytes limits a request body, both as sent and after
+	// decompression (default 10 MiB). Larger requests get 413.
+	MaxBodyBytes int64
+
+	// BearerToken, if set, is required in "Authorization: Bearer <token>".
+	BearerToken string
+
+	// RetryAfter is advertised on 429 responses (default 1s).
+	RetryAfter time.Duration
+}
+
+// HTTPIngestor accepts logs POSTed to IngestPath and pushes them to the
+// buffer. A body is one of:
+//   - a JSON array: each element is an entry
+//   - a single JSON value: one entry
+//   - anything else (NDJSON, plain text): each non-empty line is an entry
+//
+// Content-Type text/plain always splits on lines. Bodies may be gzip or
+// zstd compressed (Content-Encoding).
+//
+// Unlike TCP and UDP, HTTP can push back: if the buffer can't take a
+// request's entries, the request is rejected with 429 and Retry-After.
+type HTTPIngestor struct {
+	addr   string
+	buffer *engine.RingBuffer
+	cfg    HTTPConfig
+}
+
+func NewHTTPIngestor(addr string, buffer *engine.RingBuffer, cfg HTTPConfig) *HTTPIngestor {
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = defaultHTTPMaxBodyBytes
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = defaultHTTPRetryAfter
+	}
+	return &HTTPIngestor{
+		addr:   addr,
+		buffer: buffer,
+		cfg:    cfg,
+	}
+}
+
+// Start begins listening on the HTTP address, serving IngestPath,
+// OTLPLogsPath and the vendor intake endpoints. Blocking call.
+func (h *HTTPIngestor) Start() error {
+	server := &http.Server{
+		Addr:              h.addr,
+		Handler:           h.mux(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("HTTP Ingestor listening on %s", h.addr)
+	return server.ListenAndServe()
+}
+
+func (h *HTTPIngestor) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(IngestPath, h)
+	mux.Handle(OTLPLogsPath, otlpLogsHandler{h})
+
+	hecEvent := splunkHECHandler{h: h}
+	mux.Handle("/services/collector", hecEvent)
+	mux.Handle(SplunkHECEventPath, hecEvent)
+	mux.Handle(SplunkHECEventPath+"/1.0", hecEvent)
+	mux.Handle(SplunkHECRawPath, splunkHECHandler{h: h, raw: true})
+	mux.Handle(SplunkHECRawPath+"/1.0", splunkHECHandler{h: h, raw: true})
+	mux.HandleFunc(SplunkHECHealthPath, h.splunkHECHealth)
+	mux.Handle(DatadogLogsPath, datadogLogsHandler{h})
+	mux.Handle(LokiPushPath, lokiPushHandler{h})
+	mux.Handle(ElasticBulkPath, elasticBulkHandler{h})
+	mux.Handle(ElasticIndexBulkPath, elasticBulkHandler{h})
+	mux.HandleFunc(http.MethodGet+" "+ElasticInfoPath, elasticBulkHandler{h}.info)
+	mux.HandleFunc(http.MethodGet+" "+ElasticHealthPath, elasticBulkHandler{h}.health)
+	return mux
+}
+
+// httpError is a request failure with the status to report.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+func (h *HTTPIngestor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := h.readBody(w, r)
+	if err != nil {
+		var he *httpError
+		if errors.As(err, &he) {
+			http.Error(w, he.msg, he.status)
+		} else {
+			http.Error(w, "reading body: "+err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	entries, err := splitBody(body, r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accepted := len(entries)
+	w.Header().Set("Content-Type", "application/json")
+	if pushAll(h.buffer, entries, model.Source{Listener: ListenerHTTP, Addr: r.RemoteAddr}) {
+		accepted = 0
+		w.Header().Set("Retry-After", h.retryAfter())
+		w.WriteHeader(http.StatusTooManyRequests)
+	} else {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	fmt.Fprintf(w, `{"accepted":%d,"rejected":%d}`+"\n", accepted, len(entries)-accepted)
+}
+
+func (h *HTTPIngestor) authorized(r *http.Request) bool {
+	if h.cfg.BearerToken == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.BearerToken)) == 1
+}
+
+// readBody reads and decompresses the body, enforcing MaxBodyBytes.
+func (h *HTTPIngestor) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	tooLarge := &httpError{http.StatusRequestEntityTooLarge, "body too large"}
+	var reader io.Reader = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+
+	switch enc := strings.ToLower(r.Header.Get("Content-Encoding")); enc {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, h.readError(err, tooLarge)
+		}
+		defer zr.Close()
+		reader = zr
+	case "zstd":
+		zr, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return nil, &httpError{http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported Content-Encoding %q", enc)}
+	}
+
+	// Read one byte past the limit to tell "exactly the limit" from "more".
+	body, err := io.ReadAll(io.LimitReader(reader, h.cfg.MaxBodyBytes+1))
+	if err != nil {
+		return nil, h.readError(err, tooLarge)
+	}
+	if int64(len(body)) > h.cfg.MaxBodyBytes {
+		return nil, tooLarge
+	}
+	return body, nil
+}
+
+func (h *HTTPIngestor) readError(err, tooLarge error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return tooLarge
+	}
+	return err
+}
+
+// pushAll hands a request's entries to the buffer, for the listeners that
+// can push back. They go in all at once or not at all, so a rejected
+// request can be retried without duplicating anything.
+func pushAll(buffer *engine.RingBuffer, entries [][]byte, src model.Source) (full bool) {
+	return buffer.PushAllFrom(entries, src) != nil
+}
+
+// splitBody turns a request body into entries. They alias body, which is
+// never reused, so the buffer can own them without copying.
+func splitBody(body []byte, contentType string) ([][]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+
+	if mediaType != "text/plain" && gjson.ValidBytes(trimmed) {
+		if trimmed[0] != '[' {
+			return [][]byte{trimmed}, nil
+		}
+		var entries [][]byte
+		gjson.ParseBytes(trimmed).ForEach(func(_, value gjson.Result) bool {
+			// Raw is a substring of trimmed; Index locates it without copying.
+			entries = append(entries, trimmed[value.Index:value.Index+len(value.Raw)])
+			return true
+		})
+		return entries, nil
+	}
+	if mediaType == "application/json" && trimmed[0] == '[' {
+		return nil, fmt.Errorf("invalid JSON array")
+	}
+
+	var entries [][]byte
+	for len(trimmed) > 0 {
+		line := trimmed
+		if i := bytes.IndexByte(trimmed, '\n'); i >= 0 {
+			line, trimmed = trimmed[:i], trimmed[i+1:]
+		} else {
+			trimmed = nil
+		}
+		if line = bytes.TrimRight(line, "\r"); len(bytes.TrimSpace(line)) > 0 {
+			entries = append(entries, line)
+		}
+	}
+	return entries, nil
+}
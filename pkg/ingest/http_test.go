@@ -0,0 +1,145 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"streamgate/pkg/engine"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func drain(rb *engine.RingBuffer) []string {
+	var items []string
+	for item := rb.Pop(); item != nil; item = rb.Pop() {
+		items = append(items, string(item))
+	}
+	return items
+}
+
+func TestHTTPIngestor_Bodies(t *testing.T) {
+	gz := func(s string) []byte {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		w.Write([]byte(s))
+		w.Close()
+		return b.Bytes()
+	}
+	zs := func(s string) []byte {
+		enc, _ := zstd.NewWriter(nil)
+		return enc.EncodeAll([]byte(s), nil)
+	}
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		encoding    string
+		wantStatus  int
+		want        []string
+	}{
+		{"ndjson", []byte("{\"a\":1}\n\n{\"a\":2}\r\n"), "application/x-ndjson", "", http.StatusAccepted, []string{`{"a":1}`, `{"a":2}`}},
+		{"json array", []byte(`[{"a":1}, {"a":2}, "x"]`), "application/json", "", http.StatusAccepted, []string{`{"a":1}`, `{"a":2}`, `"x"`}},
+		{"single json object", []byte("{\n  \"a\": 1\n}\n"), "application/json", "", http.StatusAccepted, []string{"{\n  \"a\": 1\n}"}},
+		{"plain text", []byte("line one\nline two\n"), "text/plain; charset=utf-8", "", http.StatusAccepted, []string{"line one", "line two"}},
+		{"plain text that looks like json", []byte(`[1]`), "text/plain", "", http.StatusAccepted, []string{`[1]`}},
+		{"gzip", gz("a\nb\n"), "text/plain", "gzip", http.StatusAccepted, []string{"a", "b"}},
+		{"zstd", zs(`[{"z":1}]`), "application/json", "zstd", http.StatusAccepted, []string{`{"z":1}`}},
+		{"bad gzip", []byte("not gzip"), "text/plain", "gzip", http.StatusBadRequest, nil},
+		{"unknown encoding", []byte("x"), "text/plain", "br", http.StatusUnsupportedMediaType, nil},
+		{"invalid json array", []byte(`[{"a":1},`), "application/json", "", http.StatusBadRequest, nil},
+		{"empty", nil, "text/plain", "", http.StatusAccepted, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb, _ := engine.NewRingBuffer(16)
+			h := NewHTTPIngestor("", rb, HTTPConfig{})
+
+			req := httptest.NewRequest(http.MethodPost, IngestPath, bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := drain(rb); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPIngestor_BufferFull(t *testing.T) {
+	rb, _ := engine.NewRingBuffer(2)
+	h := NewHTTPIngestor("", rb, HTTPConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, IngestPath, strings.NewReader("a\nb\nc\n"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want %q", got, "1")
+	}
+	if got := drain(rb); len(got) != 0 {
+		t.Errorf("entries = %q, want none (a rejected request pushes nothing)", got)
+	}
+}
+
+func TestHTTPIngestor_AuthAndLimits(t *testing.T) {
+	rb, _ := engine.NewRingBuffer(16)
+	h := NewHTTPIngestor("", rb, HTTPConfig{BearerToken: "s3cret", MaxBodyBytes: 64})
+
+	gzBomb := func() []byte {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		w.Write(bytes.Repeat([]byte("a"), 1000))
+		w.Close()
+		return b.Bytes()
+	}()
+	if len(gzBomb) > 64 {
+		t.Fatalf("compressed body is %d bytes, want it under the limit", len(gzBomb))
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		auth       string
+		encoding   string
+		body       []byte
+		wantStatus int
+	}{
+		{"ok", http.MethodPost, "Bearer s3cret", "", []byte("hi"), http.StatusAccepted},
+		{"missing token", http.MethodPost, "", "", []byte("hi"), http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "Bearer nope", "", []byte("hi"), http.StatusUnauthorized},
+		{"wrong method", http.MethodGet, "Bearer s3cret", "", nil, http.StatusMethodNotAllowed},
+		{"body too large", http.MethodPost, "Bearer s3cret", "", bytes.Repeat([]byte("a"), 65), http.StatusRequestEntityTooLarge},
+		{"decompressed too large", http.MethodPost, "Bearer s3cret", "gzip", gzBomb, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, IngestPath, bytes.NewReader(tt.body))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
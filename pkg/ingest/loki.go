@@ -0,0 +1,307 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"streamgate/pkg/model"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ListenerLoki is the listener name attached to entries received on the
+// Loki push endpoint.
+const ListenerLoki = "loki"
+
+// LokiPushPath is Loki's push API.
+const LokiPushPath = "/loki/api/v1/push"
+
+// lokiPushHandler emulates Loki's push API, as used by Promtail, Grafana
+// Alloy and the Loki Docker driver: snappy-compressed protobuf (the
+// default) or JSON:
+//
+//	{"streams":[{"stream":{"app":"web","env":"prod"},
+//	  "values":[["1717243200500000000","GET /",{"trace_id":"abc"}]]}]}
+//
+// Each line becomes {"message": line, "timestamp": ...} with its structured
+// metadata and then its stream's labels added as fields. The tenant
+// (X-Scope-OrgID) is added as "tenant". A full buffer gets 429, which
+// clients retry.
+type lokiPushHandler struct {
+	h *HTTPIngestor
+}
+
+// lokiStream is a decoded stream, from either encoding.
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	ts       time.Time
+	line     string
+	metadata map[string]string
+}
+
+func (l lokiPushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !l.h.vendorAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := l.h.readBody(w, r)
+	if err != nil {
+		var he *httpError
+		if errors.As(err, &he) {
+			http.Error(w, he.msg, he.status)
+		} else {
+			http.Error(w, "reading body: "+err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	var streams []lokiStream
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == contentTypeJSON {
+		streams, err = decodeLokiJSON(body)
+	} else {
+		if n, err := snappy.DecodedLen(body); err == nil && int64(n) > l.h.cfg.MaxBodyBytes {
+			http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		streams, err = decodeLokiProto(body)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := lokiEntries(streams, r.Header.Get("X-Scope-OrgID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if pushAll(l.h.buffer, entries, model.Source{Listener: ListenerLoki, Addr: r.RemoteAddr}) {
+		w.Header().Set("Retry-After", l.h.retryAfter())
+		http.Error(w, "buffer full", http.StatusTooManyRequests)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func lokiEntries(streams []lokiStream, tenant string) ([][]byte, error) {
+	var entries [][]byte
+	for _, s := range streams {
+		for _, e := range s.entries {
+			f := vendorFields{"message": e.line}
+			f.addTime(e.ts)
+			for k, v := range e.metadata {
+				f.add(k, v)
+			}
+			for k, v := range s.labels {
+				f.add(k, v)
+			}
+			f.add("tenant", tenant)
+			entry, err := marshalEntry(f)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// decodeLokiJSON decodes the JSON push format. Timestamps are Unix
+// nanoseconds as strings.
+func decodeLokiJSON(body []byte) ([]lokiStream, error) {
+	var req struct {
+		Streams []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid Loki JSON: %w", err)
+	}
+
+	streams := make([]lokiStream, 0, len(req.Streams))
+	for _, s := range req.Streams {
+		stream := lokiStream{labels: s.Stream}
+		for _, v := range s.Values {
+			if len(v) != 2 && len(v) != 3 {
+				return nil, fmt.Errorf("invalid Loki JSON: value has %d elements, want 2 or 3", len(v))
+			}
+			var ns string
+			var e lokiEntry
+			if err := json.Unmarshal(v[0], &ns); err != nil {
+				return nil, fmt.Errorf("invalid Loki JSON timestamp: %w", err)
+			}
+			n, err := strconv.ParseInt(ns, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Loki JSON timestamp %q", ns)
+			}
+			e.ts = time.Unix(0, n)
+			if err := json.Unmarshal(v[1], &e.line); err != nil {
+				return nil, fmt.Errorf("invalid Loki JSON line: %w", err)
+			}
+			if len(v) == 3 {
+				if err := json.Unmarshal(v[2], &e.metadata); err != nil {
+					return nil, fmt.Errorf("invalid Loki JSON structured metadata: %w", err)
+				}
+			}
+			stream.entries = append(stream.entries, e)
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// decodeLokiProto decodes a snappy-compressed logproto.PushRequest:
+//
+//	PushRequest   { repeated StreamAdapter streams = 1; }
+//	StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	EntryAdapter  { Timestamp timestamp = 1; string line = 2;
+//	                repeated LabelPairAdapter structuredMetadata = 3; }
+func decodeLokiProto(body []byte) ([]lokiStream, error) {
+	b, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy body: %w", err)
+	}
+	var streams []lokiStream
+	err = protoFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num != 1 {
+			return nil
+		}
+		var s lokiStream
+		err := protoFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+			switch num {
+			case 1:
+				labels, err := parseLokiLabels(string(v))
+				s.labels = labels
+				return err
+			case 2:
+				e, err := decodeLokiEntry(v)
+				s.entries = append(s.entries, e)
+				return err
+			}
+			return nil
+		})
+		streams = append(streams, s)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Loki protobuf: %w", err)
+	}
+	return streams, nil
+}
+
+func decodeLokiEntry(b []byte) (lokiEntry, error) {
+	var e lokiEntry
+	err := protoFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1: // google.protobuf.Timestamp
+			var secs, nanos uint64
+			err := protoFields(v, func(num protowire.Number, _ []byte, x uint64) error {
+				switch num {
+				case 1:
+					secs = x
+				case 2:
+					nanos = x
+				}
+				return nil
+			})
+			e.ts = time.Unix(int64(secs), int64(int32(nanos)))
+			return err
+		case 2:
+			e.line = string(v)
+		case 3:
+			var name, value string
+			err := protoFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+				switch num {
+				case 1:
+					name = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			})
+			if e.metadata == nil {
+				e.metadata = make(map[string]string)
+			}
+			e.metadata[name] = value
+			return err
+		}
+		return nil
+	})
+	return e, err
+}
+
+// protoFields calls fn for each field of a protobuf message, with the
+// contents of a length-delimited field in v or the value of a varint in x.
+// Other wire types are skipped.
+func protoFields(b []byte, fn func(num protowire.Number, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLokiLabels parses a label set in Prometheus syntax:
+// {app="web", env="prod"}.
+func parseLokiLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid labels %q", s)
+	}
+	rest := strings.TrimSpace(s[1 : len(s)-1])
+	labels := make(map[string]string)
+	for rest != "" {
+		name, after, ok := strings.Cut(rest, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid labels %q", s)
+		}
+		quoted, err := strconv.QuotedPrefix(strings.TrimSpace(after))
+		if err != nil {
+			return nil, fmt.Errorf("invalid labels %q", s)
+		}
+		value, _ := strconv.Unquote(quoted)
+		labels[name] = value
+		rest = strings.TrimSpace(strings.TrimSpace(after)[len(quoted):])
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+	}
+	return labels, nil
+}
@@ -0,0 +1,126 @@
+package ingest
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	defaultMultilineMaxLines = 500
+	defaultMultilineMaxBytes = 1 << 20 // 1 MiB
+	defaultMultilineTimeout  = time.Second
+)
+
+// MultilineConfig describes how consecutive lines are joined into one event,
+// e.g. a Java stack trace:
+//
+//	Exception in thread "main" java.lang.IllegalStateException: boom
+//	    at com.example.App.run(App.java:42)
+//	    at com.example.App.main(App.java:7)
+//
+// A line matching StartPattern always begins a new event. Otherwise, with
+// ContinuePattern set, a line matching it is appended to the current event
+// and any other line begins a new one. That event still collects the
+// continuation lines after it, so a line matching neither pattern only stands
+// alone if no continuation follows. With only StartPattern set, every
+// non-matching line is appended.
+type MultilineConfig struct {
+	StartPattern    string // e.g. `^\S` or `^\d{4}-\d{2}-\d{2}`
+	ContinuePattern string // e.g. `^\s+(at |\.\.\.)|^Caused by:`
+
+	MaxLines     int           // an event is cut after this many lines (default 500)
+	MaxBytes     int           // ... or this many bytes (default 1 MiB)
+	FlushTimeout time.Duration // a pending event is sent after this long without input (default 1s)
+}
+
+// multilineRules is a compiled MultilineConfig.
+type multilineRules struct {
+	start, cont *regexp.Regexp
+	maxLines    int
+	maxBytes    int
+	timeout     time.Duration
+}
+
+func compileMultiline(cfg MultilineConfig) (*multilineRules, error) {
+	if cfg.StartPattern == "" && cfg.ContinuePattern == "" {
+		return nil, fmt.Errorf("start or continue pattern must be specified")
+	}
+	if cfg.MaxLines < 0 || cfg.MaxBytes < 0 || cfg.FlushTimeout < 0 {
+		return nil, fmt.Errorf("max lines, max bytes and flush timeout must not be negative")
+	}
+
+	r := &multilineRules{
+		maxLines: cfg.MaxLines,
+		maxBytes: cfg.MaxBytes,
+		timeout:  cfg.FlushTimeout,
+	}
+	var err error
+	if cfg.StartPattern != "" {
+		if r.start, err = regexp.Compile(cfg.StartPattern); err != nil {
+			return nil, fmt.Errorf("invalid start pattern: %w", err)
+		}
+	}
+	if cfg.ContinuePattern != "" {
+		if r.cont, err = regexp.Compile(cfg.ContinuePattern); err != nil {
+			return nil, fmt.Errorf("invalid continue pattern: %w", err)
+		}
+	}
+	if r.maxLines == 0 {
+		r.maxLines = defaultMultilineMaxLines
+	}
+	if r.maxBytes == 0 {
+		r.maxBytes = defaultMultilineMaxBytes
+	}
+	if r.timeout == 0 {
+		r.timeout = defaultMultilineTimeout
+	}
+	return r, nil
+}
+
+// continues reports whether line belongs to the event before it.
+func (r *multilineRules) continues(line []byte) bool {
+	if r.start != nil && r.start.Match(line) {
+		return false
+	}
+	if r.cont != nil {
+		return r.cont.Match(line)
+	}
+	return true
+}
+
+// multilineAggregator joins the lines of one connection into events.
+// Lines keep their newlines, so an event is its lines byte-for-byte.
+type multilineAggregator struct {
+	rules *multilineRules
+	emit  func(event []byte)
+
+	event []byte
+	lines int
+}
+
+// add feeds one line, emitting the previous event if the line starts a new one.
+func (a *multilineAggregator) add(line []byte) {
+	if a.lines > 0 && (!a.rules.continues(line) ||
+		a.lines >= a.rules.maxLines || len(a.event)+len(line) > a.rules.maxBytes) {
+		a.flush()
+	}
+	a.event = append(a.event, line...)
+	a.lines++
+}
+
+// pending reports whether an event is waiting for more lines.
+func (a *multilineAggregator) pending() bool {
+	return a.lines > 0
+}
+
+// flush emits the pending event, if any.
+func (a *multilineAggregator) flush() {
+	if a.lines == 0 {
+		return
+	}
+	// The buffer takes ownership of the event, so start a fresh one.
+	a.emit(a.event)
+	a.event = nil
+	a.lines = 0
+}
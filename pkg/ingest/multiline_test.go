@@ -0,0 +1,155 @@
+package ingest
+
+import (
+	"net"
+	"reflect"
+	"streamgate/pkg/engine"
+	"testing"
+	"time"
+)
+
+const javaTrace = "Exception in thread \"main\" java.lang.IllegalStateException: boom\n" +
+	"    at com.example.App.run(App.java:42)\n" +
+	"    at com.example.App.main(App.java:7)\n" +
+	"Caused by: java.io.IOException: disk\n" +
+	"    ... 2 more\n"
+
+func TestMultiline_Aggregate(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   MultilineConfig
+		lines []string
+		want  []string
+	}{
+		{
+			"continue pattern",
+			MultilineConfig{ContinuePattern: `^\s+(at |\.\.\.)|^Caused by:`},
+			[]string{"INFO starting\n", javaTrace, "INFO done\n"},
+			[]string{"INFO starting\n", javaTrace, "INFO done\n"},
+		},
+		{
+			"start pattern",
+			MultilineConfig{StartPattern: `^\d{4}-\d{2}-\d{2} `},
+			[]string{
+				"2024-06-01 ERROR failed\n", "Traceback (most recent call last):\n", "  File \"a.py\", line 1\n",
+				"2024-06-01 INFO ok\n",
+			},
+			[]string{
+				"2024-06-01 ERROR failed\nTraceback (most recent call last):\n  File \"a.py\", line 1\n",
+				"2024-06-01 INFO ok\n",
+			},
+		},
+		{
+			"start and continue: other lines begin an event too",
+			MultilineConfig{StartPattern: `^ERROR`, ContinuePattern: `^\s`},
+			[]string{"ERROR x\n", " detail\n", "noise\n", " orphan\n"},
+			[]string{"ERROR x\n detail\n", "noise\n orphan\n"},
+		},
+		{
+			"continue pattern: continuations join a non-matching line",
+			MultilineConfig{StartPattern: `^ERROR`, ContinuePattern: `^\s`},
+			[]string{"ERROR x\n", "noise\n", " detail\n", " more\n", "alone\n", "ERROR y\n"},
+			[]string{"ERROR x\n", "noise\n detail\n more\n", "alone\n", "ERROR y\n"},
+		},
+		{
+			"max lines",
+			MultilineConfig{ContinuePattern: `^\s`, MaxLines: 2},
+			[]string{"a\n", " 1\n", " 2\n", " 3\n"},
+			[]string{"a\n 1\n", " 2\n 3\n"},
+		},
+		{
+			"max bytes",
+			MultilineConfig{ContinuePattern: `^\s`, MaxBytes: 7},
+			[]string{"abc\n", " d\n", " e\n"},
+			[]string{"abc\n d\n", " e\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileMultiline(tt.cfg)
+			if err != nil {
+				t.Fatalf("compileMultiline() error = %v", err)
+			}
+			var got []string
+			agg := &multilineAggregator{rules: rules, emit: func(e []byte) { got = append(got, string(e)) }}
+			for _, chunk := range tt.lines {
+				for _, line := range splitLines(chunk) {
+					agg.add([]byte(line))
+				}
+			}
+			agg.flush()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	for start := 0; start < len(s); {
+		end := start
+		for end < len(s) && s[end] != '\n' {
+			end++
+		}
+		lines = append(lines, s[start:end+1])
+		start = end + 1
+	}
+	return lines
+}
+
+func TestMultiline_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  MultilineConfig
+	}{
+		{"no patterns", MultilineConfig{}},
+		{"bad start", MultilineConfig{StartPattern: "("}},
+		{"bad continue", MultilineConfig{ContinuePattern: "("}},
+		{"negative limit", MultilineConfig{StartPattern: "^x", MaxLines: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileMultiline(tt.cfg); err == nil {
+				t.Error("compileMultiline() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestTCPIngestor_MultilineFlushTimeout(t *testing.T) {
+	rb, _ := engine.NewRingBuffer(1024)
+	ingestor := NewTCPIngestor("", rb)
+	if err := ingestor.EnableMultiline(MultilineConfig{
+		ContinuePattern: `^\s+at `,
+		FlushTimeout:    50 * time.Millisecond,
+	}); err != nil {
+		t.Fatalf("EnableMultiline() error = %v", err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go ingestor.handleConnection(server)
+
+	// The trace is complete, but nothing follows it: only the flush timeout
+	// can release it while the connection stays open.
+	trace := "panic: boom\n    at a()\n    at b()\n"
+	if _, err := client.Write([]byte(trace)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	deadline := time.After(time.Second)
+	for {
+		if item := rb.Pop(); item != nil {
+			if string(item) != trace {
+				t.Errorf("entry = %q, want %q", item, trace)
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatal("Timed out waiting for aggregated entry")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
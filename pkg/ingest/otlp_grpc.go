@@ -0,0 +1,125 @@
+package ingest
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net"
+	"streamgate/pkg/engine"
+	"streamgate/pkg/model"
+	"streamgate/pkg/otlp"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // accept gzip-compressed requests
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ListenerOTLPGRPC is the listener name attached to entries received over
+// OTLP/gRPC.
+const ListenerOTLPGRPC = "otlp_grpc"
+
+const defaultOTLPGRPCMaxRecvBytes = 16 << 20 // 16 MiB
+
+// OTLPGRPCConfig holds the OTLP/gRPC receiver's options.
+type OTLPGRPCConfig struct {
+	// MaxRecvMsgBytes limits a request message (default 16 MiB).
+	MaxRecvMsgBytes int
+
+	// BearerToken, if set, is required in "authorization: Bearer <token>"
+	// metadata.
+	BearerToken string
+
+	// RetryAfter is the delay advertised when the buffer is full (default 1s).
+	RetryAfter time.Duration
+}
+
+// OTLPGRPCIngestor serves the OTLP LogsService, the protocol Collectors and
+// SDKs use by default (port 4317). Each LogRecord becomes one entry, as on
+// OTLP/HTTP. When a request's records don't all fit in the buffer, none are
+// taken and it fails with RESOURCE_EXHAUSTED and a RetryInfo, which
+// exporters retry.
+type OTLPGRPCIngestor struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	addr   string
+	buffer *engine.RingBuffer
+	cfg    OTLPGRPCConfig
+}
+
+func NewOTLPGRPCIngestor(addr string, buffer *engine.RingBuffer, cfg OTLPGRPCConfig) *OTLPGRPCIngestor {
+	if cfg.MaxRecvMsgBytes <= 0 {
+		cfg.MaxRecvMsgBytes = defaultOTLPGRPCMaxRecvBytes
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = defaultHTTPRetryAfter
+	}
+	return &OTLPGRPCIngestor{
+		addr:   addr,
+		buffer: buffer,
+		cfg:    cfg,
+	}
+}
+
+// Start begins listening on the gRPC address. Blocking call.
+func (g *OTLPGRPCIngestor) Start() error {
+	lis, err := net.Listen("tcp", g.addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("OTLP/gRPC Ingestor listening on %s", g.addr)
+	return g.newServer().Serve(lis)
+}
+
+func (g *OTLPGRPCIngestor) newServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(g.cfg.MaxRecvMsgBytes),
+		grpc.UnaryInterceptor(g.authorize),
+	)
+	collogspb.RegisterLogsServiceServer(server, g)
+	return server
+}
+
+// authorize checks the bearer token, if one is configured.
+func (g *OTLPGRPCIngestor) authorize(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if g.cfg.BearerToken != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var token string
+		if values := md.Get("authorization"); len(values) > 0 {
+			token, _ = strings.CutPrefix(values[0], "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(g.cfg.BearerToken)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "unauthorized")
+		}
+	}
+	return handler(ctx, req)
+}
+
+// Export implements LogsService.
+func (g *OTLPGRPCIngestor) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	if err := validateOTLPIDs(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	src := model.Source{Listener: ListenerOTLPGRPC}
+	if p, ok := peer.FromContext(ctx); ok {
+		src.Addr = p.Addr.String()
+	}
+	entries := otlp.Explode(req)
+	if pushAll(g.buffer, entries, src) {
+		st, err := status.New(codes.ResourceExhausted, "buffer full").
+			WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(g.cfg.RetryAfter)})
+		if err != nil {
+			return nil, status.Error(codes.ResourceExhausted, "buffer full")
+		}
+		return nil, st.Err()
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"context"
+	"net"
+	"streamgate/pkg/engine"
+	"streamgate/pkg/output"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// serveGRPC runs server on a free local port until the test ends.
+func serveGRPC(t *testing.T, server *grpc.Server) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func newTestOTLPOutput(t *testing.T, cfg output.OTLPConfig) *output.OTLPOutput {
+	t.Helper()
+	cfg.Insecure = true
+	out, err := output.NewOTLPOutput(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { out.Close() })
+	return out
+}
+
+func TestOTLPGRPC_RoundTrip(t *testing.T) {
+	rb, _ := engine.NewRingBuffer(16)
+	g := NewOTLPGRPCIngestor("", rb, OTLPGRPCConfig{BearerToken: "s3cret"})
+	addr := serveGRPC(t, g.newServer())
+
+	// What the exporter sends after a pipeline: an entry that came in over
+	// OTLP, one a processor added a field to, a plain JSON object and text.
+	out := newTestOTLPOutput(t, output.OTLPConfig{
+		Endpoint: addr,
+		Headers:  map[string]string{"authorization": "Bearer s3cret"},
+	})
+	batch := [][]byte{
+		[]byte(`{"timestamp":"2024-06-01T12:00:00Z","severityNumber":17,"body":"payment failed","attributes":{"http.status_code":502},"traceId":"5b8efff798038103d269b633813fc60c","resource":{"attributes":{"service.name":"checkout"}},"scope":{"name":"app"}}`),
+		[]byte(`{"body":"ok","region":"eu","resource":{"attributes":{"service.name":"checkout"}},"scope":{"name":"app"}}`),
+		[]byte(`{"level":"info","msg":"plain json"}`),
+		[]byte("just text\n"),
+	}
+	if err := out.WriteBatch(batch); err != nil {
+		t.Fatalf("WriteBatch: %v", err)
+	}
+
+	entries := drain(rb)
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4: %q", len(entries), entries)
+	}
+	checks := []struct {
+		entry int
+		path  string
+		want  string
+	}{
+		{0, "timestamp", "2024-06-01T12:00:00Z"},
+		{0, "severityNumber", "17"},
+		{0, `attributes.http\.status_code`, "502"},
+		{0, "traceId", "5b8efff798038103d269b633813fc60c"},
+		{0, `resource.attributes.service\.name`, "checkout"},
+		{0, "scope.name", "app"},
+		{1, "attributes.region", "eu"},
+		{1, `resource.attributes.service\.name`, "checkout"},
+		{2, "body.msg", "plain json"},
+		{3, "body", "just text"},
+	}
+	for _, c := range checks {
+		if got := gjson.Get(entries[c.entry], c.path).String(); got != c.want {
+			t.Errorf("entry %d: %s = %q, want %q (%s)", c.entry, c.path, got, c.want, entries[c.entry])
+		}
+	}
+	if !gjson.Get(entries[3], "observedTimeUnixNano").Exists() {
+		t.Errorf("text entry has no observed time: %s", entries[3])
+	}
+}
+
+func TestOTLPGRPC_Unauthenticated(t *testing.T) {
+	rb, _ := engine.NewRingBuffer(16)
+	g := NewOTLPGRPCIngestor("", rb, OTLPGRPCConfig{BearerToken: "s3cret"})
+	addr := serveGRPC(t, g.newServer())
+
+	out := newTestOTLPOutput(t, output.OTLPConfig{Endpoint: addr})
+	err := out.WriteBatch([][]byte{[]byte("x")})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("err = %v, want Unauthenticated", err)
+	}
+	if got := drain(rb); len(got) != 0 {
+		t.Errorf("entries = %q, want none", got)
+	}
+}
+
+func TestOTLPGRPC_BufferFull(t *testing.T) {
+	rb, _ := engine.NewRingBuffer(1)
+	g := NewOTLPGRPCIngestor("", rb, OTLPGRPCConfig{RetryAfter: 2 * time.Second})
+
+	_, err := g.Export(context.Background(), testLogsRequest())
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("code = %v, want ResourceExhausted", st.Code())
+	}
+	var delay time.Duration
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			delay = info.GetRetryDelay().AsDuration()
+		}
+	}
+	if delay != 2*time.Second {
+		t.Errorf("RetryInfo delay = %v, want 2s", delay)
+	}
+}
+
+// flakyLogsServer fails the first few exports with the given status.
+type flakyLogsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	failures int32
+	err      error
+	calls    atomic.Int32
+}
+
+func (s *flakyLogsServer) Export(context.Context, *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	if s.calls.Add(1) <= s.failures {
+		return nil, s.err
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func TestOTLPOutput_Retry(t *testing.T) {
+	throttled, _ := status.New(codes.ResourceExhausted, "slow down").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(10 * time.Millisecond)})
+
+	tests := []struct {
+		name       string
+		err        error
+		failures   int32
+		maxElapsed time.Duration
+		wantCalls  int32
+		wantErr    bool
+	}{
+		{"resource exhausted with retry info", throttled.Err(), 3, time.Second, 4, false},
+		{"unavailable backs off", status.Error(codes.Unavailable, "down"), 1, 2 * time.Second, 2, false},
+		{"invalid argument is not retried", status.Error(codes.InvalidArgument, "bad"), 1, time.Second, 1, true},
+		{"gives up after max elapsed", throttled.Err(), 1000, 200 * time.Millisecond, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &flakyLogsServer{failures: tt.failures, err: tt.err}
+			server := grpc.NewServer()
+			collogspb.RegisterLogsServiceServer(server, srv)
+			addr := serveGRPC(t, server)
+
+			out := newTestOTLPOutput(t, output.OTLPConfig{Endpoint: addr, MaxElapsed: tt.maxElapsed})
+			err := out.WriteBatch([][]byte{[]byte("x")})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantCalls > 0 && srv.calls.Load() != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", srv.calls.Load(), tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"streamgate/pkg/model"
+	"streamgate/pkg/otlp"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ListenerOTLPHTTP is the listener name attached to entries received over
+// OTLP/HTTP.
+const ListenerOTLPHTTP = "otlp_http"
+
+// OTLPLogsPath is where the HTTP ingestor accepts OTLP logs.
+const OTLPLogsPath = "/v1/logs"
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// otlpJSONIDs matches trace and span IDs in OTLP/JSON, which the spec
+// encodes as hex while protojson expects base64.
+var otlpJSONIDs = regexp.MustCompile(`"(traceId|spanId|trace_id|span_id)"(\s*):(\s*)"([0-9a-fA-F]*)"`)
+
+// otlpLogsHandler serves OTLP/HTTP log exports (protobuf or JSON) on the
+// HTTP ingestor: each LogRecord becomes one entry (see package otlp).
+// Authentication, body limits and compression are shared with /ingest.
+//
+// A request's records go into the buffer all at once or not at all. When
+// they don't fit the answer is 429 with Retry-After, which OTLP exporters
+// retry without duplicating anything.
+type otlpLogsHandler struct {
+	h *HTTPIngestor
+}
+
+func (o otlpLogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != contentTypeJSON {
+		// Errors are encoded like the request; unknown types get protobuf.
+		mediaType = contentTypeProtobuf
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeOTLPStatus(w, mediaType, http.StatusMethodNotAllowed, codes.Unimplemented, "method not allowed")
+		return
+	}
+	if !o.h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeOTLPStatus(w, mediaType, http.StatusUnauthorized, codes.Unauthenticated, "unauthorized")
+		return
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != contentTypeProtobuf && ct != contentTypeJSON {
+		writeOTLPStatus(w, mediaType, http.StatusUnsupportedMediaType, codes.InvalidArgument,
+			fmt.Sprintf("unsupported Content-Type %q (want %s or %s)", ct, contentTypeProtobuf, contentTypeJSON))
+		return
+	}
+
+	body, err := o.h.readBody(w, r)
+	if err != nil {
+		var he *httpError
+		if errors.As(err, &he) {
+			writeOTLPStatus(w, mediaType, he.status, codes.InvalidArgument, he.msg)
+		} else {
+			writeOTLPStatus(w, mediaType, http.StatusBadRequest, codes.InvalidArgument, "reading body: "+err.Error())
+		}
+		return
+	}
+
+	req, err := decodeOTLPLogs(body, mediaType)
+	if err != nil {
+		writeOTLPStatus(w, mediaType, http.StatusBadRequest, codes.InvalidArgument, err.Error())
+		return
+	}
+
+	entries := otlp.Explode(req)
+	if pushAll(o.h.buffer, entries, model.Source{Listener: ListenerOTLPHTTP, Addr: r.RemoteAddr}) {
+		w.Header().Set("Retry-After", o.h.retryAfter())
+		writeOTLPStatus(w, mediaType, http.StatusTooManyRequests, codes.ResourceExhausted, "buffer full")
+		return
+	}
+
+	writeOTLP(w, mediaType, http.StatusOK, &collogspb.ExportLogsServiceResponse{})
+}
+
+// decodeOTLPLogs unmarshals a request in either encoding.
+func decodeOTLPLogs(body []byte, mediaType string) (*collogspb.ExportLogsServiceRequest, error) {
+	req := &collogspb.ExportLogsServiceRequest{}
+	if mediaType == contentTypeJSON {
+		body = otlpJSONIDs.ReplaceAllFunc(body, hexIDToBase64)
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, req); err != nil {
+			return nil, fmt.Errorf("invalid OTLP/JSON: %w", err)
+		}
+	} else if err := proto.Unmarshal(body, req); err != nil {
+		return nil, fmt.Errorf("invalid OTLP protobuf: %w", err)
+	}
+	return req, validateOTLPIDs(req)
+}
+
+// validateOTLPIDs checks trace and span ID lengths, which protobuf leaves
+// open (they are plain bytes).
+func validateOTLPIDs(req *collogspb.ExportLogsServiceRequest) error {
+	for _, rl := range req.GetResourceLogs() {
+		for _, sl := range rl.GetScopeLogs() {
+			for _, lr := range sl.GetLogRecords() {
+				if n := len(lr.GetTraceId()); n != 0 && n != 16 {
+					return fmt.Errorf("invalid trace ID length %d (want 16 bytes)", n)
+				}
+				if n := len(lr.GetSpanId()); n != 0 && n != 8 {
+					return fmt.Errorf("invalid span ID length %d (want 8 bytes)", n)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hexIDToBase64 rewrites one otlpJSONIDs match. Invalid hex is left alone;
+// it then fails validateOTLPIDs or protojson.
+func hexIDToBase64(m []byte) []byte {
+	sub := otlpJSONIDs.FindSubmatch(m)
+	id, err := hex.DecodeString(string(sub[4]))
+	if err != nil {
+		return m
+	}
+	out := make([]byte, 0, len(m))
+	out = append(out, '"')
+	out = append(out, sub[1]...)
+	out = append(out, '"')
+	out = append(out, sub[2]...)
+	out = append(out, ':')
+	out = append(out, sub[3]...)
+	out = append(out, '"')
+	out = base64.StdEncoding.AppendEncode(out, id)
+	return append(out, '"')
+}
+
+// writeOTLPStatus sends an error as a google.rpc.Status, as the spec asks.
+func writeOTLPStatus(w http.ResponseWriter, mediaType string, status int, code codes.Code, msg string) {
+	writeOTLP(w, mediaType, status, &statuspb.Status{Code: int32(code), Message: msg})
+}
+
+func writeOTLP(w http.ResponseWriter, mediaType string, status int, m proto.Message) {
+	var body []byte
+	var err error
+	if mediaType == contentTypeJSON {
+		body, err = protojson.Marshal(m)
+	} else {
+		body, err = proto.Marshal(m)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// retryAfter is the Retry-After value in whole seconds (at least 1).
+func (h *HTTPIngestor) retryAfter() string {
+	return strconv.Itoa(int(max(1, h.cfg.RetryAfter.Round(time.Second)/time.Second)))
+}
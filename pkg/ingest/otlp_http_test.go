@@ -0,0 +1,201 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"streamgate/pkg/engine"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func stringKV(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func testLogsRequest() *collogspb.ExportLogsServiceRequest {
+	return &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringKV("service.name", "checkout")}},
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope: &commonpb.InstrumentationScope{Name: "app", Version: "1.0"},
+				LogRecords: []*logspb.LogRecord{
+					{
+						TimeUnixNano:   1717243200000000000,
+						SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+						SeverityText:   "ERROR",
+						Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payment failed"}},
+						Attributes: []*commonpb.KeyValue{
+							{Key: "http.status_code", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 502}}},
+						},
+						TraceId: []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c},
+						SpanId:  []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+					},
+					{Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "ok"}}},
+				},
+			}},
+		}},
+	}
+}
+
+// otlpJSONRequest is testLogsRequest as an OTLP/JSON exporter sends it.
+const otlpJSONRequest = `{"resourceLogs":[{
+  "resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]},
+  "scopeLogs":[{
+    "scope":{"name":"app","version":"1.0"},
+    "logRecords":[
+      {"timeUnixNano":"1717243200000000000","severityNumber":17,"severityText":"ERROR",
+       "body":{"stringValue":"payment failed"},
+       "attributes":[{"key":"http.status_code","value":{"intValue":"502"}}],
+       "traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174"},
+      {"body":{"stringValue":"ok"},"unknownField":true}
+    ]
+  }]
+}]}`
+
+func TestOTLPHTTP_Encodings(t *testing.T) {
+	pb, err := proto.Marshal(testLogsRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+	}{
+		{"protobuf", pb, "application/x-protobuf"},
+		{"json", []byte(otlpJSONRequest), "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb, _ := engine.NewRingBuffer(16)
+			h := NewHTTPIngestor("", rb, HTTPConfig{})
+
+			req := httptest.NewRequest(http.MethodPost, OTLPLogsPath, bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			otlpLogsHandler{h}.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, http.StatusOK, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("response Content-Type = %q, want %q", got, tt.contentType)
+			}
+
+			entries := drain(rb)
+			if len(entries) != 2 {
+				t.Fatalf("got %d entries, want 2: %q", len(entries), entries)
+			}
+			checks := map[string]string{
+				"timestamp":                         "2024-06-01T12:00:00Z",
+				"severityText":                      "ERROR",
+				"severityNumber":                    "17",
+				"body":                              "payment failed",
+				`attributes.http\.status_code`:      "502",
+				`resource.attributes.service\.name`: "checkout",
+				"scope.name":                        "app",
+				"traceId":                           "5b8efff798038103d269b633813fc60c",
+				"spanId":                            "eee19b7ec3c1b174",
+			}
+			for path, want := range checks {
+				if got := gjson.Get(entries[0], path).String(); got != want {
+					t.Errorf("%s = %q, want %q (entry %s)", path, got, want, entries[0])
+				}
+			}
+			if got := gjson.Get(entries[0], `attributes.http\.status_code`).Type; got != gjson.Number {
+				t.Errorf("int attribute type = %v, want a JSON number", got)
+			}
+			if got := gjson.Get(entries[1], `resource.attributes.service\.name`).String(); got != "checkout" {
+				t.Errorf("second record lost its resource: %s", entries[1])
+			}
+		})
+	}
+}
+
+func TestOTLPHTTP_ServiceNameFilter(t *testing.T) {
+	pb, _ := proto.Marshal(testLogsRequest())
+	rb, _ := engine.NewRingBuffer(16)
+	h := NewHTTPIngestor("", rb, HTTPConfig{})
+	req := httptest.NewRequest(http.MethodPost, OTLPLogsPath, bytes.NewReader(pb))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	otlpLogsHandler{h}.ServeHTTP(httptest.NewRecorder(), req)
+
+	filter, err := engine.NewAttributeFilterProcessor(engine.AttributeFilterConfig{
+		Name:      "drop-checkout",
+		Attribute: "service.name",
+		Operator:  engine.OpEquals,
+		Value:     "checkout",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range drain(rb) {
+		if _, drop, _ := filter.Process(&engine.ProcessingContext{Context: context.Background()}, []byte(entry)); !drop {
+			t.Errorf("service.name filter didn't match %s", entry)
+		}
+	}
+}
+
+func TestOTLPHTTP_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		bufferSize  uint64
+		wantStatus  int
+	}{
+		{"wrong method", http.MethodGet, "application/x-protobuf", "", 16, http.StatusMethodNotAllowed},
+		{"unsupported content type", http.MethodPost, "text/plain", "hi", 16, http.StatusUnsupportedMediaType},
+		{"invalid protobuf", http.MethodPost, "application/x-protobuf", "\xff\xff\xff", 16, http.StatusBadRequest},
+		{"invalid json", http.MethodPost, "application/json", `{"resourceLogs":`, 16, http.StatusBadRequest},
+		{"bad trace id", http.MethodPost, "application/json", `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"traceId":"abc"}]}]}]}`, 16, http.StatusBadRequest},
+		{"buffer full", http.MethodPost, "application/json", otlpJSONRequest, 1, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb, _ := engine.NewRingBuffer(tt.bufferSize)
+			h := NewHTTPIngestor("", rb, HTTPConfig{})
+
+			req := httptest.NewRequest(tt.method, OTLPLogsPath, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			otlpLogsHandler{h}.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			status := &statuspb.Status{}
+			if rec.Header().Get("Content-Type") == "application/json" {
+				if err := protojson.Unmarshal(rec.Body.Bytes(), status); err != nil {
+					t.Fatalf("body is not a Status: %v", err)
+				}
+			} else if err := proto.Unmarshal(rec.Body.Bytes(), status); err != nil {
+				t.Fatalf("body is not a Status: %v", err)
+			}
+			if status.Message == "" {
+				t.Errorf("Status has no message")
+			}
+			if tt.wantStatus == http.StatusTooManyRequests {
+				if got := rec.Header().Get("Retry-After"); got == "" {
+					t.Errorf("429 without Retry-After")
+				}
+				if got := drain(rb); len(got) != 0 {
+					t.Errorf("entries = %q, want none", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"streamgate/pkg/model"
+	"strings"
+	"time"
+)
+
+// ListenerSplunkHEC is the listener name attached to entries received on
+// the Splunk HTTP Event Collector endpoints.
+const ListenerSplunkHEC = "splunk_hec"
+
+// Splunk HEC paths. The "/1.0" variants and the bare collector path are
+// what some logging libraries post to.
+const (
+	SplunkHECEventPath  = "/services/collector/event"
+	SplunkHECRawPath    = "/services/collector/raw"
+	SplunkHECHealthPath = "/services/collector/health"
+)
+
+// splunkHECHandler emulates the Splunk HTTP Event Collector. The event
+// endpoint takes a stream of JSON events:
+//
+//	{"time":1717243200.5,"host":"web1","sourcetype":"nginx","index":"main",
+//	 "event":"GET /","fields":{"region":"eu"}}
+//
+// and the raw endpoint one event per line. "event" becomes the entry (its
+// fields if it's an object, else "message"); time, host, source, sourcetype,
+// index and the indexed fields are added as top-level fields. The host,
+// source, sourcetype and index query parameters are defaults for both.
+//
+// Clients send the token as "Authorization: Splunk <token>". A full buffer
+// gets 503 "Server is busy", which HEC clients retry.
+type splunkHECHandler struct {
+	h   *HTTPIngestor
+	raw bool
+}
+
+// hecEvent is one event on the event endpoint.
+type hecEvent struct {
+	Time       json.RawMessage        `json:"time"` // epoch seconds, number or string
+	Host       string                 `json:"host"`
+	Source     string                 `json:"source"`
+	SourceType string                 `json:"sourcetype"`
+	Index      string                 `json:"index"`
+	Event      json.RawMessage        `json:"event"`
+	Fields     map[string]interface{} `json:"fields"`
+}
+
+// hecError is a failure with HEC's status code and text.
+type hecError struct {
+	status int
+	code   int
+	text   string
+}
+
+func (e *hecError) Error() string { return e.text }
+
+func (s splunkHECHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.h.vendorAuthorized(r) {
+		if vendorToken(r) == "" {
+			w.Header().Set("WWW-Authenticate", "Splunk")
+			writeHEC(w, http.StatusUnauthorized, 2, "Token is required")
+		} else {
+			writeHEC(w, http.StatusForbidden, 4, "Invalid token")
+		}
+		return
+	}
+
+	body, err := s.h.readBody(w, r)
+	if err != nil {
+		var he *httpError
+		if errors.As(err, &he) {
+			writeHEC(w, he.status, 6, he.msg)
+		} else {
+			writeHEC(w, http.StatusBadRequest, 6, "reading body: "+err.Error())
+		}
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		writeHEC(w, http.StatusBadRequest, 5, "No data")
+		return
+	}
+
+	var entries [][]byte
+	if s.raw {
+		entries, err = hecRawEntries(body, r.URL.Query())
+	} else {
+		entries, err = hecEventEntries(body, r.URL.Query())
+	}
+	if err != nil {
+		var he *hecError
+		if errors.As(err, &he) {
+			writeHEC(w, he.status, he.code, he.text)
+		} else {
+			writeHEC(w, http.StatusBadRequest, 6, "Invalid data format")
+		}
+		return
+	}
+
+	if pushAll(s.h.buffer, entries, model.Source{Listener: ListenerSplunkHEC, Addr: r.RemoteAddr}) {
+		w.Header().Set("Retry-After", s.h.retryAfter())
+		writeHEC(w, http.StatusServiceUnavailable, 9, "Server is busy")
+		return
+	}
+	writeHEC(w, http.StatusOK, 0, "Success")
+}
+
+// hecEventEntries decodes the event endpoint's stream of JSON objects.
+func hecEventEntries(body []byte, query url.Values) ([][]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var entries [][]byte
+	for {
+		var ev hecEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+		entry, err := ev.entry(query)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func (ev *hecEvent) entry(query url.Values) ([]byte, error) {
+	event := bytes.TrimSpace(ev.Event)
+	switch {
+	case len(event) == 0 || string(event) == "null":
+		return nil, &hecError{http.StatusBadRequest, 12, "Event field is required"}
+	case string(event) == `""`:
+		return nil, &hecError{http.StatusBadRequest, 13, "Event field cannot be blank"}
+	}
+
+	var f vendorFields
+	if event[0] == '{' {
+		var err error
+		if f, err = decodeJSONObject(event); err != nil {
+			return nil, err
+		}
+	} else {
+		var message interface{}
+		dec := json.NewDecoder(bytes.NewReader(event))
+		dec.UseNumber()
+		if err := dec.Decode(&message); err != nil {
+			return nil, err
+		}
+		f = vendorFields{"message": message}
+	}
+
+	t, err := hecTime(ev.Time)
+	if err != nil {
+		return nil, err
+	}
+	f.addTime(t)
+	f.add("host", ev.Host)
+	f.add("source", ev.Source)
+	f.add("sourcetype", ev.SourceType)
+	f.add("index", ev.Index)
+	for k, v := range ev.Fields {
+		f.add(k, v)
+	}
+	addHECQuery(f, query)
+	return marshalEntry(f)
+}
+
+// hecRawEntries makes each line of a raw body an event.
+func hecRawEntries(body []byte, query url.Values) ([][]byte, error) {
+	lines, err := splitBody(body, "text/plain")
+	if err != nil {
+		return nil, err
+	}
+	entries := make([][]byte, 0, len(lines))
+	for _, line := range lines {
+		f := vendorFields{"message": string(line)}
+		addHECQuery(f, query)
+		entry, err := marshalEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// addHECQuery adds the request's default metadata.
+func addHECQuery(f vendorFields, query url.Values) {
+	for _, key := range []string{"host", "source", "sourcetype", "index"} {
+		f.add(key, query.Get(key))
+	}
+}
+
+// hecTime parses epoch seconds with an optional fraction ("1717243200.5").
+func hecTime(raw json.RawMessage) (time.Time, error) {
+	s := strings.Trim(string(raw), `"`)
+	if s == "" || s == "null" {
+		return time.Time{}, nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, &hecError{http.StatusBadRequest, 6, "Invalid data format"}
+	}
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(math.Round(frac*1e6))*1e3), nil
+}
+
+// splunkHECHealth answers HEC health checks, reporting unhealthy while the
+// buffer is full.
+func (h *HTTPIngestor) splunkHECHealth(w http.ResponseWriter, r *http.Request) {
+	if h.buffer.Usage() >= h.buffer.Capacity() {
+		writeHEC(w, http.StatusServiceUnavailable, 18, "HEC is unhealthy")
+		return
+	}
+	writeHEC(w, http.StatusOK, 17, "HEC is healthy")
+}
+
+func writeHEC(w http.ResponseWriter, status, code int, text string) {
+	writeJSON(w, status, struct {
+		Text string `json:"text"`
+		Code int    `json:"code"`
+	}{text, code})
+}
@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"streamgate/pkg/engine"
+	"streamgate/pkg/model"
+	"time"
+)
+
+// ListenerSyslog is the listener name attached to entries received by the
+// syslog ingestor (over UDP or TCP).
+const ListenerSyslog = "syslog"
+
+// maxSyslogFrame bounds a TCP frame, octet-counted or newline-terminated.
+// A larger one is treated as a framing error and the connection is closed.
+const maxSyslogFrame = 1 << 20 // 1 MiB
+
+// SyslogIngestor receives syslog on UDP and TCP at the same address and
+// parses each message into a JSON entry (see parseSyslog), so attribute
+// filters on severity, hostname, app_name, ... work on syslog traffic.
+//
+// On TCP, each message is framed either by octet counting ("LEN SP MSG",
+// RFC 6587 §3.4.1) or by a trailing newline. The framing is detected per
+// message, so senders may mix them.
+type SyslogIngestor struct {
+	addr   string
+	buffer *engine.RingBuffer
+}
+
+func NewSyslogIngestor(addr string, buffer *engine.RingBuffer) *SyslogIngestor {
+	return &SyslogIngestor{
+		addr:   addr,
+		buffer: buffer,
+	}
+}
+
+// Start begins listening on UDP and TCP. Blocking call; it returns when
+// either listener fails.
+func (s *SyslogIngestor) Start() error {
+	udpAddr, err := net.ResolveUDPAddr("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	defer udpConn.Close()
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	log.Printf("Syslog Ingestor listening on %s (udp, tcp)", s.addr)
+
+	errc := make(chan error, 2)
+	go func() { errc <- s.serveUDP(udpConn) }()
+	go func() { errc <- s.serveTCP(listener) }()
+	return <-errc
+}
+
+func (s *SyslogIngestor) serveUDP(conn *net.UDPConn) error {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			log.Printf("Syslog UDP read error: %v", err)
+			continue
+		}
+		// Copy: unparseable messages are pushed as they are, and buf is reused.
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+		if entry := parseSyslog(packet, time.Now()); len(entry) > 0 {
+			// On buffer full, silently drop (tail drop strategy).
+			_ = s.buffer.PushFrom(entry, model.Source{Listener: ListenerSyslog, Addr: from.String()})
+		}
+	}
+}
+
+func (s *SyslogIngestor) serveTCP(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			log.Printf("Error accepting connection: %v", err)
+			continue
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+func (s *SyslogIngestor) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	src := model.Source{Listener: ListenerSyslog, Addr: conn.RemoteAddr().String()}
+
+	for {
+		frame, err := readSyslogFrame(reader)
+		if entry := parseSyslog(frame, time.Now()); len(entry) > 0 {
+			_ = s.buffer.PushFrom(entry, src)
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Syslog read error from %s: %v", src.Addr, err)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads one TCP message. A leading digit means octet
+// counting; anything else runs to the next newline. The frame is freshly
+// allocated. At EOF, an unterminated last message is returned with io.EOF.
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] < '0' || first[0] > '9' {
+		return readSyslogLine(r)
+	}
+
+	prefix, err := r.ReadSlice(' ')
+	if err != nil {
+		if err == io.EOF && len(prefix) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("invalid octet count %q", prefix)
+	}
+	n, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+	if err != nil || n <= 0 || n > maxSyslogFrame {
+		return nil, fmt.Errorf("invalid octet count %q", prefix[:len(prefix)-1])
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated frame (want %d bytes)", n)
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+// readSyslogLine reads up to and including the next newline. A message
+// longer than maxSyslogFrame is an error, so a client that never sends a
+// newline can't grow the connection's memory without bound.
+func readSyslogLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxSyslogFrame {
+			return nil, fmt.Errorf("message exceeds %d bytes without a newline", maxSyslogFrame)
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
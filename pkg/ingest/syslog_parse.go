@@ -0,0 +1,222 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslogFacilities are the facility keywords by code (RFC 5424 §6.2.1).
+var syslogFacilities = [...]string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogSeverities are severity names by code, spelled the way level
+// filters expect ("error", not "err").
+var syslogSeverities = [...]string{
+	"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug",
+}
+
+// syslogEntry is the JSON entry a syslog message becomes. Nil values ("-")
+// are left out.
+type syslogEntry struct {
+	Timestamp      string                       `json:"timestamp,omitempty"`
+	Hostname       string                       `json:"hostname,omitempty"`
+	AppName        string                       `json:"app_name,omitempty"`
+	ProcID         string                       `json:"procid,omitempty"`
+	MsgID          string                       `json:"msgid,omitempty"`
+	Facility       string                       `json:"facility"`
+	FacilityCode   int                          `json:"facility_code"`
+	Severity       string                       `json:"severity"`
+	SeverityCode   int                          `json:"severity_code"`
+	StructuredData map[string]map[string]string `json:"structured_data,omitempty"`
+	Message        string                       `json:"message"`
+	Format         string                       `json:"syslog_format"` // "rfc5424" or "rfc3164"
+}
+
+// parseSyslog turns an RFC 5424 or RFC 3164 message into a JSON entry:
+//
+//	<165>1 2024-06-01T12:00:00Z web1 nginx 42 ACCESS [meta env="prod"] GET /
+//	{"timestamp":"2024-06-01T12:00:00Z","hostname":"web1","app_name":"nginx",
+//	 "procid":"42","msgid":"ACCESS","facility":"local4","facility_code":20,
+//	 "severity":"notice","severity_code":5,
+//	 "structured_data":{"meta":{"env":"prod"}},"message":"GET /",...}
+//
+// RFC 3164 is parsed leniently: a header that doesn't look like
+// "Mmm dd hh:mm:ss host tag[pid]:" is kept in the message. Anything without
+// a valid <PRI> is returned unchanged.
+func parseSyslog(msg []byte, now time.Time) []byte {
+	msg = bytes.TrimRight(msg, "\r\n\x00")
+	pri, rest, ok := syslogPriority(msg)
+	if !ok {
+		return msg
+	}
+	e := &syslogEntry{
+		FacilityCode: pri / 8,
+		Facility:     syslogFacilities[pri/8],
+		SeverityCode: pri % 8,
+		Severity:     syslogSeverities[pri%8],
+	}
+	if len(rest) >= 2 && rest[0] == '1' && rest[1] == ' ' {
+		if !parseRFC5424(e, string(rest[2:])) {
+			return msg
+		}
+	} else {
+		parseRFC3164(e, string(rest), now)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(e); err != nil {
+		return msg
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// syslogPriority reads "<PRI>" (0..191, at most three digits).
+func syslogPriority(msg []byte) (int, []byte, bool) {
+	if len(msg) < 3 || msg[0] != '<' {
+		return 0, nil, false
+	}
+	end := bytes.IndexByte(msg[:min(len(msg), 5)], '>')
+	if end < 2 {
+		return 0, nil, false
+	}
+	pri, err := strconv.Atoi(string(msg[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, nil, false
+	}
+	return pri, msg[end+1:], true
+}
+
+// parseRFC5424 reads what follows "<PRI>1 ". It fails on a malformed header.
+func parseRFC5424(e *syslogEntry, s string) bool {
+	fields := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		field, rest, ok := strings.Cut(s, " ")
+		if !ok {
+			return false // STRUCTURED-DATA is required after MSGID
+		}
+		fields = append(fields, field)
+		s = rest
+	}
+	nilable := func(v string) string {
+		if v == "-" {
+			return ""
+		}
+		return v
+	}
+	if ts := nilable(fields[0]); ts != "" {
+		if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+			return false
+		}
+		e.Timestamp = ts
+	}
+	e.Hostname = nilable(fields[1])
+	e.AppName = nilable(fields[2])
+	e.ProcID = nilable(fields[3])
+	e.MsgID = nilable(fields[4])
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else {
+		sd, rest, ok := parseStructuredData(s)
+		if !ok {
+			return false
+		}
+		e.StructuredData, s = sd, rest
+	}
+	s = strings.TrimPrefix(s, " ")
+	e.Message = strings.TrimPrefix(s, "\ufeff")
+	e.Format = "rfc5424"
+	return true
+}
+
+// parseStructuredData reads one or more [SD-ID param="value" ...] elements.
+// Values may escape '"', '\' and ']' with a backslash.
+func parseStructuredData(s string) (map[string]map[string]string, string, bool) {
+	sd := make(map[string]map[string]string)
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return nil, "", false
+		}
+		params := make(map[string]string)
+		sd[s[:end]] = params
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			name, rest, ok := strings.Cut(s, `="`)
+			if !ok || name == "" {
+				return nil, "", false
+			}
+			s = rest
+			var value strings.Builder
+			for {
+				if s == "" {
+					return nil, "", false
+				}
+				c := s[0]
+				s = s[1:]
+				if c == '"' {
+					break
+				}
+				if c == '\\' && s != "" && (s[0] == '"' || s[0] == '\\' || s[0] == ']') {
+					c = s[0]
+					s = s[1:]
+				}
+				value.WriteByte(c)
+			}
+			params[name] = value.String()
+		}
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", false
+		}
+		s = s[1:]
+	}
+	return sd, s, len(sd) > 0
+}
+
+// rfc3164Stamp is the BSD timestamp, e.g. "Jun  1 12:00:00".
+const rfc3164Stamp = "Jan _2 15:04:05"
+
+// parseRFC3164 reads what follows "<PRI>". The year is missing, so the
+// timestamp gets the one that puts it closest to now.
+func parseRFC3164(e *syslogEntry, s string, now time.Time) {
+	e.Format = "rfc3164"
+	e.Message = s
+	if len(s) < len(rfc3164Stamp) {
+		return
+	}
+	ts, err := time.ParseInLocation(rfc3164Stamp, s[:len(rfc3164Stamp)], now.Location())
+	if err != nil {
+		return
+	}
+	ts = ts.AddDate(now.Year(), 0, 0)
+	if ts.After(now.AddDate(0, 1, 0)) {
+		ts = ts.AddDate(-1, 0, 0) // December's logs read in January
+	}
+	e.Timestamp = ts.Format(time.RFC3339)
+	s = strings.TrimPrefix(s[len(rfc3164Stamp):], " ")
+
+	// HOSTNAME, unless the next word is already the tag ("su:" or "cron[1]:").
+	if word, rest, ok := strings.Cut(s, " "); ok && !strings.HasSuffix(word, ":") && !strings.Contains(word, "[") {
+		e.Hostname, s = word, rest
+	}
+	if tag, rest, ok := strings.Cut(s, ": "); ok && !strings.ContainsAny(tag, " ") {
+		if name, pid, ok := strings.Cut(tag, "["); ok && strings.HasSuffix(pid, "]") {
+			e.AppName, e.ProcID = name, strings.TrimSuffix(pid, "]")
+		} else {
+			e.AppName = tag
+		}
+		s = rest
+	}
+	e.Message = s
+}
@@ -0,0 +1,162 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"streamgate/pkg/engine"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		msg  string
+		want map[string]string // gjson path -> value; "" means absent
+	}{
+		{
+			"rfc5424 with structured data",
+			`<165>1 2024-06-01T12:00:00.5Z web1 nginx 42 ACCESS [meta env="prod" note="a \"quoted\" \]"][origin ip="10.0.0.1"] GET /` + "\n",
+			map[string]string{
+				"timestamp": "2024-06-01T12:00:00.5Z", "hostname": "web1", "app_name": "nginx",
+				"procid": "42", "msgid": "ACCESS", "facility": "local4", "facility_code": "20",
+				"severity": "notice", "severity_code": "5",
+				"structured_data.meta.env": "prod", "structured_data.meta.note": `a "quoted" ]`,
+				"structured_data.origin.ip": "10.0.0.1",
+				"message":                   "GET /", "syslog_format": "rfc5424",
+			},
+		},
+		{
+			"rfc5424 nil values and BOM",
+			"<11>1 - - - - - - \ufeffdisk failed",
+			map[string]string{
+				"timestamp": "", "hostname": "", "app_name": "", "structured_data": "",
+				"severity": "error", "facility": "user", "message": "disk failed",
+			},
+		},
+		{
+			"rfc3164",
+			"<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8",
+			map[string]string{
+				"timestamp": "2023-10-11T22:14:15Z", "hostname": "mymachine", "app_name": "su",
+				"procid": "123", "facility": "auth", "severity": "critical",
+				"message": "'su root' failed for lonvick on /dev/pts/8", "syslog_format": "rfc3164",
+			},
+		},
+		{
+			"rfc3164 without hostname",
+			"<13>Jan  9 08:00:00 cron: job done",
+			map[string]string{
+				"timestamp": "2024-01-09T08:00:00Z", "hostname": "", "app_name": "cron",
+				"message": "job done",
+			},
+		},
+		{
+			"rfc3164 without header",
+			"<13>just a message",
+			map[string]string{"timestamp": "", "severity": "notice", "message": "just a message"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSyslog([]byte(tt.msg), now)
+			if !gjson.ValidBytes(got) {
+				t.Fatalf("not JSON: %s", got)
+			}
+			for path, want := range tt.want {
+				v := gjson.GetBytes(got, path)
+				if want == "" && v.Exists() {
+					t.Errorf("%s = %s, want absent", path, v.Raw)
+				} else if want != "" && v.String() != want {
+					t.Errorf("%s = %q, want %q (%s)", path, v.String(), want, got)
+				}
+			}
+		})
+	}
+
+	for _, msg := range []string{"no priority", "<999>1 - - - - - -", "<14>1 not-a-time host app - - -", "<14>1 - - - - [unterminated"} {
+		if got := string(parseSyslog([]byte(msg), now)); got != msg {
+			t.Errorf("parseSyslog(%q) = %q, want it unchanged", msg, got)
+		}
+	}
+}
+
+// octetFrame frames msg with an RFC 6587 octet count.
+func octetFrame(msg string) string {
+	return fmt.Sprintf("%d %s", len(msg), msg)
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	input := octetFrame("<14>1 - - - - - - hello\n") + // the count covers the newline
+		"<14>plain line\n" +
+		octetFrame("<13>no\nnewline") +
+		"<14>last, unterminated"
+	r := bufio.NewReader(strings.NewReader(input))
+
+	var frames []string
+	for {
+		frame, err := readSyslogFrame(r)
+		if len(frame) > 0 {
+			frames = append(frames, string(frame))
+		}
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			break
+		}
+	}
+	want := []string{"<14>1 - - - - - - hello\n", "<14>plain line\n", "<13>no\nnewline", "<14>last, unterminated"}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("frames = %q, want %q", frames, want)
+	}
+
+	long := "<14>" + strings.Repeat("x", maxSyslogFrame)
+	for _, bad := range []string{"99999999 x", "12 short", "1a <14>x", long, long + "\n"} {
+		if _, err := readSyslogFrame(bufio.NewReader(strings.NewReader(bad))); err == nil || err == io.EOF {
+			t.Errorf("readSyslogFrame(%.20q) err = %v, want a framing error", bad, err)
+		}
+	}
+}
+
+func TestSyslogIngestor_TCP(t *testing.T) {
+	rb, _ := engine.NewRingBuffer(16)
+	s := NewSyslogIngestor("", rb)
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.handleConnection(server)
+		close(done)
+	}()
+	client.Write([]byte(octetFrame("<165>1 - web1 app - - - octet\nmsg") + "<11>Jun  1 12:00:00 db1 pg: boom\n"))
+	client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("connection handler did not return")
+	}
+
+	entries := drain(rb)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %q", len(entries), entries)
+	}
+	if got := gjson.Get(entries[0], "message").String(); got != "octet\nmsg" {
+		t.Errorf("octet-counted message = %q", got)
+	}
+	if got := gjson.Get(entries[1], "hostname").String(); got != "db1" {
+		t.Errorf("newline-framed hostname = %q (%s)", got, entries[1])
+	}
+}
@@ -2,16 +2,25 @@ package ingest
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
 	"io"
 	"log"
 	"net"
 	"streamgate/pkg/engine"
+	"streamgate/pkg/model"
+	"time"
 )
 
+// ListenerTCP is the listener name attached to entries received over TCP.
+const ListenerTCP = "tcp"
+
 // TCPIngestor listens for TCP connections and pushes logs to the buffer.
 type TCPIngestor struct {
-	addr   string
-	buffer *engine.RingBuffer
+	addr      string
+	buffer    *engine.RingBuffer
+	multiline *multilineRules // nil: every line is an entry
+	tls       *tlsReloader    // nil: plaintext
 }
 
 func NewTCPIngestor(addr string, buffer *engine.RingBuffer) *TCPIngestor {
@@ -21,13 +30,40 @@ func NewTCPIngestor(addr string, buffer *engine.RingBuffer) *TCPIngestor {
 	}
 }
 
+// EnableMultiline joins consecutive lines of each connection into single
+// entries (stack traces, ...). It must be called before Start.
+func (t *TCPIngestor) EnableMultiline(cfg MultilineConfig) error {
+	rules, err := compileMultiline(cfg)
+	if err != nil {
+		return err
+	}
+	t.multiline = rules
+	return nil
+}
+
+// EnableTLS terminates TLS on the listener, with mutual TLS if cfg names a
+// client CA. It must be called before Start.
+func (t *TCPIngestor) EnableTLS(cfg TLSConfig) error {
+	reloader, err := newTLSReloader(cfg)
+	if err != nil {
+		return err
+	}
+	t.tls = reloader
+	return nil
+}
+
 // Start begins listening on the TCP address. Blocking call.
 func (t *TCPIngestor) Start() error {
 	listener, err := net.Listen("tcp", t.addr)
 	if err != nil {
 		return err
 	}
-	log.Printf("TCP Ingestor listening on %s", t.addr)
+	if t.tls != nil {
+		listener = tls.NewListener(listener, t.tls.serverConfig())
+		log.Printf("TCP Ingestor listening on %s (TLS)", t.addr)
+	} else {
+		log.Printf("TCP Ingestor listening on %s", t.addr)
+	}
 
 	for {
 		conn, err := listener.Accept()
@@ -42,8 +78,28 @@ func (t *TCPIngestor) Start() error {
 
 func (t *TCPIngestor) handleConnection(conn net.Conn) {
 	defer conn.Close()
+	src := model.Source{Listener: ListenerTCP, Addr: conn.RemoteAddr().String()}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// Handshake up front so the client's identity is known before its
+		// first entry, and a silent client can't hold the goroutine forever.
+		_ = conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			log.Printf("TLS handshake with %s failed: %v", src.Addr, err)
+			return
+		}
+		_ = conn.SetDeadline(time.Time{})
+		src.Identity = peerIdentity(tlsConn.ConnectionState())
+	}
 	reader := bufio.NewReader(conn)
 
+	// Push to buffer. On buffer full, silently drop (tail drop strategy).
+	// Logging every drop would kill performance.
+	push := func(entry []byte) { _ = t.buffer.PushFrom(entry, src) }
+	if t.multiline != nil {
+		t.readMultiline(conn, reader, push)
+		return
+	}
+
 	for {
 		// ReadLine is lower level than ReadString, avoids some allocations but be careful with line size.
 		// For simplicity in V1, we use ReadBytes('\n').
@@ -55,10 +111,45 @@ func (t *TCPIngestor) handleConnection(conn net.Conn) {
 			}
 			return
 		}
+		push(line)
+	}
+}
+
+// readMultiline is the read loop with multi-line aggregation. While an event
+// is pending, reads time out after the flush timeout so a trailing event
+// (the last stack trace before the sender goes quiet) isn't held forever.
+func (t *TCPIngestor) readMultiline(conn net.Conn, reader *bufio.Reader, push func([]byte)) {
+	agg := &multilineAggregator{rules: t.multiline, emit: push}
+	defer agg.flush()
+
+	var partial []byte // bytes of a line cut short by a timeout
+	for {
+		if agg.pending() {
+			_ = conn.SetReadDeadline(time.Now().Add(t.multiline.timeout))
+		} else {
+			_ = conn.SetReadDeadline(time.Time{})
+		}
 
-		// Trim newline if necessary, or keep it.
-		// Push to buffer. On buffer full, silently drop (tail drop strategy).
-		// Logging every drop would kill performance.
-		_ = t.buffer.Push(line)
+		line, err := reader.ReadBytes('\n')
+		if partial != nil {
+			line = append(partial, line...)
+			partial = nil
+		}
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				partial = line
+				agg.flush()
+				continue
+			}
+			if len(line) > 0 {
+				agg.add(line) // unterminated last line
+			}
+			if err != io.EOF {
+				log.Printf("Read error: %v", err)
+			}
+			return
+		}
+		agg.add(line)
 	}
 }
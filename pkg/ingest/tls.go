@@ -0,0 +1,162 @@
+package ingest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTLSReloadInterval = 5 * time.Second
+	tlsHandshakeTimeout      = 10 * time.Second
+)
+
+// TLSConfig enables TLS on a listener.
+type TLSConfig struct {
+	CertFile string // PEM server certificate (chain)
+	KeyFile  string // PEM private key
+
+	// ClientCAFile, if set, turns on mutual TLS: clients must present a
+	// certificate that verifies against this PEM bundle. Their identity is
+	// then attached to every entry (model.Source.Identity).
+	ClientCAFile string
+
+	// ReloadInterval is how often the files are checked for changes
+	// (default 5s). Changed files are picked up by the next handshake, so
+	// certificates can be rotated without a restart.
+	ReloadInterval time.Duration
+}
+
+// tlsReloader serves the current certificate and client CA pool, reloading
+// them when their files change. A failed reload is logged and the previous
+// files stay in use.
+type tlsReloader struct {
+	cfg TLSConfig
+
+	mu        sync.Mutex
+	config    *tls.Config
+	modTimes  [3]time.Time // cert, key, CA
+	lastCheck time.Time
+}
+
+func newTLSReloader(cfg TLSConfig) (*tlsReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("cert and key files must be specified")
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = defaultTLSReloadInterval
+	}
+	r := &tlsReloader{cfg: cfg}
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if r.config, err = r.load(); err != nil {
+		return nil, err
+	}
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+	return r, nil
+}
+
+// serverConfig is the listener's tls.Config. Each handshake asks the
+// reloader for the current one.
+func (r *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+	}
+}
+
+func (r *tlsReloader) current() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) < r.cfg.ReloadInterval {
+		return r.config
+	}
+	r.lastCheck = time.Now()
+	modTimes, err := r.stat()
+	if err != nil {
+		log.Printf("TLS: keeping current certificates: %v", err)
+		return r.config
+	}
+	if modTimes == r.modTimes {
+		return r.config
+	}
+	config, err := r.load()
+	if err != nil {
+		log.Printf("TLS: keeping current certificates: %v", err)
+		return r.config
+	}
+	r.config, r.modTimes = config, modTimes
+	log.Printf("TLS: reloaded %s", r.cfg.CertFile)
+	return r.config
+}
+
+func (r *tlsReloader) stat() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, file := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (r *tlsReloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in client CA file %s", r.cfg.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// peerIdentity names a verified client certificate: its subject CN, else
+// its first DNS, URI (e.g. SPIFFE ID), email or IP SAN.
+func peerIdentity(state tls.ConnectionState) string {
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	cert := state.PeerCertificates[0]
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.IPAddresses) > 0:
+		return cert.IPAddresses[0].String()
+	}
+	return ""
+}
@@ -0,0 +1,230 @@
+package ingest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"streamgate/pkg/engine"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate and key signed by parent (self-signed if nil).
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func newTestCA(t *testing.T) *testCert {
+	return newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func newLeafCert(t *testing.T, ca *testCert, cn string, usage x509.ExtKeyUsage) *testCert {
+	return newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		DNSNames:    []string{"localhost"},
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+	}, ca)
+}
+
+// writePEM writes c (and its key, if keyFile is set) as PEM files.
+func (c *testCert) writePEM(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile == "" {
+		return
+	}
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// tlsFiles writes a server certificate signed by ca, and ca as the client
+// CA bundle.
+func tlsFiles(t *testing.T, ca *testCert) TLSConfig {
+	dir := t.TempDir()
+	cfg := TLSConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	newLeafCert(t, ca, "streamgate", x509.ExtKeyUsageServerAuth).writePEM(t, cfg.CertFile, cfg.KeyFile)
+	ca.writePEM(t, cfg.ClientCAFile, "")
+	return cfg
+}
+
+func TestTCPIngestor_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := newLeafCert(t, ca, "billing-agent", x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		name         string
+		clientCerts  []tls.Certificate
+		wantIdentity string
+		wantEntries  int
+	}{
+		{"verified client", []tls.Certificate{client.tlsCertificate()}, "billing-agent", 2},
+		{"client without certificate", nil, "", 0},
+		{
+			"certificate from another CA",
+			[]tls.Certificate{newLeafCert(t, newTestCA(t), "intruder", x509.ExtKeyUsageClientAuth).tlsCertificate()},
+			"", 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb, _ := engine.NewRingBuffer(16)
+			ti := NewTCPIngestor("", rb)
+			if err := ti.EnableTLS(tlsFiles(t, ca)); err != nil {
+				t.Fatalf("EnableTLS: %v", err)
+			}
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			lis = tls.NewListener(lis, ti.tls.serverConfig())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				if conn, err := lis.Accept(); err == nil {
+					ti.handleConnection(conn)
+				}
+			}()
+
+			conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{
+				ServerName:   "localhost",
+				RootCAs:      roots,
+				Certificates: tt.clientCerts,
+			})
+			// With TLS 1.3 the client may not learn that its certificate was
+			// rejected until it reads, so write anyway and let the server decide.
+			if err == nil {
+				conn.Write([]byte("first\nsecond\n"))
+				conn.Close()
+			}
+
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("connection handler did not return")
+			}
+			var got []string
+			for {
+				entry, src := rb.PopFrom()
+				if entry == nil {
+					break
+				}
+				got = append(got, string(entry))
+				if src.Identity != tt.wantIdentity {
+					t.Errorf("Identity = %q, want %q", src.Identity, tt.wantIdentity)
+				}
+			}
+			if len(got) != tt.wantEntries {
+				t.Errorf("entries = %q, want %d", got, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func TestTLSReloader_Reload(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := tlsFiles(t, ca)
+	cfg.ReloadInterval = time.Nanosecond
+	r, err := newTLSReloader(cfg)
+	if err != nil {
+		t.Fatalf("newTLSReloader: %v", err)
+	}
+	servedCN := func() string {
+		leaf, err := x509.ParseCertificate(r.current().Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	newLeafCert(t, ca, "rotated", x509.ExtKeyUsageServerAuth).writePEM(t, cfg.CertFile, cfg.KeyFile)
+	later := time.Now().Add(time.Minute)
+	for _, f := range []string{cfg.CertFile, cfg.KeyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cn := servedCN(); cn != "rotated" {
+		t.Errorf("served CN = %q after rotation, want rotated", cn)
+	}
+
+	// A broken rewrite keeps the last good certificate.
+	os.WriteFile(cfg.KeyFile, []byte("garbage"), 0o600)
+	later = later.Add(time.Minute)
+	os.Chtimes(cfg.KeyFile, later, later)
+	if cn := servedCN(); cn != "rotated" {
+		t.Errorf("served CN = %q after a bad reload, want rotated", cn)
+	}
+}
+
+func TestNewTLSReloader_Invalid(t *testing.T) {
+	cfg := tlsFiles(t, newTestCA(t))
+	bad := []TLSConfig{
+		{},
+		{CertFile: cfg.CertFile},
+		{CertFile: cfg.CertFile, KeyFile: cfg.CertFile},
+		{CertFile: cfg.CertFile, KeyFile: cfg.KeyFile, ClientCAFile: cfg.KeyFile},
+		{CertFile: cfg.CertFile, KeyFile: cfg.KeyFile, ClientCAFile: "/nonexistent"},
+	}
+	for _, c := range bad {
+		if _, err := newTLSReloader(c); err == nil {
+			t.Errorf("Expected error for %+v", c)
+		}
+	}
+}
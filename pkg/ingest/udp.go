@@ -4,8 +4,12 @@ import (
 	"log"
 	"net"
 	"streamgate/pkg/engine"
+	"streamgate/pkg/model"
 )
 
+// ListenerUDP is the listener name attached to entries received over UDP.
+const ListenerUDP = "udp"
+
 // UDPIngestor listens for UDP packets and pushes logs to the buffer.
 type UDPIngestor struct {
 	addr   string
@@ -39,7 +43,7 @@ func (u *UDPIngestor) Start() error {
 	buf := make([]byte, 65535)
 
 	for {
-		n, _, err := conn.ReadFromUDP(buf)
+		n, from, err := conn.ReadFromUDP(buf)
 		if err != nil {
 			log.Printf("UDP Read error: %v", err)
 			continue
@@ -53,6 +57,6 @@ func (u *UDPIngestor) Start() error {
 		copy(packet, buf[:n])
 
 		// On buffer full, silently drop (tail drop strategy).
-		_ = u.buffer.Push(packet)
+		_ = u.buffer.PushFrom(packet, model.Source{Listener: ListenerUDP, Addr: from.String()})
 	}
 }
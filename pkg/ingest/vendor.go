@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Vendor intake endpoints (Splunk HEC, Datadog, Loki, Elasticsearch _bulk)
+// let agents already pointed at one of those services send to StreamGate
+// instead, with only a DNS change. They share the HTTP ingestor's port,
+// token, body limits and compression.
+//
+// Every vendor entry is a flat JSON object: the log's own fields (or
+// "message" for a text payload), plus the vendor's metadata as top-level
+// fields, so attribute filters and routes see them like any other field:
+//
+//   - "timestamp" (RFC 3339) when the vendor sends a time
+//   - "host", "source", "service", "level" where the vendor has them
+//   - vendor specifics by name: Splunk "index" and "sourcetype" (and indexed
+//     "fields"), Datadog ddtags ("env:prod" -> "env"), Loki stream labels
+//     and structured metadata, the Elasticsearch "index"
+//
+// A log's own field is never overwritten by metadata of the same name.
+
+// vendorFields is an entry under construction.
+type vendorFields map[string]interface{}
+
+// add sets key unless the entry already has it or v is empty.
+func (f vendorFields) add(key string, v interface{}) {
+	if v == nil {
+		return
+	}
+	if s, ok := v.(string); ok && s == "" {
+		return
+	}
+	if _, ok := f[key]; !ok {
+		f[key] = v
+	}
+}
+
+// addTime sets "timestamp" from t, if it is set.
+func (f vendorFields) addTime(t time.Time) {
+	if !t.IsZero() {
+		f.add("timestamp", t.UTC().Format(time.RFC3339Nano))
+	}
+}
+
+// marshalEntry encodes an entry without HTML escaping, so messages keep
+// their '<', '>' and '&'.
+func marshalEntry(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// decodeJSONObject decodes raw into a map, keeping numbers as written.
+func decodeJSONObject(raw []byte) (vendorFields, error) {
+	var m vendorFields
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// vendorToken is the credential a request carries in any of the schemes
+// vendor agents use: "Bearer", "Splunk" or "ApiKey" authorization, the
+// password of Basic auth, or a DD-API-KEY header.
+func vendorToken(r *http.Request) string {
+	if key := r.Header.Get("DD-API-KEY"); key != "" {
+		return key
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	switch strings.ToLower(scheme) {
+	case "bearer", "splunk", "apikey":
+		return token
+	}
+	return ""
+}
+
+// vendorAuthorized checks vendorToken against the ingest token.
+func (h *HTTPIngestor) vendorAuthorized(r *http.Request) bool {
+	if h.cfg.BearerToken == "" {
+		return true
+	}
+	token := vendorToken(r)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.BearerToken)) == 1
+}
+
+// writeJSON sends v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := marshalEntry(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
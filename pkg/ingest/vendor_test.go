@@ -0,0 +1,321 @@
+package ingest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"streamgate/pkg/engine"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/tidwall/gjson"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// lokiProtoRequest builds a snappy-compressed logproto.PushRequest with one
+// stream and one entry.
+func lokiProtoRequest(labels string, secs, nanos int64, line string, metadata [2]string) []byte {
+	var ts, pair, entry, stream, req []byte
+	ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(secs))
+	ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(nanos))
+	pair = protowire.AppendTag(pair, 1, protowire.BytesType)
+	pair = protowire.AppendString(pair, metadata[0])
+	pair = protowire.AppendTag(pair, 2, protowire.BytesType)
+	pair = protowire.AppendString(pair, metadata[1])
+
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, ts)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendString(entry, line)
+	entry = protowire.AppendTag(entry, 3, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, pair)
+
+	stream = protowire.AppendTag(stream, 1, protowire.BytesType)
+	stream = protowire.AppendString(stream, labels)
+	stream = protowire.AppendTag(stream, 2, protowire.BytesType)
+	stream = protowire.AppendBytes(stream, entry)
+	stream = protowire.AppendTag(stream, 3, protowire.VarintType) // hash, ignored
+	stream = protowire.AppendVarint(stream, 42)
+
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, stream)
+	return snappy.Encode(nil, req)
+}
+
+func TestVendorEndpoints(t *testing.T) {
+	splunkAuth := map[string]string{"Authorization": "Splunk s3cret"}
+
+	tests := []struct {
+		name         string
+		path         string
+		headers      map[string]string
+		body         string
+		wantStatus   int
+		wantResponse string              // substring of the response body
+		want         []map[string]string // per entry: gjson path -> value
+		wantListener string
+	}{
+		{
+			name:    "splunk hec events",
+			path:    SplunkHECEventPath + "?index=default",
+			headers: splunkAuth,
+			body: `{"time":1717243200.5,"host":"web1","sourcetype":"nginx","index":"main","event":"GET /","fields":{"region":"eu"}}` +
+				"\n" + `{"time":"1717243201","event":{"msg":"hi","host":"own"},"host":"web2"}`,
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"text":"Success","code":0}`,
+			want: []map[string]string{
+				{"message": "GET /", "timestamp": "2024-06-01T12:00:00.5Z", "host": "web1", "sourcetype": "nginx", "index": "main", "region": "eu"},
+				{"msg": "hi", "host": "own", "index": "default", "timestamp": "2024-06-01T12:00:01Z"},
+			},
+			wantListener: ListenerSplunkHEC,
+		},
+		{
+			name:       "splunk hec raw",
+			path:       SplunkHECRawPath + "?sourcetype=app",
+			headers:    splunkAuth,
+			body:       "one\ntwo\n",
+			wantStatus: http.StatusOK,
+			want: []map[string]string{
+				{"message": "one", "sourcetype": "app"},
+				{"message": "two", "sourcetype": "app"},
+			},
+			wantListener: ListenerSplunkHEC,
+		},
+		{
+			name:         "splunk hec without event",
+			path:         SplunkHECEventPath,
+			headers:      splunkAuth,
+			body:         `{"host":"web1"}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `"code":12`,
+		},
+		{
+			name:         "splunk hec without token",
+			path:         SplunkHECEventPath,
+			body:         `{"event":"x"}`,
+			wantStatus:   http.StatusUnauthorized,
+			wantResponse: `"code":2`,
+		},
+		{
+			name:         "splunk hec wrong token",
+			path:         SplunkHECEventPath,
+			headers:      map[string]string{"Authorization": "Splunk nope"},
+			body:         `{"event":"x"}`,
+			wantStatus:   http.StatusForbidden,
+			wantResponse: `"code":4`,
+		},
+		{
+			name:    "datadog",
+			path:    DatadogLogsPath + "?ddtags=team:web",
+			headers: map[string]string{"DD-API-KEY": "s3cret"},
+			body:    `[{"message":"GET /","ddsource":"nginx","ddtags":"env:prod,canary","hostname":"web1","service":"frontend","status":"error"}]`,
+			want: []map[string]string{{
+				"message": "GET /", "ddtags": "env:prod,canary", "host": "web1", "source": "nginx",
+				"service": "frontend", "level": "error", "env": "prod", "canary": "true", "team": "web",
+			}},
+			wantStatus:   http.StatusAccepted,
+			wantListener: ListenerDatadog,
+		},
+		{
+			name:       "datadog wrong key",
+			path:       DatadogLogsPath,
+			headers:    map[string]string{"DD-API-KEY": "nope"},
+			body:       `{"message":"x"}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "loki json",
+			path: LokiPushPath,
+			headers: map[string]string{
+				"Authorization": "Bearer s3cret", "Content-Type": "application/json", "X-Scope-OrgID": "acme",
+			},
+			body: `{"streams":[{"stream":{"app":"web","level":"warn"},"values":[["1717243200500000000","GET /",{"trace_id":"abc"}]]}]}`,
+			want: []map[string]string{{
+				"message": "GET /", "timestamp": "2024-06-01T12:00:00.5Z", "app": "web", "level": "warn",
+				"trace_id": "abc", "tenant": "acme",
+			}},
+			wantStatus:   http.StatusNoContent,
+			wantListener: ListenerLoki,
+		},
+		{
+			name:       "loki protobuf",
+			path:       LokiPushPath,
+			headers:    map[string]string{"Authorization": "Bearer s3cret", "Content-Type": "application/x-protobuf"},
+			body:       string(lokiProtoRequest(`{app="web", note="a \"b\""}`, 1717243200, 500000000, "GET /", [2]string{"trace_id", "abc"})),
+			wantStatus: http.StatusNoContent,
+			want: []map[string]string{{
+				"message": "GET /", "timestamp": "2024-06-01T12:00:00.5Z", "app": "web", "note": `a "b"`, "trace_id": "abc",
+			}},
+			wantListener: ListenerLoki,
+		},
+		{
+			name:       "loki bad protobuf",
+			path:       LokiPushPath,
+			headers:    map[string]string{"Authorization": "Bearer s3cret"},
+			body:       "not snappy",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "elasticsearch bulk",
+			path:    "/logs-default/_bulk",
+			headers: map[string]string{"Authorization": "Basic dXNlcjpzM2NyZXQ="}, // user:s3cret
+			body: `{"index":{}}` + "\n" + `{"@timestamp":"2024-06-01T12:00:00Z","message":"GET /"}` + "\n" +
+				`{"create":{"_index":"audit","_id":"1"}}` + "\n" + `{"message":"login"}` + "\n" +
+				`{"delete":{"_index":"audit","_id":"1"}}` + "\n",
+			wantStatus:   http.StatusOK,
+			wantResponse: `"errors":true,"items":[{"index":{"_index":"logs-default","status":201,"result":"created"}},{"create":{"_index":"audit","_id":"1","status":201,"result":"created"}},{"delete":{"_index":"audit","_id":"1","status":400,`,
+			want: []map[string]string{
+				{"message": "GET /", "@timestamp": "2024-06-01T12:00:00Z", "index": "logs-default"},
+				{"message": "login", "index": "audit"},
+			},
+			wantListener: ListenerElasticsearch,
+		},
+		{
+			name:       "elasticsearch malformed action",
+			path:       ElasticBulkPath,
+			headers:    map[string]string{"Authorization": "ApiKey s3cret"},
+			body:       "{\"message\":\"no action\"}\n",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb, _ := engine.NewRingBuffer(16)
+			h := NewHTTPIngestor("", rb, HTTPConfig{BearerToken: "s3cret"})
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.mux().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantResponse) {
+				t.Errorf("response = %s, want it to contain %s", rec.Body, tt.wantResponse)
+			}
+			for i, want := range tt.want {
+				entry, src := rb.PopFrom()
+				if entry == nil {
+					t.Fatalf("entry %d missing", i)
+				}
+				if src.Listener != tt.wantListener {
+					t.Errorf("entry %d: listener = %q, want %q", i, src.Listener, tt.wantListener)
+				}
+				for path, v := range want {
+					if got := gjson.GetBytes(entry, path).String(); got != v {
+						t.Errorf("entry %d: %s = %q, want %q (%s)", i, path, got, v, entry)
+					}
+				}
+			}
+			if rest := drain(rb); len(rest) != 0 {
+				t.Errorf("unexpected entries %q", rest)
+			}
+		})
+	}
+}
+
+func TestVendorEndpoints_BufferFull(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		headers    map[string]string
+		body       string
+		wantStatus int
+	}{
+		{"splunk hec", SplunkHECEventPath, nil, `{"event":"a"}{"event":"b"}`, http.StatusServiceUnavailable},
+		{"datadog", DatadogLogsPath, nil, `[{"message":"a"},{"message":"b"}]`, http.StatusTooManyRequests},
+		{
+			"loki", LokiPushPath, map[string]string{"Content-Type": "application/json"},
+			`{"streams":[{"stream":{},"values":[["1","a"],["2","b"]]}]}`, http.StatusTooManyRequests,
+		},
+		{"elasticsearch", ElasticBulkPath, nil, "{\"index\":{}}\n{\"a\":1}\n{\"index\":{}}\n{\"b\":1}\n", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb, _ := engine.NewRingBuffer(1)
+			h := NewHTTPIngestor("", rb, HTTPConfig{})
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.mux().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("no Retry-After")
+			}
+			if got := drain(rb); len(got) != 0 {
+				t.Errorf("entries = %q, want none", got)
+			}
+		})
+	}
+}
+
+func TestElasticClusterEndpoints(t *testing.T) {
+	tests := []struct {
+		path       string
+		auth       string
+		wantStatus int
+		want       map[string]string
+	}{
+		{"/", "ApiKey s3cret", http.StatusOK, map[string]string{"version.number": elasticVersion, "tagline": "You Know, for Search"}},
+		{ElasticHealthPath, "Basic dXNlcjpzM2NyZXQ=", http.StatusOK, map[string]string{"status": "green"}},
+		{"/", "", http.StatusUnauthorized, map[string]string{"error.type": "security_exception"}},
+		{"/nope", "ApiKey s3cret", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.auth, func(t *testing.T) {
+			rb, _ := engine.NewRingBuffer(2)
+			h := NewHTTPIngestor("", rb, HTTPConfig{BearerToken: "s3cret"})
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			h.mux().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.want == nil {
+				return
+			}
+			if got := rec.Header().Get("X-Elastic-Product"); got != "Elasticsearch" {
+				t.Errorf("X-Elastic-Product = %q", got)
+			}
+			for path, v := range tt.want {
+				if got := gjson.Get(rec.Body.String(), path).String(); got != v {
+					t.Errorf("%s = %q, want %q (%s)", path, got, v, rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLokiLabels(t *testing.T) {
+	got, err := parseLokiLabels(`{app="web",  env="prod", msg="a,b=\"c\"\n"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["app"] != "web" || got["env"] != "prod" || got["msg"] != "a,b=\"c\"\n" || len(got) != 3 {
+		t.Errorf("labels = %q", got)
+	}
+	if got, err := parseLokiLabels("{}"); err != nil || len(got) != 0 {
+		t.Errorf("empty labels = %q, %v", got, err)
+	}
+	for _, bad := range []string{`app="web"`, `{app=web}`, `{="x"}`, `{app="web}`} {
+		if _, err := parseLokiLabels(bad); err == nil {
+			t.Errorf("parseLokiLabels(%q) succeeded", bad)
+		}
+	}
+}
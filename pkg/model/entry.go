@@ -2,28 +2,116 @@ package model
 
 import (
 	"time"
+
+	"github.com/tidwall/gjson"
 )
 
+// Source describes where a log entry came from.
+// It travels alongside the raw bytes so entries can be routed and sharded
+// by origin without parsing them.
+type Source struct {
+	// Listener names the ingestor that received the entry (e.g. "tcp", "udp").
+	Listener string
+
+	// Addr is the remote address of the sender ("host:port"), empty if unknown.
+	Addr string
+
+	// Identity is the sender's verified TLS client certificate identity (its
+	// CN, else its first SAN), empty for unauthenticated senders.
+	Identity string
+}
+
 // LogEntry represents a single log event flowing through the system.
 // It is designed to be reused via sync.Pool to minimize allocations.
+//
+// The pipeline wraps every entry in a LogEntry before running the processor
+// chain, so the chain can share work: JSON validity and field lookups are
+// computed on first use and cached until Raw is replaced with SetRaw.
 type LogEntry struct {
-	// Timestamp is the time the log was received.
+	// Timestamp is the time the log was received (zero if not recorded).
 	Timestamp time.Time
 
 	// Raw is the underlying byte slice of the log message.
-	// Processors modify this slice in-place if possible.
+	// Processors modify this slice in-place if possible. Anything that changes
+	// its contents must go through SetRaw, or cached lookups go stale.
 	Raw []byte
 
+	// Source is where the entry came from.
+	Source Source
+
 	// Metadata can hold extracted fields (like 'service', 'level') for routing.
 	// We use a map but in a high-perf scenario, we might switch to a fixed struct or strict key set.
 	Metadata map[string]string
+
+	// Parse cache, tied to the current Raw.
+	json   jsonState
+	fields map[string]gjson.Result // gjson path -> result (misses included)
+}
+
+type jsonState uint8
+
+const (
+	jsonUnknown jsonState = iota
+	jsonValid
+	jsonInvalid
+)
+
+// NewLogEntry wraps raw bytes and their origin.
+func NewLogEntry(raw []byte, src Source) *LogEntry {
+	return &LogEntry{Raw: raw, Source: src}
+}
+
+// SetRaw replaces the entry's bytes and drops everything cached about the old ones.
+func (l *LogEntry) SetRaw(raw []byte) {
+	l.Raw = raw
+	l.invalidate()
+}
+
+// Touch drops cached parse results after Raw was modified in place.
+func (l *LogEntry) Touch() {
+	l.invalidate()
+}
+
+func (l *LogEntry) invalidate() {
+	l.json = jsonUnknown
+	clear(l.fields)
+}
+
+// IsJSON reports whether Raw is valid JSON. The first call validates; later
+// calls are free until Raw changes.
+func (l *LogEntry) IsJSON() bool {
+	if l.json == jsonUnknown {
+		l.json = jsonInvalid
+		if gjson.ValidBytes(l.Raw) {
+			l.json = jsonValid
+		}
+	}
+	return l.json == jsonValid
+}
+
+// Get returns the value at a gjson path, caching the result (including
+// misses) until Raw changes. Result.Index is the value's offset in Raw, so
+// callers can splice it without searching again.
+// Callers should check IsJSON first: gjson doesn't validate.
+func (l *LogEntry) Get(path string) gjson.Result {
+	if r, ok := l.fields[path]; ok {
+		return r
+	}
+	r := gjson.GetBytes(l.Raw, path)
+	if l.fields == nil {
+		l.fields = make(map[string]gjson.Result, 4)
+	}
+	l.fields[path] = r
+	return r
 }
 
 // Reset clears the LogEntry for reuse in a sync.Pool.
 func (l *LogEntry) Reset() {
 	l.Timestamp = time.Time{}
 	l.Raw = l.Raw[:0] // Keep capacity
+	l.Source = Source{}
 	for k := range l.Metadata {
 		delete(l.Metadata, k)
 	}
+	l.invalidate()
 }
@@ -0,0 +1,162 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// recordFields are the top-level keys AppendRecord writes. Any other key of
+// an OTel-shaped entry (one with a body, attributes or resource) was added
+// along the way, e.g. by a parse or transform processor, and is sent as a
+// log attribute.
+var recordFields = map[string]bool{
+	"timestamp": true, "timeUnixNano": true, "observedTimeUnixNano": true,
+	"severityNumber": true, "severityText": true, "eventName": true,
+	"body": true, "attributes": true, "droppedAttributesCount": true,
+	"flags": true, "traceId": true, "spanId": true,
+	"resource": true, "scope": true,
+}
+
+// Collect is the reverse of Explode: it turns entries back into a request,
+// grouping records that share a resource and scope. Entries that aren't
+// OTel-shaped become records whose body is the entry: a map for JSON
+// objects, a string otherwise. Records without a time get the current time
+// as their observed time.
+func Collect(entries [][]byte) *collogspb.ExportLogsServiceRequest {
+	req := &collogspb.ExportLogsServiceRequest{}
+	resources := make(map[string]*logspb.ResourceLogs)
+	scopes := make(map[*logspb.ResourceLogs]map[string]*logspb.ScopeLogs)
+	now := uint64(time.Now().UnixNano())
+
+	for _, entry := range entries {
+		var resource, scope gjson.Result
+		lr := &logspb.LogRecord{}
+
+		doc := gjson.ParseBytes(entry)
+		switch {
+		case !doc.IsObject() || !gjson.ValidBytes(entry):
+			lr.Body = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{
+				StringValue: strings.TrimRight(string(entry), "\r\n"),
+			}}
+		case doc.Get("body").Exists() || doc.Get("attributes").IsObject() || doc.Get("resource").IsObject():
+			resource, scope = doc.Get("resource"), doc.Get("scope")
+			fillRecord(lr, doc)
+		default:
+			lr.Body = anyValue(doc)
+		}
+
+		if lr.TimeUnixNano == 0 && lr.ObservedTimeUnixNano == 0 {
+			lr.ObservedTimeUnixNano = now
+		}
+
+		rl, ok := resources[resource.Raw]
+		if !ok {
+			rl = &logspb.ResourceLogs{SchemaUrl: resource.Get("schemaUrl").String()}
+			if resource.IsObject() {
+				rl.Resource = &resourcepb.Resource{
+					Attributes:             keyValues(resource.Get("attributes")),
+					DroppedAttributesCount: uint32(resource.Get("droppedAttributesCount").Uint()),
+				}
+			}
+			resources[resource.Raw] = rl
+			scopes[rl] = make(map[string]*logspb.ScopeLogs)
+			req.ResourceLogs = append(req.ResourceLogs, rl)
+		}
+		sl, ok := scopes[rl][scope.Raw]
+		if !ok {
+			sl = &logspb.ScopeLogs{SchemaUrl: scope.Get("schemaUrl").String()}
+			if scope.IsObject() {
+				sl.Scope = &commonpb.InstrumentationScope{
+					Name:                   scope.Get("name").String(),
+					Version:                scope.Get("version").String(),
+					Attributes:             keyValues(scope.Get("attributes")),
+					DroppedAttributesCount: uint32(scope.Get("droppedAttributesCount").Uint()),
+				}
+			}
+			scopes[rl][scope.Raw] = sl
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+		}
+		sl.LogRecords = append(sl.LogRecords, lr)
+	}
+	return req
+}
+
+// fillRecord reads an OTel-shaped entry into lr.
+func fillRecord(lr *logspb.LogRecord, doc gjson.Result) {
+	lr.TimeUnixNano = doc.Get("timeUnixNano").Uint()
+	if lr.TimeUnixNano == 0 {
+		if t, err := time.Parse(time.RFC3339Nano, doc.Get("timestamp").String()); err == nil {
+			lr.TimeUnixNano = uint64(t.UnixNano())
+		}
+	}
+	lr.ObservedTimeUnixNano = doc.Get("observedTimeUnixNano").Uint()
+	lr.SeverityNumber = logspb.SeverityNumber(doc.Get("severityNumber").Int())
+	lr.SeverityText = doc.Get("severityText").String()
+	lr.EventName = doc.Get("eventName").String()
+	if body := doc.Get("body"); body.Exists() {
+		lr.Body = anyValue(body)
+	}
+	lr.Attributes = keyValues(doc.Get("attributes"))
+	lr.DroppedAttributesCount = uint32(doc.Get("droppedAttributesCount").Uint())
+	lr.Flags = uint32(doc.Get("flags").Uint())
+	lr.TraceId, _ = hex.DecodeString(doc.Get("traceId").String())
+	lr.SpanId, _ = hex.DecodeString(doc.Get("spanId").String())
+
+	doc.ForEach(func(key, value gjson.Result) bool {
+		if !recordFields[key.Str] {
+			lr.Attributes = append(lr.Attributes, &commonpb.KeyValue{Key: key.Str, Value: anyValue(value)})
+		}
+		return true
+	})
+}
+
+// keyValues converts a JSON object to key/values, in document order.
+func keyValues(obj gjson.Result) []*commonpb.KeyValue {
+	if !obj.IsObject() {
+		return nil
+	}
+	var kvs []*commonpb.KeyValue
+	obj.ForEach(func(key, value gjson.Result) bool {
+		kvs = append(kvs, &commonpb.KeyValue{Key: key.Str, Value: anyValue(value)})
+		return true
+	})
+	return kvs
+}
+
+// anyValue converts a JSON value. Whole numbers that fit become ints,
+// other numbers doubles, and null an empty value.
+func anyValue(v gjson.Result) *commonpb.AnyValue {
+	switch v.Type {
+	case gjson.String:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Str}}
+	case gjson.True, gjson.False:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.Bool()}}
+	case gjson.Number:
+		if i, err := strconv.ParseInt(v.Raw, 10, 64); err == nil {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: i}}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.Num}}
+	case gjson.JSON:
+		if v.IsArray() {
+			arr := &commonpb.ArrayValue{}
+			v.ForEach(func(_, item gjson.Result) bool {
+				arr.Values = append(arr.Values, anyValue(item))
+				return true
+			})
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: arr}}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{
+			KvlistValue: &commonpb.KeyValueList{Values: keyValues(v)},
+		}}
+	default:
+		return &commonpb.AnyValue{}
+	}
+}
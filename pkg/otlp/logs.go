@@ -0,0 +1,251 @@
+// Package otlp converts between OpenTelemetry log requests and StreamGate
+// entries. Every LogRecord becomes one flat JSON entry carrying its resource
+// and scope, in the layout the attribute filter's OTel search paths expect:
+//
+//	{
+//	  "timestamp": "2024-06-01T12:00:00Z",
+//	  "timeUnixNano": "1717243200000000000",
+//	  "severityNumber": 9, "severityText": "INFO",
+//	  "body": "user logged in",
+//	  "attributes": {"http.status_code": 200},
+//	  "traceId": "5b8efff7...", "spanId": "eee19b7e...",
+//	  "resource": {"attributes": {"service.name": "checkout"}},
+//	  "scope": {"name": "app", "version": "1.0"}
+//	}
+//
+// Attribute values keep their JSON types (ints are numbers, not the strings
+// OTLP/JSON uses), so filters can compare them numerically.
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// Explode turns a request into one entry per LogRecord.
+func Explode(req *collogspb.ExportLogsServiceRequest) [][]byte {
+	var entries [][]byte
+	for _, rl := range req.GetResourceLogs() {
+		for _, sl := range rl.GetScopeLogs() {
+			for _, lr := range sl.GetLogRecords() {
+				entries = append(entries, AppendRecord(nil, rl, sl, lr))
+			}
+		}
+	}
+	return entries
+}
+
+// CountRecords returns the number of LogRecords in a request.
+func CountRecords(req *collogspb.ExportLogsServiceRequest) int {
+	n := 0
+	for _, rl := range req.GetResourceLogs() {
+		for _, sl := range rl.GetScopeLogs() {
+			n += len(sl.GetLogRecords())
+		}
+	}
+	return n
+}
+
+// AppendRecord appends the entry for one LogRecord to dst.
+func AppendRecord(dst []byte, rl *logspb.ResourceLogs, sl *logspb.ScopeLogs, lr *logspb.LogRecord) []byte {
+	dst = append(dst, '{')
+	w := objectWriter{dst: dst}
+
+	ts := lr.GetTimeUnixNano()
+	if ts == 0 {
+		ts = lr.GetObservedTimeUnixNano()
+	}
+	if ts != 0 {
+		w.key("timestamp")
+		w.dst = appendString(w.dst, time.Unix(0, int64(ts)).UTC().Format(time.RFC3339Nano))
+	}
+	if v := lr.GetTimeUnixNano(); v != 0 {
+		w.key("timeUnixNano")
+		w.dst = appendString(w.dst, strconv.FormatUint(v, 10))
+	}
+	if v := lr.GetObservedTimeUnixNano(); v != 0 {
+		w.key("observedTimeUnixNano")
+		w.dst = appendString(w.dst, strconv.FormatUint(v, 10))
+	}
+	if v := lr.GetSeverityNumber(); v != 0 {
+		w.key("severityNumber")
+		w.dst = strconv.AppendInt(w.dst, int64(v), 10)
+	}
+	if v := lr.GetSeverityText(); v != "" {
+		w.key("severityText")
+		w.dst = appendString(w.dst, v)
+	}
+	if v := lr.GetEventName(); v != "" {
+		w.key("eventName")
+		w.dst = appendString(w.dst, v)
+	}
+	if lr.GetBody() != nil {
+		w.key("body")
+		w.dst = appendAnyValue(w.dst, lr.GetBody())
+	}
+	if len(lr.GetAttributes()) > 0 {
+		w.key("attributes")
+		w.dst = appendAttributes(w.dst, lr.GetAttributes())
+	}
+	if v := lr.GetDroppedAttributesCount(); v != 0 {
+		w.key("droppedAttributesCount")
+		w.dst = strconv.AppendUint(w.dst, uint64(v), 10)
+	}
+	if v := lr.GetFlags(); v != 0 {
+		w.key("flags")
+		w.dst = strconv.AppendUint(w.dst, uint64(v), 10)
+	}
+	if v := lr.GetTraceId(); len(v) > 0 {
+		w.key("traceId")
+		w.dst = appendString(w.dst, hex.EncodeToString(v))
+	}
+	if v := lr.GetSpanId(); len(v) > 0 {
+		w.key("spanId")
+		w.dst = appendString(w.dst, hex.EncodeToString(v))
+	}
+	if res := rl.GetResource(); res != nil || rl.GetSchemaUrl() != "" {
+		w.key("resource")
+		w.dst = appendResource(w.dst, res, rl.GetSchemaUrl())
+	}
+	if scope := sl.GetScope(); scope != nil || sl.GetSchemaUrl() != "" {
+		w.key("scope")
+		w.dst = appendScope(w.dst, scope, sl.GetSchemaUrl())
+	}
+	return append(w.dst, '}')
+}
+
+func appendResource(dst []byte, res *resourcepb.Resource, schemaURL string) []byte {
+	dst = append(dst, '{')
+	w := objectWriter{dst: dst}
+	if len(res.GetAttributes()) > 0 {
+		w.key("attributes")
+		w.dst = appendAttributes(w.dst, res.GetAttributes())
+	}
+	if v := res.GetDroppedAttributesCount(); v != 0 {
+		w.key("droppedAttributesCount")
+		w.dst = strconv.AppendUint(w.dst, uint64(v), 10)
+	}
+	if schemaURL != "" {
+		w.key("schemaUrl")
+		w.dst = appendString(w.dst, schemaURL)
+	}
+	return append(w.dst, '}')
+}
+
+func appendScope(dst []byte, scope *commonpb.InstrumentationScope, schemaURL string) []byte {
+	dst = append(dst, '{')
+	w := objectWriter{dst: dst}
+	if v := scope.GetName(); v != "" {
+		w.key("name")
+		w.dst = appendString(w.dst, v)
+	}
+	if v := scope.GetVersion(); v != "" {
+		w.key("version")
+		w.dst = appendString(w.dst, v)
+	}
+	if len(scope.GetAttributes()) > 0 {
+		w.key("attributes")
+		w.dst = appendAttributes(w.dst, scope.GetAttributes())
+	}
+	if v := scope.GetDroppedAttributesCount(); v != 0 {
+		w.key("droppedAttributesCount")
+		w.dst = strconv.AppendUint(w.dst, uint64(v), 10)
+	}
+	if schemaURL != "" {
+		w.key("schemaUrl")
+		w.dst = appendString(w.dst, schemaURL)
+	}
+	return append(w.dst, '}')
+}
+
+// appendAttributes renders key/values as a JSON object.
+func appendAttributes(dst []byte, kvs []*commonpb.KeyValue) []byte {
+	dst = append(dst, '{')
+	w := objectWriter{dst: dst}
+	for _, kv := range kvs {
+		w.key(kv.GetKey())
+		w.dst = appendAnyValue(w.dst, kv.GetValue())
+	}
+	return append(w.dst, '}')
+}
+
+// appendAnyValue renders a value with its natural JSON type. Bytes become
+// base64 strings, and non-finite doubles strings ("NaN", "+Inf", "-Inf").
+func appendAnyValue(dst []byte, v *commonpb.AnyValue) []byte {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return appendString(dst, val.StringValue)
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.AppendBool(dst, val.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.AppendInt(dst, val.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		if math.IsNaN(val.DoubleValue) || math.IsInf(val.DoubleValue, 0) {
+			return appendString(dst, strconv.FormatFloat(val.DoubleValue, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(dst, val.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return appendString(dst, base64.StdEncoding.EncodeToString(val.BytesValue))
+	case *commonpb.AnyValue_ArrayValue:
+		dst = append(dst, '[')
+		for i, item := range val.ArrayValue.GetValues() {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendAnyValue(dst, item)
+		}
+		return append(dst, ']')
+	case *commonpb.AnyValue_KvlistValue:
+		return appendAttributes(dst, val.KvlistValue.GetValues())
+	default:
+		return append(dst, "null"...)
+	}
+}
+
+// objectWriter tracks whether a comma is needed before the next member.
+type objectWriter struct {
+	dst   []byte
+	count int
+}
+
+func (w *objectWriter) key(k string) {
+	if w.count > 0 {
+		w.dst = append(w.dst, ',')
+	}
+	w.count++
+	w.dst = appendString(w.dst, k)
+	w.dst = append(w.dst, ':')
+}
+
+// appendString appends s as a JSON string literal.
+func appendString(dst []byte, s string) []byte {
+	const hexDigits = "0123456789abcdef"
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		case '\t':
+			dst = append(dst, '\\', 't')
+		default:
+			if c < 0x20 {
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			} else {
+				dst = append(dst, c)
+			}
+		}
+	}
+	return append(dst, '"')
+}
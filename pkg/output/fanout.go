@@ -1,6 +1,8 @@
 package output
 
 import (
+	"errors"
+	"io"
 	"sync"
 )
 
@@ -39,3 +41,14 @@ func (f *FanOutOutput) WriteBatch(entries [][]byte) error {
 
 	return nil
 }
+
+// Close closes the outputs that hold resources (connections).
+func (f *FanOutOutput) Close() error {
+	var errs []error
+	for _, out := range f.outputs {
+		if c, ok := out.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,212 @@
+package output
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"streamgate/pkg/otlp"
+	"sync"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultOTLPTimeout    = 10 * time.Second
+	defaultOTLPMaxElapsed = 30 * time.Second
+	defaultOTLPMaxBatch   = 1000
+
+	otlpInitialBackoff = 500 * time.Millisecond
+	otlpMaxBackoff     = 5 * time.Second
+)
+
+// OTLPConfig holds configuration for creating an OTLPOutput.
+type OTLPConfig struct {
+	Endpoint string // host:port of the Collector, e.g. "otel-collector:4317"
+
+	// Insecure sends plaintext. Otherwise TLS is used, verified against the
+	// system roots or CAFile, with CertFile/KeyFile as the client certificate.
+	Insecure           bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string // overrides the name checked in the server certificate
+	InsecureSkipVerify bool
+
+	// Headers are sent as gRPC metadata on every export, e.g. an API key.
+	Headers map[string]string
+
+	// Compression is "gzip" (the default) or "none".
+	Compression string
+
+	Timeout    time.Duration // per attempt (default 10s)
+	MaxElapsed time.Duration // retries give up after this long (default 30s)
+	MaxBatch   int           // records per request (default 1000)
+}
+
+// OTLPOutput exports logs to an OpenTelemetry Collector over OTLP/gRPC.
+// Entries are grouped back into resource and scope logs (see otlp.Collect),
+// so records that came in over OTLP go out with their resource intact.
+//
+// Exports failing with UNAVAILABLE or RESOURCE_EXHAUSTED are retried with
+// exponential backoff, honoring the server's RetryInfo, until MaxElapsed.
+type OTLPOutput struct {
+	conn     *grpc.ClientConn
+	client   collogspb.LogsServiceClient
+	md       metadata.MD
+	callOpts []grpc.CallOption
+	cfg      OTLPConfig
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func NewOTLPOutput(cfg OTLPConfig) (*OTLPOutput, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint must be specified")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultOTLPTimeout
+	}
+	if cfg.MaxElapsed <= 0 {
+		cfg.MaxElapsed = defaultOTLPMaxElapsed
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = defaultOTLPMaxBatch
+	}
+
+	var callOpts []grpc.CallOption
+	switch cfg.Compression {
+	case "", "gzip":
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	case "none":
+	default:
+		return nil, fmt.Errorf("unknown compression %q (want gzip or none)", cfg.Compression)
+	}
+
+	creds := insecure.NewCredentials()
+	if !cfg.Insecure {
+		tlsCfg, err := otlpTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsCfg)
+	}
+	conn, err := grpc.NewClient(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP client: %w", err)
+	}
+
+	return &OTLPOutput{
+		conn:     conn,
+		client:   collogspb.NewLogsServiceClient(conn),
+		md:       metadata.New(cfg.Headers),
+		callOpts: callOpts,
+		cfg:      cfg,
+		closed:   make(chan struct{}),
+	}, nil
+}
+
+func otlpTLSConfig(cfg OTLPConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+func (o *OTLPOutput) WriteBatch(entries [][]byte) error {
+	for len(entries) > 0 {
+		n := min(len(entries), o.cfg.MaxBatch)
+		if err := o.export(otlp.Collect(entries[:n])); err != nil {
+			return err
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+// export sends one request, retrying transient failures.
+func (o *OTLPOutput) export(req *collogspb.ExportLogsServiceRequest) error {
+	deadline := time.Now().Add(o.cfg.MaxElapsed)
+	backoff := otlpInitialBackoff
+	for {
+		ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), o.md), o.cfg.Timeout)
+		resp, err := o.client.Export(ctx, req, o.callOpts...)
+		cancel()
+		if err == nil {
+			if ps := resp.GetPartialSuccess(); ps.GetRejectedLogRecords() > 0 || ps.GetErrorMessage() != "" {
+				log.Printf("OTLP output: %s rejected %d records: %s", o.cfg.Endpoint, ps.GetRejectedLogRecords(), ps.GetErrorMessage())
+			}
+			return nil
+		}
+
+		delay, retry := retryDelay(err, backoff)
+		if !retry || time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("otlp export to %s: %w", o.cfg.Endpoint, err)
+		}
+		select {
+		case <-time.After(delay):
+		case <-o.closed:
+			return fmt.Errorf("otlp export to %s: output closed: %w", o.cfg.Endpoint, err)
+		}
+		backoff = min(backoff*2, otlpMaxBackoff)
+	}
+}
+
+// retryDelay reports whether err is retryable and how long to wait: the
+// server's RetryInfo if it sent one, else backoff.
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Unavailable, codes.ResourceExhausted:
+	default:
+		return 0, false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return backoff, true
+}
+
+// Close aborts pending retries and closes the connection.
+func (o *OTLPOutput) Close() error {
+	var err error
+	o.closeOnce.Do(func() {
+		close(o.closed)
+		err = o.conn.Close()
+	})
+	return err
+}